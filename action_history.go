@@ -0,0 +1,221 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ActionType string
+
+const (
+	ActionMint    ActionType = "mint"
+	ActionBurn    ActionType = "burn"
+	ActionSwap    ActionType = "swap"
+	ActionCollect ActionType = "collect"
+	ActionFlash   ActionType = "flash"
+)
+
+// 已应用到pool的事件, Amount0/Amount1为模拟器执行的结果
+type Record struct {
+	Id          string       `gorm:"primarykey"` // txHash_logIndex
+	PoolAddress string       `gorm:"index:idx_record_pool_block"`
+	ActionType  ActionType   `gorm:"index"`
+	Owner       string       `gorm:"index"` // mint/burn/collect为position owner, swap为sender
+	TxHash      string       `gorm:"index"`
+	LogIndex    uint         // 区块内的log序号
+	BlockNum    uint64       `gorm:"index:idx_record_pool_block"`
+	Params      RecordParams // 事件参数和解析出的swap输入
+	Amount0     decimal.Decimal
+	Amount1     decimal.Decimal
+	Timestamp   time.Time `gorm:"index"` // 仅在RecordBlockTime开启时填充
+}
+
+func NewRecord(log *types.Log, action ActionType, owner string, params RecordParams, amount0, amount1 decimal.Decimal) *Record {
+	return &Record{
+		Id:          fmt.Sprintf("%s_%d", log.TxHash, log.Index),
+		PoolAddress: log.Address.String(),
+		ActionType:  action,
+		Owner:       owner,
+		TxHash:      log.TxHash.String(),
+		LogIndex:    log.Index,
+		BlockNum:    log.BlockNumber,
+		Params:      params,
+		Amount0:     amount0,
+		Amount1:     amount1,
+	}
+}
+
+type RecordParams map[string]string
+
+func (nc RecordParams) GormDataType() string {
+	return "LONGTEXT"
+}
+
+func (j *RecordParams) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case []byte:
+		{
+			err = json.Unmarshal(v, j)
+		}
+	case string:
+		{
+			err = json.Unmarshal([]byte(v), j)
+		}
+	case nil:
+		return nil
+	default:
+		err = errors.New(fmt.Sprint("Failed to unmarshal RecordParams value:", value))
+	}
+	return err
+}
+
+func (j RecordParams) Value() (driver.Value, error) {
+	bs, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	return string(bs), nil
+}
+
+type RecordQuery struct {
+	PoolAddress string
+	Owner       string
+	ActionTypes []ActionType
+	FromBlock   uint64 // 0表示不限制
+	ToBlock     uint64 // 0表示不限制, inclusive
+	FromTime    time.Time
+	ToTime      time.Time
+	Limit       int
+}
+
+var ErrRecordsWithoutTime = errors.New("records have no block time, sync with RecordBlockTime enabled to query by time")
+
+// 按区块和log顺序返回已提交的事件历史. 按时间查询时范围内有没有时间的事件返回ErrRecordsWithoutTime
+func (pm *Simulator) QueryRecords(q RecordQuery) ([]*Record, error) {
+	db := pm.recordFilter(q)
+	if !q.FromTime.IsZero() || !q.ToTime.IsZero() {
+		var untimed int64
+		err := pm.recordFilter(q).Where("timestamp IS NULL OR timestamp < ?", time.Unix(1, 0)).Count(&untimed).Error
+		if err != nil {
+			return nil, err
+		}
+		if untimed > 0 {
+			return nil, fmt.Errorf("%w: %d records", ErrRecordsWithoutTime, untimed)
+		}
+	}
+	if !q.FromTime.IsZero() {
+		db = db.Where("timestamp >= ?", q.FromTime)
+	}
+	if !q.ToTime.IsZero() {
+		db = db.Where("timestamp <= ?", q.ToTime)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	var records []*Record
+	err := db.Order("block_num, log_index").Find(&records).Error
+	return records, err
+}
+
+// 时间以外的查询条件
+func (pm *Simulator) recordFilter(q RecordQuery) *gorm.DB {
+	db := pm.db.Model(&Record{})
+	if q.PoolAddress != "" {
+		db = db.Where("pool_address = ?", q.PoolAddress)
+	}
+	if q.Owner != "" {
+		db = db.Where("owner = ?", q.Owner)
+	}
+	if len(q.ActionTypes) > 0 {
+		db = db.Where("action_type IN ?", q.ActionTypes)
+	}
+	if q.FromBlock > 0 {
+		db = db.Where("block_num >= ?", q.FromBlock)
+	}
+	if q.ToBlock > 0 {
+		db = db.Where("block_num <= ?", q.ToBlock)
+	}
+	return db
+}
+
+func (pm *Simulator) addRecord(record *Record) {
+	pm.pendingRecords = append(pm.pendingRecords, record)
+}
+
+// 在FlushPools的事务中写入, 和pool状态/同步游标保持一致
+func (pm *Simulator) flushRecords(tx *gorm.DB, records []*Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	// 重建pool时会重放同一事件, 以txHash_logIndex覆盖
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(records, 500).Error
+}
+
+// RecordBlockTime开启时在flush的事务之前填充区块时间, 优先使用同步时预取的时间
+func (pm *Simulator) fillRecordTimestamps(records []*Record) error {
+	if !pm.RecordBlockTime {
+		return nil
+	}
+	for _, record := range records {
+		if !record.Timestamp.IsZero() {
+			continue
+		}
+		ts, ok := pm.blockTimes[record.BlockNum]
+		if !ok {
+			header, err := pm.rpc.HeaderByNumber(pm.ctx, new(big.Int).SetUint64(record.BlockNum))
+			if err != nil {
+				logrus.Errorf("failed get header %d: %s", record.BlockNum, err)
+				return err
+			}
+			ts = time.Unix(int64(header.Time), 0).UTC()
+			pm.addBlockTimes(map[uint64]time.Time{record.BlockNum: ts})
+		}
+		record.Timestamp = ts
+	}
+	return nil
+}
+
+// RecordBlockTime开启时查询logs所在区块的时间, 在加锁之前调用
+func (pm *Simulator) fetchBlockTimes(ctx context.Context, logs []types.Log) (map[uint64]time.Time, error) {
+	if !pm.RecordBlockTime {
+		return nil, nil
+	}
+	times := map[uint64]time.Time{}
+	for _, log := range logs {
+		if _, ok := times[log.BlockNumber]; ok {
+			continue
+		}
+		header, err := pm.rpc.HeaderByNumber(ctx, new(big.Int).SetUint64(log.BlockNumber))
+		if err != nil {
+			logrus.Errorf("failed get header %d: %s", log.BlockNumber, err)
+			return nil, err
+		}
+		times[log.BlockNumber] = time.Unix(int64(header.Time), 0).UTC()
+	}
+	return times, nil
+}
+
+// 调用方持有lock
+func (pm *Simulator) addBlockTimes(times map[uint64]time.Time) {
+	if len(times) == 0 {
+		return
+	}
+	if pm.blockTimes == nil {
+		pm.blockTimes = map[uint64]time.Time{}
+	}
+	for block, ts := range times {
+		pm.blockTimes[block] = ts
+	}
+}
@@ -0,0 +1,134 @@
+package uniswap_v3_simulator
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func intTopic(v int) common.Hash {
+	return common.BytesToHash(math.U256Bytes(big.NewInt(int64(v))))
+}
+
+func word(d decimal.Decimal) []byte {
+	return math.U256Bytes(d.BigInt())
+}
+
+func addrTopic(addr string) common.Hash {
+	return common.BytesToHash(common.HexToAddress(addr).Bytes())
+}
+
+func testMintLog(pool common.Address, owner string, tickLower, tickUpper int, amount decimal.Decimal, block uint64, index uint) types.Log {
+	data := append(common.LeftPadBytes(common.HexToAddress(owner).Bytes(), 32), word(amount)...)
+	data = append(data, word(ZERO)...)
+	data = append(data, word(ZERO)...)
+	return types.Log{
+		Address:     pool,
+		Topics:      []common.Hash{TOPIC_MINT, addrTopic(owner), intTopic(tickLower), intTopic(tickUpper)},
+		Data:        data,
+		BlockNumber: block,
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(block*1000 + uint64(index))),
+		Index:       index,
+	}
+}
+
+// 先在克隆上执行swap得到事件中的结果, 再构造swap log
+func testSwapLog(t *testing.T, pool *CorePool, sender string, zeroForOne bool, amountIn decimal.Decimal, block uint64, index uint) types.Log {
+	clone := pool.Clone()
+	amount0, amount1, price, err := clone.HandleSwap(zeroForOne, amountIn, nil, false)
+	assert.NoError(t, err)
+	data := append(word(amount0), word(amount1)...)
+	data = append(data, word(price)...)
+	data = append(data, word(clone.Liquidity)...)
+	data = append(data, math.U256Bytes(big.NewInt(int64(clone.TickCurrent)))...)
+	return types.Log{
+		Address:     common.HexToAddress(pool.PoolAddress),
+		Topics:      []common.Hash{TOPIC_SWAP, addrTopic(sender), addrTopic(sender)},
+		Data:        data,
+		BlockNumber: block,
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(block*1000 + uint64(index))),
+		Index:       index,
+	}
+}
+
+func TestSimulator_RecordsAppliedEvents(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+
+	owner := "0x1111111111111111111111111111111111111111"
+	mint := testMintLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 0)
+	assert.NoError(t, pm.HandleLogs([]types.Log{mint}))
+	swap := testSwapLog(t, pool, owner, false, decimal.NewFromInt(1e14), 11, 3)
+	assert.NoError(t, pm.HandleLogs([]types.Log{swap}))
+
+	pm.currentBlock = 11
+	assert.NoError(t, pm.FlushPools())
+
+	records, err := pm.QueryRecords(RecordQuery{PoolAddress: addr.String()})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, ActionMint, records[0].ActionType)
+	assert.Equal(t, ActionSwap, records[1].ActionType)
+	assert.Equal(t, "100000000000000", records[1].Params["amount_specified"])
+
+	records, err = pm.QueryRecords(RecordQuery{Owner: owner, ActionTypes: []ActionType{ActionMint}, FromBlock: 10, ToBlock: 10})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, uint64(10), records[0].BlockNum)
+}
+
+func TestSimulator_RecordsInvalidCollect(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+
+	// 模拟器校验不通过的collect只记录事件, 后面的事件照常应用
+	owner := "0x1111111111111111111111111111111111111111"
+	data := append(common.LeftPadBytes(common.HexToAddress(owner).Bytes(), 32), word(decimal.NewFromInt(5))...)
+	data = append(data, word(decimal.NewFromInt(7))...)
+	collect := types.Log{
+		Address:     addr,
+		Topics:      []common.Hash{TOPIC_COLLECT, addrTopic(owner), intTopic(60), intTopic(-60)},
+		Data:        data,
+		BlockNumber: 10,
+		TxHash:      common.BigToHash(big.NewInt(10000)),
+	}
+	mint := testMintLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 1)
+	assert.NoError(t, pm.HandleLogs([]types.Log{collect, mint}))
+	pm.currentBlock = 10
+	assert.NoError(t, pm.FlushPools())
+
+	records, err := pm.QueryRecords(RecordQuery{PoolAddress: addr.String()})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, ActionCollect, records[0].ActionType)
+	assert.True(t, decimal.NewFromInt(5).Equal(records[0].Amount0))
+	assert.Equal(t, ActionMint, records[1].ActionType)
+}
+
+func TestSimulator_QueryRecordsByTimeWithoutBlockTime(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+
+	mint := testMintLog(addr, "0x1111111111111111111111111111111111111111", -60, 60, decimal.NewFromInt(1e17), 10, 0)
+	assert.NoError(t, pm.HandleLogs([]types.Log{mint}))
+	pm.currentBlock = 10
+	assert.NoError(t, pm.FlushPools())
+
+	_, err := pm.QueryRecords(RecordQuery{PoolAddress: addr.String(), FromTime: time.Unix(1, 0)})
+	assert.ErrorIs(t, err, ErrRecordsWithoutTime)
+	records, err := pm.QueryRecords(RecordQuery{PoolAddress: addr.String()})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+}
@@ -0,0 +1,242 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+// 请求参数不合法, 和ErrPoolNotFound一起由传输层映射为对应的状态码
+var ErrInvalidRequest = errors.New("invalid request")
+
+// 与传输协议无关的查询/模拟接口, HTTP和gRPC服务都基于它.
+// 所有读取都在fork上进行, 可以和正在运行的同步并发调用
+type API struct {
+	simulator *Simulator
+}
+
+func NewAPI(simulator *Simulator) *API {
+	return &API{simulator: simulator}
+}
+
+type PoolState struct {
+	PoolAddress          string          `json:"pool_address"`
+	Block                uint64          `json:"block"`
+	Token0               string          `json:"token0"`
+	Token1               string          `json:"token1"`
+	Fee                  FeeAmount       `json:"fee"`
+	TickSpacing          int             `json:"tick_spacing"`
+	Slot0                Slot0Export     `json:"slot0"`
+	Liquidity            decimal.Decimal `json:"liquidity"`
+	FeeGrowthGlobal0X128 decimal.Decimal `json:"fee_growth_global0_x128"`
+	FeeGrowthGlobal1X128 decimal.Decimal `json:"fee_growth_global1_x128"`
+}
+
+func newPoolState(pool *CorePool, block uint64) *PoolState {
+	return &PoolState{
+		PoolAddress:          pool.PoolAddress,
+		Block:                block,
+		Token0:               pool.Token0,
+		Token1:               pool.Token1,
+		Fee:                  pool.Fee,
+		TickSpacing:          pool.TickSpacing,
+		Slot0:                Slot0Export{SqrtPriceX96: pool.SqrtPriceX96, Tick: pool.TickCurrent},
+		Liquidity:            pool.Liquidity,
+		FeeGrowthGlobal0X128: pool.FeeGrowthGlobal0X128,
+		FeeGrowthGlobal1X128: pool.FeeGrowthGlobal1X128,
+	}
+}
+
+func (a *API) SyncedBlock() uint64 {
+	return a.simulator.CurrentBlock()
+}
+
+func (a *API) Pools() []common.Address {
+	return a.simulator.PoolAddresses()
+}
+
+// 分叉单个pool, 同时返回它所在的同步高度
+func (a *API) forkPool(addr common.Address) (*CorePool, uint64, error) {
+	fork, block, err := a.simulator.Snapshot(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return fork.Pools[addr], block, nil
+}
+
+func (a *API) Pool(addr common.Address) (*PoolState, error) {
+	pool, block, err := a.forkPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	return newPoolState(pool, block), nil
+}
+
+type TicksResponse struct {
+	PoolAddress string       `json:"pool_address"`
+	Block       uint64       `json:"block"`
+	Ticks       []TickExport `json:"ticks"`
+}
+
+func (a *API) Ticks(addr common.Address) (*TicksResponse, error) {
+	pool, block, err := a.forkPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	export, err := NewPoolExport(pool)
+	if err != nil {
+		return nil, err
+	}
+	return &TicksResponse{PoolAddress: pool.PoolAddress, Block: block, Ticks: export.Ticks}, nil
+}
+
+type PositionsResponse struct {
+	PoolAddress string           `json:"pool_address"`
+	Block       uint64           `json:"block"`
+	Positions   []PositionExport `json:"positions"`
+}
+
+// owner为空时返回所有position
+func (a *API) Positions(addr common.Address, owner string) (*PositionsResponse, error) {
+	pool, block, err := a.forkPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	export, err := NewPoolExport(pool)
+	if err != nil {
+		return nil, err
+	}
+	positions := []PositionExport{}
+	for _, position := range export.Positions {
+		if owner == "" || strings.EqualFold(position.Owner, owner) {
+			positions = append(positions, position)
+		}
+	}
+	return &PositionsResponse{PoolAddress: pool.PoolAddress, Block: block, Positions: positions}, nil
+}
+
+type QuoteRequest struct {
+	Pool              common.Address   `json:"pool"`
+	ZeroForOne        bool             `json:"zero_for_one"`
+	ExactOutput       bool             `json:"exact_output"` // false时Amount为输入数量, true时为输出数量
+	Amount            decimal.Decimal  `json:"amount"`
+	SqrtPriceLimitX96 *decimal.Decimal `json:"sqrt_price_limit_x96,omitempty"`
+}
+
+type QuoteResponse struct {
+	Block             uint64          `json:"block"`
+	AmountIn          decimal.Decimal `json:"amount_in"`
+	AmountOut         decimal.Decimal `json:"amount_out"`
+	Amount0           decimal.Decimal `json:"amount0"`
+	Amount1           decimal.Decimal `json:"amount1"`
+	SqrtPriceX96After decimal.Decimal `json:"sqrt_price_x96_after"`
+	TickAfter         int             `json:"tick_after"`
+	LiquidityAfter    decimal.Decimal `json:"liquidity_after"`
+	// 穿过的已初始化tick数量, 对应QuoterV2的initializedTicksCrossed
+	InitializedTicksCrossed int `json:"initialized_ticks_crossed"`
+}
+
+// HandleSwap的amountSpecified, 负数表示指定输出. 返回的amount0/amount1以pool的视角表示, 正数为转入pool
+func amountSpecified(exactOutput bool, amount decimal.Decimal) decimal.Decimal {
+	if exactOutput {
+		return amount.Neg()
+	}
+	return amount
+}
+
+func (a *API) Quote(req *QuoteRequest) (*QuoteResponse, error) {
+	if !req.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidRequest)
+	}
+	pool, block, err := a.forkPool(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := quotePool(pool, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	resp.Block = block
+	return resp, nil
+}
+
+// 在pool(fork)上执行swap, 返回swap本身的错误
+func quotePool(pool *CorePool, req *QuoteRequest) (*QuoteResponse, error) {
+	tickBefore := pool.TickCurrent
+	amount0, amount1, price, err := pool.HandleSwap(req.ZeroForOne, amountSpecified(req.ExactOutput, req.Amount), req.SqrtPriceLimitX96, false)
+	if err != nil {
+		return nil, err
+	}
+	resp := &QuoteResponse{
+		Amount0:                 amount0,
+		Amount1:                 amount1,
+		SqrtPriceX96After:       price,
+		TickAfter:               pool.TickCurrent,
+		LiquidityAfter:          pool.Liquidity,
+		InitializedTicksCrossed: pool.TickManager.countInitialized(tickBefore, pool.TickCurrent),
+	}
+	if req.ZeroForOne {
+		resp.AmountIn, resp.AmountOut = amount0, amount1.Neg()
+	} else {
+		resp.AmountIn, resp.AmountOut = amount1, amount0.Neg()
+	}
+	return resp, nil
+}
+
+type SimulateRequest struct {
+	Actions []SimulateAction `json:"actions"`
+}
+
+type SimulateResponse struct {
+	Block    uint64         `json:"block"`
+	Results  []ActionResult `json:"results"`
+	Reverted bool           `json:"reverted"` // 有操作revert, 整个bundle回滚
+	Pools    []*PoolState   `json:"pools"`    // 涉及的pool在bundle之后的状态
+	Diff     *ForkDiff      `json:"diff"`
+}
+
+// 在临时fork上原子地执行一组操作, 不影响Simulator. 涉及的pool在同一同步高度分叉
+func (a *API) Simulate(req *SimulateRequest) (*SimulateResponse, error) {
+	if len(req.Actions) == 0 {
+		return nil, fmt.Errorf("%w: no actions", ErrInvalidRequest)
+	}
+	seen := map[common.Address]bool{}
+	var addresses []common.Address
+	for _, action := range req.Actions {
+		if !seen[action.Pool] {
+			seen[action.Pool] = true
+			addresses = append(addresses, action.Pool)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	fork, block, err := a.simulator.Snapshot(addresses...)
+	if err != nil {
+		return nil, err
+	}
+	// fork.Diff和Simulator当前状态比较, 同步可能已经前进, 所以和分叉时的状态比较
+	base := map[common.Address]*CorePool{}
+	for _, addr := range addresses {
+		base[addr] = fork.Pools[addr].Fork()
+	}
+	bundle, err := fork.ApplyBundle(req.Actions)
+	if err != nil {
+		return nil, err
+	}
+	resp := &SimulateResponse{Block: block, Results: bundle.Results, Reverted: bundle.Reverted, Pools: []*PoolState{}}
+	resp.Diff = &ForkDiff{Pools: []*PoolDiff{}}
+	for _, addr := range addresses {
+		resp.Pools = append(resp.Pools, newPoolState(fork.Pools[addr], block))
+		poolDiff := DiffPools(base[addr], fork.Pools[addr])
+		if !poolDiff.Empty() {
+			resp.Diff.Pools = append(resp.Diff.Pools, poolDiff)
+		}
+	}
+	return resp, nil
+}
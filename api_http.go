@@ -0,0 +1,173 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+const maxRequestBody = 1 << 20
+
+type apiError struct {
+	Error       string `json:"error"`
+	ActionIndex *int   `json:"action_index,omitempty"` // simulate中失败的操作
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logrus.Warnf("failed write api response %s", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	body := apiError{Error: err.Error()}
+	status := http.StatusInternalServerError
+	var simulateErr *SimulateError
+	if errors.As(err, &simulateErr) {
+		body.ActionIndex = &simulateErr.Index
+	}
+	switch {
+	case errors.Is(err, ErrPoolNotFound):
+		status = http.StatusNotFound
+	case simulateErr != nil:
+		// 某个操作无法执行, 响应中带有操作的序号
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, ErrInvalidRequest):
+		status = http.StatusBadRequest
+	}
+	writeAPIJSON(w, status, body)
+}
+
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+func pathAddress(r *http.Request) (common.Address, error) {
+	s := r.PathValue("address")
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("%w: invalid address %q", ErrInvalidRequest, s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+// REST接口:
+//
+//	GET  /block                      当前同步高度
+//	GET  /pools                      所有pool地址
+//	GET  /pools/{address}            slot0/liquidity/feeGrowth
+//	GET  /pools/{address}/ticks      已初始化的tick
+//	GET  /pools/{address}/positions  position, 可用?owner=过滤
+//	POST /quote                      QuoteRequest
+//	POST /simulate                   SimulateRequest, 在临时fork上执行
+//	GET  /metrics                    同步指标
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /block", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, map[string]uint64{"synced_block": a.SyncedBlock()})
+	})
+	mux.HandleFunc("GET /pools", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, a.Pools())
+	})
+	mux.HandleFunc("GET /pools/{address}", func(w http.ResponseWriter, r *http.Request) {
+		addr, err := pathAddress(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		state, err := a.Pool(addr)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, state)
+	})
+	mux.HandleFunc("GET /pools/{address}/ticks", func(w http.ResponseWriter, r *http.Request) {
+		addr, err := pathAddress(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		ticks, err := a.Ticks(addr)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, ticks)
+	})
+	mux.HandleFunc("GET /pools/{address}/positions", func(w http.ResponseWriter, r *http.Request) {
+		addr, err := pathAddress(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		positions, err := a.Positions(addr, r.URL.Query().Get("owner"))
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, positions)
+	})
+	mux.HandleFunc("POST /quote", func(w http.ResponseWriter, r *http.Request) {
+		var req QuoteRequest
+		err := decodeAPIRequest(w, r, &req)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		quote, err := a.Quote(&req)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, quote)
+	})
+	mux.HandleFunc("POST /simulate", func(w http.ResponseWriter, r *http.Request) {
+		var req SimulateRequest
+		err := decodeAPIRequest(w, r, &req)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		result, err := a.Simulate(&req)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, result)
+	})
+	mux.Handle("GET /metrics", a.simulator.MetricsHandler())
+	return mux
+}
+
+// 在addr上提供REST接口, 直到ctx取消
+func (a *API) Serve(ctx context.Context, addr string) error {
+	logrus.Infof("serve api on %s", addr)
+	return serveHTTP(ctx, addr, a.Handler())
+}
+
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAPIServer(t *testing.T) (*httptest.Server, *CorePool) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	pm.Pools[common.HexToAddress(pool.PoolAddress)] = pool
+	pm.currentBlock = 100
+	server := httptest.NewServer(NewAPI(pm).Handler())
+	t.Cleanup(server.Close)
+	return server, pool
+}
+
+func apiRequest(t *testing.T, server *httptest.Server, method, path string, body interface{}, out interface{}) int {
+	var reader bytes.Buffer
+	if body != nil {
+		assert.NoError(t, json.NewEncoder(&reader).Encode(body))
+	}
+	req, err := http.NewRequest(method, server.URL+path, &reader)
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	if out != nil {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestAPI_PoolState(t *testing.T) {
+	server, pool := newTestAPIServer(t)
+
+	var block map[string]uint64
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "GET", "/block", nil, &block))
+	assert.Equal(t, uint64(100), block["synced_block"])
+
+	var state PoolState
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "GET", "/pools/"+pool.PoolAddress, nil, &state))
+	assert.Equal(t, uint64(100), state.Block)
+	assert.True(t, pool.SqrtPriceX96.Equal(state.Slot0.SqrtPriceX96))
+	assert.Equal(t, pool.TickCurrent, state.Slot0.Tick)
+	assert.True(t, pool.Liquidity.Equal(state.Liquidity))
+
+	var ticks TicksResponse
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "GET", "/pools/"+pool.PoolAddress+"/ticks", nil, &ticks))
+	assert.Len(t, ticks.Ticks, 4)
+
+	var positions PositionsResponse
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "GET", "/pools/"+pool.PoolAddress+"/positions?owner=0x1111111111111111111111111111111111111111", nil, &positions))
+	assert.Len(t, positions.Positions, 0)
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "GET", "/pools/"+pool.PoolAddress+"/positions", nil, &positions))
+	assert.Len(t, positions.Positions, 2)
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, server, "GET", "/pools/0x0000000000000000000000000000000000000001", nil, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, server, "GET", "/pools/abc", nil, &apiErr))
+}
+
+func TestAPI_Quote(t *testing.T) {
+	server, pool := newTestAPIServer(t)
+	price := pool.SqrtPriceX96
+
+	var exactIn QuoteResponse
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "POST", "/quote", QuoteRequest{
+		Pool:       common.HexToAddress(pool.PoolAddress),
+		ZeroForOne: true,
+		Amount:     decimal.NewFromInt(1e15),
+	}, &exactIn))
+	assert.True(t, exactIn.AmountIn.Equal(decimal.NewFromInt(1e15)))
+	assert.True(t, exactIn.AmountOut.IsPositive())
+	assert.True(t, exactIn.SqrtPriceX96After.LessThan(price))
+
+	// 用exact in的输出做exact out, 输入不会超过原来的数量
+	var exactOut QuoteResponse
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "POST", "/quote", QuoteRequest{
+		Pool:        common.HexToAddress(pool.PoolAddress),
+		ZeroForOne:  true,
+		ExactOutput: true,
+		Amount:      exactIn.AmountOut,
+	}, &exactOut))
+	assert.True(t, exactOut.AmountOut.Equal(exactIn.AmountOut))
+	assert.True(t, exactOut.AmountIn.LessThanOrEqual(exactIn.AmountIn))
+
+	// 报价不改变状态
+	assert.True(t, pool.SqrtPriceX96.Equal(price))
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, server, "POST", "/quote", QuoteRequest{
+		Pool:   common.HexToAddress(pool.PoolAddress),
+		Amount: decimal.Zero,
+	}, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, server, "POST", "/quote", map[string]string{"unknown": "x"}, &apiErr))
+}
+
+func TestAPI_Simulate(t *testing.T) {
+	server, pool := newTestAPIServer(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	liquidity := pool.Liquidity
+	owner := "0x1111111111111111111111111111111111111111"
+
+	var resp SimulateResponse
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "POST", "/simulate", SimulateRequest{Actions: []SimulateAction{
+		{Type: ActionMint, Pool: addr, Owner: owner, TickLower: -600, TickUpper: 600, Amount: decimal.NewFromInt(1e17)},
+		{Type: ActionSwap, Pool: addr, ZeroForOne: false, Amount: decimal.NewFromInt(1e15)},
+		{Type: ActionBurn, Pool: addr, Owner: owner, TickLower: -600, TickUpper: 600, Amount: decimal.NewFromInt(1e17)},
+		{Type: ActionCollect, Pool: addr, Owner: owner, TickLower: -600, TickUpper: 600},
+	}}, &resp))
+	assert.Equal(t, uint64(100), resp.Block)
+	assert.Len(t, resp.Results, 4)
+	assert.True(t, resp.Results[0].Amount0.IsPositive())
+	assert.True(t, resp.Results[0].Amount1.IsPositive())
+	// 取回的数量包含swap的手续费
+	assert.True(t, resp.Results[3].Amount1.GreaterThan(resp.Results[2].Amount1))
+	assert.Len(t, resp.Pools, 1)
+	assert.Len(t, resp.Diff.Pools, 1)
+	// 模拟不改变Simulator中的pool
+	assert.True(t, pool.Liquidity.Equal(liquidity))
+
+	// burn不存在的position revert, 整个bundle回滚
+	resp = SimulateResponse{}
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "POST", "/simulate", SimulateRequest{Actions: []SimulateAction{
+		{Type: ActionSwap, Pool: addr, ZeroForOne: true, Amount: decimal.NewFromInt(1e15)},
+		{Type: ActionBurn, Pool: addr, Owner: owner, TickLower: -60, TickUpper: 60, Amount: decimal.NewFromInt(1e17)},
+	}}, &resp))
+	assert.True(t, resp.Reverted)
+	assert.Len(t, resp.Results, 2)
+	assert.Equal(t, "LS", resp.Results[1].Revert)
+	assert.Len(t, resp.Diff.Pools, 0)
+
+	var apiErr apiError
+	assert.Equal(t, http.StatusUnprocessableEntity, apiRequest(t, server, "POST", "/simulate", SimulateRequest{Actions: []SimulateAction{
+		{Type: ActionSwap, Pool: addr, Amount: decimal.NewFromInt(1e15)},
+		{Type: "transfer", Pool: addr},
+	}}, &apiErr))
+	assert.NotNil(t, apiErr.ActionIndex)
+	assert.Equal(t, 1, *apiErr.ActionIndex)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, server, "POST", "/simulate", SimulateRequest{Actions: []SimulateAction{
+		{Type: ActionSwap, Pool: common.HexToAddress("0x01"), Amount: decimal.NewFromInt(1)},
+	}}, &apiErr))
+}
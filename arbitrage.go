@@ -0,0 +1,332 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultArbitrageMaxHops = 3
+
+// 循环中的一次swap, 数量都为正数
+type ArbitrageHop struct {
+	Pool       common.Address  `json:"pool"`
+	TokenIn    common.Address  `json:"token_in"`
+	TokenOut   common.Address  `json:"token_out"`
+	ZeroForOne bool            `json:"zero_for_one"`
+	AmountIn   decimal.Decimal `json:"amount_in"`
+	AmountOut  decimal.Decimal `json:"amount_out"`
+}
+
+// 从Token出发经过不同的pool回到Token, 利润以Token计, 不含gas
+type ArbitrageOpportunity struct {
+	Block    uint64          `json:"block"`
+	Token    common.Address  `json:"token"`
+	AmountIn decimal.Decimal `json:"amount_in"`
+	Profit   decimal.Decimal `json:"profit"`
+	Hops     []ArbitrageHop  `json:"hops"`
+}
+
+type arbitrageHopRef struct {
+	pool       common.Address
+	tokenIn    common.Address
+	tokenOut   common.Address
+	zeroForOne bool
+}
+
+// 每个pool最多经过一次, 所以各hop的静态swap互不影响
+type arbitrageCycle struct {
+	hops []arbitrageHopRef
+}
+
+// 所有不超过maxHops的循环. 起点为循环中地址最小的token, 同一组pool的两个方向是不同的循环
+func findArbitrageCycles(pools map[common.Address]*CorePool, maxHops int) []*arbitrageCycle {
+	edges := map[common.Address][]arbitrageHopRef{}
+	addrs := make([]common.Address, 0, len(pools))
+	for addr := range pools {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0
+	})
+	for _, addr := range addrs {
+		pool := pools[addr]
+		token0, token1 := common.HexToAddress(pool.Token0), common.HexToAddress(pool.Token1)
+		edges[token0] = append(edges[token0], arbitrageHopRef{pool: addr, tokenIn: token0, tokenOut: token1, zeroForOne: true})
+		edges[token1] = append(edges[token1], arbitrageHopRef{pool: addr, tokenIn: token1, tokenOut: token0, zeroForOne: false})
+	}
+	tokens := make([]common.Address, 0, len(edges))
+	for token := range edges {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return bytes.Compare(tokens[i].Bytes(), tokens[j].Bytes()) < 0
+	})
+
+	var cycles []*arbitrageCycle
+	var path []arbitrageHopRef
+	used := map[common.Address]bool{}
+	var walk func(start, token common.Address)
+	walk = func(start, token common.Address) {
+		for _, hop := range edges[token] {
+			if used[hop.pool] {
+				continue
+			}
+			if hop.tokenOut == start {
+				cycles = append(cycles, &arbitrageCycle{hops: append(append([]arbitrageHopRef{}, path...), hop)})
+				continue
+			}
+			// 只经过比起点大的token, 每个循环只从最小的token出发
+			if len(path)+2 > maxHops || bytes.Compare(hop.tokenOut.Bytes(), start.Bytes()) < 0 {
+				continue
+			}
+			used[hop.pool] = true
+			path = append(path, hop)
+			walk(start, hop.tokenOut)
+			path = path[:len(path)-1]
+			used[hop.pool] = false
+		}
+	}
+	for _, token := range tokens {
+		walk(token, token)
+	}
+	return cycles
+}
+
+// 数量趋于0时经过循环的兑换率, 扣除手续费. 用于跳过没有机会的循环
+func (c *arbitrageCycle) marginalRate(pools map[common.Address]*CorePool) float64 {
+	rate := 1.0
+	for _, hop := range c.hops {
+		pool := pools[hop.pool]
+		if pool.SqrtPriceX96.IsZero() || !pool.Liquidity.IsPositive() {
+			return 0
+		}
+		sqrtPrice := pool.SqrtPriceX96.Div(Q96).InexactFloat64()
+		price := sqrtPrice * sqrtPrice
+		if !hop.zeroForOne {
+			price = 1 / price
+		}
+		rate *= price * (1 - float64(pool.Fee)/1e6)
+	}
+	return rate
+}
+
+// 用静态swap依次执行循环, 不修改pool
+func (c *arbitrageCycle) evaluate(pools map[common.Address]*CorePool, amountIn decimal.Decimal) ([]ArbitrageHop, decimal.Decimal, error) {
+	hops := make([]ArbitrageHop, 0, len(c.hops))
+	amount := amountIn
+	for _, ref := range c.hops {
+		in, out, err := swapAmounts(pools[ref.pool], ref.zeroForOne, amount, true)
+		if err != nil {
+			return nil, ZERO, err
+		}
+		hops = append(hops, ArbitrageHop{Pool: ref.pool, TokenIn: ref.tokenIn, TokenOut: ref.tokenOut, ZeroForOne: ref.zeroForOne, AmountIn: in, AmountOut: out})
+		amount = out
+		if !amount.IsPositive() {
+			break
+		}
+	}
+	// 第一个pool的流动性不足时实际输入少于amountIn
+	return hops, amount.Sub(hops[0].AmountIn), nil
+}
+
+// 利润是输入数量的凹函数: 倍增找到利润开始下降的位置, 再三分搜索最大值. 没有利润时返回nil.
+// 很小的数量受取整影响利润为负, 所以倍增到利润为正之后才比较
+func (c *arbitrageCycle) optimize(pools map[common.Address]*CorePool, block uint64) (*ArbitrageOpportunity, error) {
+	if c.marginalRate(pools) <= 1 {
+		return nil, nil
+	}
+	profit := func(amountIn decimal.Decimal) (decimal.Decimal, error) {
+		_, p, err := c.evaluate(pools, amountIn)
+		return p, err
+	}
+	two := decimal.NewFromInt(2)
+	x := ONE
+	px, err := profit(x)
+	if err != nil {
+		return nil, err
+	}
+	for x.LessThan(MaxUint128) {
+		hops, p, err := c.evaluate(pools, x.Mul(two))
+		if err != nil {
+			return nil, err
+		}
+		if px.IsPositive() && p.LessThan(px) {
+			break
+		}
+		x, px = x.Mul(two), p
+		// 第一个pool已经到达价格限制, 更大的输入没有意义
+		if hops[0].AmountIn.LessThan(x) {
+			break
+		}
+	}
+	// 最大值在[x/2, 2x]
+	lo, hi := x.Div(two).RoundDown(0), decimal.Min(x.Mul(two), MaxUint128)
+	// 区间小于3时三分点不再移动
+	precision := decimal.Max(decimal.NewFromInt(2), hi.Mul(sandwichSearchPrecision).RoundDown(0))
+	for hi.Sub(lo).GreaterThan(precision) {
+		third := hi.Sub(lo).Div(decimal.NewFromInt(3)).RoundDown(0)
+		m1, m2 := lo.Add(third), hi.Sub(third)
+		p1, err := profit(m1)
+		if err != nil {
+			return nil, err
+		}
+		p2, err := profit(m2)
+		if err != nil {
+			return nil, err
+		}
+		if p1.GreaterThan(p2) {
+			hi = m2
+		} else {
+			lo = m1
+		}
+	}
+	best, bestProfit := x, px
+	for _, candidate := range []decimal.Decimal{lo, hi} {
+		p, err := profit(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if p.GreaterThan(bestProfit) {
+			best, bestProfit = candidate, p
+		}
+	}
+	if !bestProfit.IsPositive() {
+		return nil, nil
+	}
+	hops, bestProfit, err := c.evaluate(pools, best)
+	if err != nil {
+		return nil, err
+	}
+	return &ArbitrageOpportunity{
+		Block:    block,
+		Token:    c.hops[0].tokenIn,
+		AmountIn: hops[0].AmountIn,
+		Profit:   bestProfit,
+		Hops:     hops,
+	}, nil
+}
+
+// 按token和利润从大到小排序
+func sortArbitrageOpportunities(opportunities []*ArbitrageOpportunity) {
+	sort.SliceStable(opportunities, func(i, j int) bool {
+		if c := bytes.Compare(opportunities[i].Token.Bytes(), opportunities[j].Token.Bytes()); c != 0 {
+			return c < 0
+		}
+		return opportunities[i].Profit.GreaterThan(opportunities[j].Profit)
+	})
+}
+
+func scanArbitrageCycles(pools map[common.Address]*CorePool, cycles []*arbitrageCycle, block uint64) []*ArbitrageOpportunity {
+	opportunities := []*ArbitrageOpportunity{}
+	for _, cycle := range cycles {
+		opportunity, err := cycle.optimize(pools, block)
+		if err != nil {
+			logrus.Debugf("failed evaluate arbitrage cycle from %s: %s", cycle.hops[0].tokenIn, err)
+			continue
+		}
+		if opportunity != nil {
+			opportunities = append(opportunities, opportunity)
+		}
+	}
+	sortArbitrageOpportunities(opportunities)
+	return opportunities
+}
+
+// 当前同步状态下所有有利润的循环套利, maxHops为0时最多3个pool. 跳过被隔离的pool
+func (pm *Simulator) ScanArbitrage(maxHops int) ([]*ArbitrageOpportunity, uint64, error) {
+	if maxHops <= 0 {
+		maxHops = defaultArbitrageMaxHops
+	}
+	var addrs []common.Address
+	for _, addr := range pm.PoolAddresses() {
+		if pm.Quarantine == nil || !pm.Quarantine.Quarantined(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	fork, block, err := pm.Snapshot(addrs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return scanArbitrageCycles(fork.Pools, findArbitrageCycles(fork.Pools, maxHops), block), block, nil
+}
+
+// 同步时每个区块结束后, 重新计算经过该区块中有变化的pool的循环
+type ArbitrageScanner struct {
+	MaxHops int
+	states  map[common.Address]*CorePool // 每个pool最近一个事件之后的状态
+	cycles  map[common.Address][]*arbitrageCycle
+	block   uint64
+	changed map[common.Address]bool
+}
+
+func NewArbitrageScanner(maxHops int) *ArbitrageScanner {
+	if maxHops <= 0 {
+		maxHops = defaultArbitrageMaxHops
+	}
+	return &ArbitrageScanner{MaxHops: maxHops, states: map[common.Address]*CorePool{}, changed: map[common.Address]bool{}}
+}
+
+// 设置开始时pool的状态, 例如ObserveFromSnapshot得到的fork
+func (s *ArbitrageScanner) Seed(fork *SimulatorFork) {
+	for addr, pool := range fork.Pools {
+		s.states[addr] = pool
+	}
+	s.cycles = nil
+}
+
+// 事件进入新的区块时扫描之前的区块, 返回有利润的机会
+func (s *ArbitrageScanner) Add(event *PoolEvent) []*ArbitrageOpportunity {
+	var found []*ArbitrageOpportunity
+	if event.BlockNum != s.block && len(s.changed) > 0 {
+		found = s.Flush()
+	}
+	s.block = event.BlockNum
+	if _, ok := s.states[event.Pool]; !ok {
+		// 新的pool改变了图
+		s.cycles = nil
+	}
+	s.states[event.Pool] = event.State
+	s.changed[event.Pool] = true
+	return found
+}
+
+func (s *ArbitrageScanner) Flush() []*ArbitrageOpportunity {
+	if s.cycles == nil {
+		s.cycles = map[common.Address][]*arbitrageCycle{}
+		for _, cycle := range findArbitrageCycles(s.states, s.MaxHops) {
+			for _, hop := range cycle.hops {
+				s.cycles[hop.pool] = append(s.cycles[hop.pool], cycle)
+			}
+		}
+	}
+	seen := map[*arbitrageCycle]bool{}
+	var cycles []*arbitrageCycle
+	for addr := range s.changed {
+		for _, cycle := range s.cycles[addr] {
+			if !seen[cycle] {
+				seen[cycle] = true
+				cycles = append(cycles, cycle)
+			}
+		}
+	}
+	s.changed = map[common.Address]bool{}
+	return scanArbitrageCycles(s.states, cycles, s.block)
+}
+
+// 消费ChannelObserver的事件直到channel关闭, 每个区块的机会交给report
+func (s *ArbitrageScanner) Run(events <-chan *PoolEvent, report func(block uint64, opportunities []*ArbitrageOpportunity)) {
+	for event := range events {
+		block := s.block
+		found := s.Add(event)
+		if len(found) > 0 {
+			report(block, found)
+		}
+	}
+	if found := s.Flush(); len(found) > 0 {
+		report(s.block, found)
+	}
+}
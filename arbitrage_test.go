@@ -0,0 +1,116 @@
+package uniswap_v3_simulator
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testToken0 = common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	testToken1 = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+)
+
+func newTestArbitragePool(t *testing.T, addr string, spacing int64, fee FeeAmount, sqrtPriceX96 decimal.Decimal) *CorePool {
+	pool := NewCorePoolFromConfig(addr, *NewPoolConfig(spacing, testToken0, testToken1, fee))
+	assert.NoError(t, pool.Initialize(sqrtPriceX96))
+	_, _, err := pool.Mint("0xc36442b4a4522e871399cd717abdd847ab11fe88", -60000, 60000, decimal.NewFromInt(1e18).Mul(decimal.NewFromInt(100)))
+	assert.NoError(t, err)
+	return pool
+}
+
+func newTestArbitrageSimulator(t *testing.T, priceB decimal.Decimal) (*Simulator, *CorePool, *CorePool) {
+	pm := newTestSimulator(t, "")
+	a := newTestArbitragePool(t, "0x0000000000000000000000000000000000000a03", 60, 3000, Q96)
+	b := newTestArbitragePool(t, "0x0000000000000000000000000000000000000b05", 10, 500, priceB)
+	pm.Pools[common.HexToAddress(a.PoolAddress)] = a
+	pm.Pools[common.HexToAddress(b.PoolAddress)] = b
+	return pm, a, b
+}
+
+func TestFindArbitrageCycles(t *testing.T) {
+	_, a, b := newTestArbitrageSimulator(t, Q96)
+	c := newTestArbitragePool(t, "0x0000000000000000000000000000000000000c01", 10, 100, Q96)
+	pools := map[common.Address]*CorePool{}
+	for _, pool := range []*CorePool{a, b, c} {
+		pools[common.HexToAddress(pool.PoolAddress)] = pool
+	}
+	// 3个pool两两组合, 每组两个方向
+	cycles := findArbitrageCycles(pools, 3)
+	assert.Len(t, cycles, 6)
+	for _, cycle := range cycles {
+		assert.Len(t, cycle.hops, 2)
+		assert.Equal(t, testToken0, cycle.hops[0].tokenIn)
+		assert.NotEqual(t, cycle.hops[0].pool, cycle.hops[1].pool)
+	}
+}
+
+func TestSimulator_ScanArbitrage(t *testing.T) {
+	// b中token0贵2%
+	pm, a, b := newTestArbitrageSimulator(t, Q96.Mul(decimal.NewFromFloat(1.00995)).RoundDown(0))
+	opportunities, _, err := pm.ScanArbitrage(0)
+	assert.NoError(t, err)
+	assert.Len(t, opportunities, 1)
+	opportunity := opportunities[0]
+	assert.Equal(t, testToken0, opportunity.Token)
+	assert.True(t, opportunity.Profit.IsPositive())
+	assert.Len(t, opportunity.Hops, 2)
+	assert.Equal(t, common.HexToAddress(b.PoolAddress), opportunity.Hops[0].Pool)
+	assert.True(t, opportunity.Hops[0].ZeroForOne)
+	assert.Equal(t, common.HexToAddress(a.PoolAddress), opportunity.Hops[1].Pool)
+
+	// 在pool上实际执行得到相同的结果
+	amount0, amount1, _, err := b.Clone().HandleSwap(true, opportunity.AmountIn, nil, false)
+	assert.NoError(t, err)
+	assert.True(t, amount0.Equal(opportunity.AmountIn))
+	out, _, _, err := a.Clone().HandleSwap(false, amount1.Neg(), nil, false)
+	assert.NoError(t, err)
+	assert.True(t, out.Neg().Sub(opportunity.AmountIn).Equal(opportunity.Profit))
+
+	// 更大或更小的输入利润都更低
+	cycle := &arbitrageCycle{hops: []arbitrageHopRef{
+		{pool: opportunity.Hops[0].Pool, tokenIn: testToken0, tokenOut: testToken1, zeroForOne: true},
+		{pool: opportunity.Hops[1].Pool, tokenIn: testToken1, tokenOut: testToken0, zeroForOne: false},
+	}}
+	for _, factor := range []float64{0.9, 1.1} {
+		_, profit, err := cycle.evaluate(pm.Pools, opportunity.AmountIn.Mul(decimal.NewFromFloat(factor)).RoundDown(0))
+		assert.NoError(t, err)
+		assert.True(t, profit.LessThan(opportunity.Profit))
+	}
+}
+
+func TestArbitrageScanner_PerBlock(t *testing.T) {
+	pm, _, b := newTestArbitrageSimulator(t, Q96)
+	opportunities, _, err := pm.ScanArbitrage(2)
+	assert.NoError(t, err)
+	assert.Len(t, opportunities, 0)
+
+	scanner := NewArbitrageScanner(2)
+	observer := NewChannelObserver(16)
+	observer.Blocking = true
+	fork, _, id, err := pm.ObserveFromSnapshot(observer)
+	assert.NoError(t, err)
+	scanner.Seed(fork)
+	reported := map[uint64][]*ArbitrageOpportunity{}
+	done := make(chan struct{})
+	go func() {
+		scanner.Run(observer.C, func(block uint64, found []*ArbitrageOpportunity) {
+			reported[block] = found
+		})
+		close(done)
+	}()
+	// 大额买入token0之后b中token0更贵
+	swap := testSwapLog(t, b, testVictim, false, decimal.NewFromInt(1e18), 40, 0)
+	assert.NoError(t, pm.HandleLogs([]types.Log{swap}))
+	pm.RemoveObserver(id)
+	close(observer.C)
+	<-done
+
+	assert.Len(t, reported, 1)
+	assert.Len(t, reported[40], 1)
+	assert.Equal(t, uint64(40), reported[40][0].Block)
+	assert.Equal(t, common.HexToAddress(b.PoolAddress), reported[40][0].Hops[0].Pool)
+}
@@ -0,0 +1,209 @@
+package uniswap_v3_simulator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+// bundle中的一个操作, 对应一次pool合约调用. swap使用ZeroForOne/ExactOutput/Amount/SqrtPriceLimitX96,
+// mint/burn使用Owner/TickLower/TickUpper和Amount(流动性), collect的请求数量为空时取出全部,
+// flash借出Amount0Requested/Amount1Requested, 归还Paid0/Paid1(为空时为最低手续费)
+type SimulateAction struct {
+	Type              ActionType       `json:"type"`
+	Pool              common.Address   `json:"pool"`
+	ZeroForOne        bool             `json:"zero_for_one,omitempty"`
+	ExactOutput       bool             `json:"exact_output,omitempty"`
+	Amount            decimal.Decimal  `json:"amount"`
+	SqrtPriceLimitX96 *decimal.Decimal `json:"sqrt_price_limit_x96,omitempty"`
+	Owner             string           `json:"owner,omitempty"`
+	TickLower         int              `json:"tick_lower,omitempty"`
+	TickUpper         int              `json:"tick_upper,omitempty"`
+	Amount0Requested  *decimal.Decimal `json:"amount0_requested,omitempty"`
+	Amount1Requested  *decimal.Decimal `json:"amount1_requested,omitempty"`
+	Paid0             *decimal.Decimal `json:"paid0,omitempty"`
+	Paid1             *decimal.Decimal `json:"paid1,omitempty"`
+}
+
+// 与合约调用的返回值相同, flash为实际归还的手续费
+type ActionResult struct {
+	Amount0  decimal.Decimal `json:"amount0"`
+	Amount1  decimal.Decimal `json:"amount1"`
+	Reverted bool            `json:"reverted,omitempty"`
+	Revert   string          `json:"revert,omitempty"` // 合约的revert字符串, 部分require没有字符串
+}
+
+// 第Index个操作不合法, 与revert不同, 整个请求失败
+type SimulateError struct {
+	Index int
+	Err   error
+}
+
+func (e *SimulateError) Error() string {
+	return fmt.Sprintf("action %d: %s", e.Index, e.Err)
+}
+
+func (e *SimulateError) Unwrap() error {
+	return e.Err
+}
+
+type BundleResult struct {
+	// 执行到revert的操作为止
+	Results  []ActionResult
+	Reverted bool
+}
+
+// 模拟器的错误对应的合约revert字符串, 其余的错误(NP/L等)与合约相同
+var revertReasons = map[string]string{
+	"RATIO_MIN":                             "SPL",
+	"RATIO_MAX":                             "SPL",
+	"RATIO_CURRENT":                         "SPL",
+	"tickLower should lower than tickUpper": "TLU",
+	"tickLower should NOT lower than MIN_TICK":   "TLM",
+	"tickUpper should NOT greater than MAX_TICK": "TUM",
+	"Mint amount should greater than 0":          "",
+	"Liquidity Underflow":                        "LS",
+	"L0":                                         "LO",
+	UNDERFLOW.Error():                            "LS",
+	OVERFLOW.Error():                             "LA",
+}
+
+func revertReason(err error) string {
+	if reason, ok := revertReasons[err.Error()]; ok {
+		return reason
+	}
+	return err.Error()
+}
+
+func revert(err error) error {
+	return &RevertError{Reason: revertReason(err)}
+}
+
+// flash的最低手续费, mulDivRoundingUp(amount, fee, 1e6)
+func flashFee(amount decimal.Decimal, fee FeeAmount) decimal.Decimal {
+	return amount.Mul(decimal.NewFromInt(int64(fee))).Div(decimal.NewFromInt(1e6)).RoundUp(0)
+}
+
+// 按合约中require的顺序检查, 失败时返回RevertError. 操作本身不合法时返回ErrInvalidRequest
+func applyAction(pool *CorePool, action *SimulateAction) (ActionResult, error) {
+	var result ActionResult
+	var err error
+	// 未初始化的pool unlocked为false
+	locked := pool.SqrtPriceX96.IsZero()
+	switch action.Type {
+	case ActionSwap:
+		if action.Amount.IsZero() {
+			return result, &RevertError{Reason: "AS"}
+		}
+		if action.Amount.IsNegative() {
+			return result, fmt.Errorf("%w: amount must be positive", ErrInvalidRequest)
+		}
+		if locked {
+			return result, &RevertError{Reason: "LOK"}
+		}
+		result.Amount0, result.Amount1, _, err = pool.HandleSwap(action.ZeroForOne, amountSpecified(action.ExactOutput, action.Amount), action.SqrtPriceLimitX96, false)
+	case ActionMint, ActionBurn:
+		if action.Amount.IsNegative() {
+			return result, fmt.Errorf("%w: amount must not be negative", ErrInvalidRequest)
+		}
+		if locked {
+			return result, &RevertError{Reason: "LOK"}
+		}
+		if action.TickLower%pool.TickSpacing != 0 || action.TickUpper%pool.TickSpacing != 0 {
+			// TickBitmap.flipTick的require没有字符串
+			return result, &RevertError{}
+		}
+		if action.Type == ActionMint {
+			result.Amount0, result.Amount1, err = pool.Mint(action.Owner, action.TickLower, action.TickUpper, action.Amount)
+		} else {
+			result.Amount0, result.Amount1, err = pool.Burn(action.Owner, action.TickLower, action.TickUpper, action.Amount)
+		}
+	case ActionCollect:
+		amount0, amount1 := MaxUint128, MaxUint128
+		if action.Amount0Requested != nil {
+			amount0 = *action.Amount0Requested
+		}
+		if action.Amount1Requested != nil {
+			amount1 = *action.Amount1Requested
+		}
+		if amount0.IsNegative() || amount1.IsNegative() {
+			return result, fmt.Errorf("%w: requested amounts must not be negative", ErrInvalidRequest)
+		}
+		if locked {
+			return result, &RevertError{Reason: "LOK"}
+		}
+		result.Amount0, result.Amount1, err = pool.CollectOwed(action.Owner, action.TickLower, action.TickUpper, amount0, amount1)
+	case ActionFlash:
+		amount0, amount1 := ZERO, ZERO
+		if action.Amount0Requested != nil {
+			amount0 = *action.Amount0Requested
+		}
+		if action.Amount1Requested != nil {
+			amount1 = *action.Amount1Requested
+		}
+		if amount0.IsNegative() || amount1.IsNegative() {
+			return result, fmt.Errorf("%w: flash amounts must not be negative", ErrInvalidRequest)
+		}
+		if locked {
+			return result, &RevertError{Reason: "LOK"}
+		}
+		if !pool.Liquidity.IsPositive() {
+			return result, &RevertError{Reason: "L"}
+		}
+		fee0, fee1 := flashFee(amount0, pool.Fee), flashFee(amount1, pool.Fee)
+		result.Amount0, result.Amount1 = fee0, fee1
+		if action.Paid0 != nil {
+			result.Amount0 = *action.Paid0
+		}
+		if action.Paid1 != nil {
+			result.Amount1 = *action.Paid1
+		}
+		if result.Amount0.LessThan(fee0) {
+			return result, &RevertError{Reason: "F0"}
+		}
+		if result.Amount1.LessThan(fee1) {
+			return result, &RevertError{Reason: "F1"}
+		}
+		err = pool.Flash(result.Amount0, result.Amount1)
+	default:
+		return result, fmt.Errorf("%w: unknown action type %q", ErrInvalidRequest, action.Type)
+	}
+	if err != nil {
+		return result, revert(err)
+	}
+	return result, nil
+}
+
+// 在子fork上按顺序执行actions, 全部成功才写回当前fork; 有操作revert时丢弃子fork,
+// 当前fork保持不变. 子fork即回滚日志: 被修改的pool都是写时复制的分叉
+func (s *SimulatorFork) ApplyBundle(actions []SimulateAction) (*BundleResult, error) {
+	child := s.Fork()
+	result := &BundleResult{Results: []ActionResult{}}
+	for i := range actions {
+		pool, err := child.GetPool(actions[i].Pool)
+		if err != nil {
+			return nil, &SimulateError{Index: i, Err: err}
+		}
+		actionResult, err := applyAction(pool, &actions[i])
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) {
+			actionResult.Reverted = true
+			actionResult.Revert = revertErr.Reason
+			result.Results = append(result.Results, actionResult)
+			result.Reverted = true
+			return result, nil
+		}
+		if err != nil {
+			return nil, &SimulateError{Index: i, Err: err}
+		}
+		result.Results = append(result.Results, actionResult)
+	}
+	for addr, pool := range child.Pools {
+		if pool.Version() != child.baseVersions[addr] {
+			s.Pools[addr] = pool
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package uniswap_v3_simulator
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFork_ApplyBundle(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	fork := NewSimulatorSnapshot(pm)
+	owner := "0x1111111111111111111111111111111111111111"
+
+	result, err := fork.ApplyBundle([]SimulateAction{
+		{Type: ActionMint, Pool: addr, Owner: owner, TickLower: -600, TickUpper: 600, Amount: decimal.NewFromInt(1e17)},
+		{Type: ActionSwap, Pool: addr, Amount: decimal.NewFromInt(1e15)},
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Reverted)
+	assert.Len(t, result.Results, 2)
+	forked, err := fork.GetPool(addr)
+	assert.NoError(t, err)
+	liquidity, price := forked.Liquidity, forked.SqrtPriceX96
+	assert.False(t, liquidity.Equal(pool.Liquidity))
+
+	// 最后一个操作revert, 之前的swap也回滚
+	borrowed, paid := decimal.NewFromInt(1e6), decimal.NewFromInt(2999)
+	result, err = fork.ApplyBundle([]SimulateAction{
+		{Type: ActionSwap, Pool: addr, ZeroForOne: true, Amount: decimal.NewFromInt(1e15)},
+		{Type: ActionFlash, Pool: addr, Amount0Requested: &borrowed, Paid0: &paid},
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Reverted)
+	assert.Len(t, result.Results, 2)
+	assert.Equal(t, "F0", result.Results[1].Revert)
+	forked, err = fork.GetPool(addr)
+	assert.NoError(t, err)
+	assert.True(t, forked.Liquidity.Equal(liquidity))
+	assert.True(t, forked.SqrtPriceX96.Equal(price))
+	assert.Len(t, fork.Diff().Pools, 1)
+
+	_, err = fork.ApplyBundle([]SimulateAction{{Type: ActionSwap, Pool: common.HexToAddress("0x01"), Amount: decimal.NewFromInt(1)}})
+	assert.ErrorIs(t, err, ErrPoolNotFound)
+}
+
+func TestSimulatorFork_ApplyBundleReverts(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	uninitialized := NewCorePoolFromConfig("0x0000000000000000000000000000000000000002", *NewPoolConfig(
+		60, common.HexToAddress(pool.Token0), common.HexToAddress(pool.Token1), FeeAmount(3000),
+	))
+	pm.Pools[common.HexToAddress(uninitialized.PoolAddress)] = uninitialized
+	owner := "0x1111111111111111111111111111111111111111"
+	limit := pool.SqrtPriceX96.Add(decimal.NewFromInt(1))
+
+	cases := []struct {
+		action SimulateAction
+		revert string
+	}{
+		{SimulateAction{Type: ActionSwap, Pool: addr, Amount: decimal.Zero}, "AS"},
+		{SimulateAction{Type: ActionSwap, Pool: addr, ZeroForOne: true, Amount: decimal.NewFromInt(1), SqrtPriceLimitX96: &limit}, "SPL"},
+		{SimulateAction{Type: ActionSwap, Pool: common.HexToAddress(uninitialized.PoolAddress), Amount: decimal.NewFromInt(1)}, "LOK"},
+		{SimulateAction{Type: ActionBurn, Pool: addr, Owner: owner, TickLower: -60, TickUpper: 60, Amount: decimal.NewFromInt(1)}, "LS"},
+		{SimulateAction{Type: ActionMint, Pool: addr, Owner: owner, TickLower: 60, TickUpper: -60, Amount: decimal.NewFromInt(1)}, "TLU"},
+		{SimulateAction{Type: ActionMint, Pool: addr, Owner: owner, TickLower: -61, TickUpper: 60, Amount: decimal.NewFromInt(1)}, ""},
+	}
+	for _, c := range cases {
+		result, err := NewSimulatorSnapshot(pm).ApplyBundle([]SimulateAction{c.action})
+		assert.NoError(t, err)
+		assert.True(t, result.Reverted)
+		assert.Equal(t, c.revert, result.Results[0].Revert)
+	}
+
+	_, err := NewSimulatorSnapshot(pm).ApplyBundle([]SimulateAction{{Type: "transfer", Pool: addr}})
+	var simulateErr *SimulateError
+	assert.ErrorAs(t, err, &simulateErr)
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestSimulatorFork_ApplyBundleCollect(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	owner := "0x1111111111111111111111111111111111111111"
+
+	// 和链上一样不检查tick, 不存在的position取回0, pool不变
+	fork := NewSimulatorSnapshot(pm)
+	result, err := fork.ApplyBundle([]SimulateAction{
+		{Type: ActionCollect, Pool: addr, Owner: owner, TickLower: 60, TickUpper: -60},
+		{Type: ActionCollect, Pool: addr, Owner: owner, TickLower: -600, TickUpper: 600},
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Reverted)
+	for _, r := range result.Results {
+		assert.True(t, r.Amount0.IsZero())
+		assert.True(t, r.Amount1.IsZero())
+	}
+	assert.Len(t, fork.Diff().Pools, 0)
+}
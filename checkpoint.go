@@ -0,0 +1,176 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const defaultConfirmations = 12
+
+// Run模式下一个未确认区块应用之前的状态, reorg时用来回滚
+type blockCheckpoint struct {
+	block uint64
+	hash  common.Hash
+	pools map[common.Address]*CorePool // 区块中有日志的pool在区块之前的fork, nil表示之前不存在
+}
+
+// 按区块应用日志, 每个区块之前分叉其中的pool. 调用方持有lock, 出错时调用方丢弃内存状态
+func (pm *Simulator) applyBlocks(logs []types.Log) error {
+	for len(logs) > 0 {
+		n := 1
+		for n < len(logs) && logs[n].BlockNumber == logs[0].BlockNumber {
+			n++
+		}
+		checkpoint := &blockCheckpoint{block: logs[0].BlockNumber, hash: logs[0].BlockHash, pools: map[common.Address]*CorePool{}}
+		for _, log := range logs[:n] {
+			if _, ok := checkpoint.pools[log.Address]; ok {
+				continue
+			}
+			var pool *CorePool
+			if current, ok := pm.Pools[log.Address]; ok {
+				pool = current.Fork()
+			}
+			checkpoint.pools[log.Address] = pool
+		}
+		pm.checkpoints = append(pm.checkpoints, checkpoint)
+		err := pm.applyLogs(logs[:n])
+		if err != nil {
+			return err
+		}
+		pm.currentBlock = checkpoint.block
+		logs = logs[n:]
+	}
+	return nil
+}
+
+// 丢弃block(含)之前的检查点, 这些区块已经确认. 调用方持有lock
+func (pm *Simulator) pruneCheckpoints(block uint64) {
+	i := 0
+	for i < len(pm.checkpoints) && pm.checkpoints[i].block <= block {
+		i++
+	}
+	pm.checkpoints = pm.checkpoints[i:]
+}
+
+// 未确认区块中变更过的pool在最早的这种区块之前的状态, nil表示pool在未确认区块中创建
+func (pm *Simulator) unconfirmedStates() map[common.Address]*CorePool {
+	states := map[common.Address]*CorePool{}
+	for _, checkpoint := range pm.checkpoints {
+		for addr, pool := range checkpoint.pools {
+			if _, ok := states[addr]; !ok {
+				states[addr] = pool
+			}
+		}
+	}
+	return states
+}
+
+// 落地pool在已确认区块的状态, 在未确认区块中创建的pool之后再写入
+func flushPoolAt(tx *gorm.DB, pool *CorePool, unconfirmed map[common.Address]*CorePool) error {
+	state, ok := unconfirmed[common.HexToAddress(pool.PoolAddress)]
+	if !ok {
+		return pool.Flush(tx)
+	}
+	if state == nil {
+		return nil
+	}
+	// fork不带数据库记录, 沿用当前pool的记录, 写入后同步回去
+	state.Model = pool.Model
+	state.HasCreated = pool.HasCreated
+	err := state.Flush(tx)
+	pool.Model = state.Model
+	pool.HasCreated = state.HasCreated
+	return err
+}
+
+// 回滚block(含)之后的区块, 从block重新同步. 调用方持有lock.
+// 已经落地的区块不能回滚, 此时回到数据库中的状态并返回ErrChainReorg
+func (pm *Simulator) rewind(block uint64) error {
+	committed, err := pm.CommittedBlockNum()
+	if err != nil {
+		return err
+	}
+	if block <= committed {
+		if reloadErr := pm.reloadCommittedState(); reloadErr != nil {
+			logrus.Errorf("failed reload committed state %s", reloadErr)
+		}
+		return fmt.Errorf("%w: block %d is already committed at %d", ErrChainReorg, block, committed)
+	}
+	for len(pm.checkpoints) > 0 {
+		checkpoint := pm.checkpoints[len(pm.checkpoints)-1]
+		if checkpoint.block < block {
+			break
+		}
+		for addr, pool := range checkpoint.pools {
+			pm.restorePool(addr, pool)
+		}
+		pm.checkpoints = pm.checkpoints[:len(pm.checkpoints)-1]
+	}
+	records := pm.pendingRecords[:0]
+	for _, record := range pm.pendingRecords {
+		if record.BlockNum < block {
+			records = append(records, record)
+		}
+	}
+	pm.pendingRecords = records
+	if block-1 < pm.currentBlock {
+		logrus.Warnf("chain reorg at block %d, rewind from %d", block, pm.currentBlock)
+		pm.currentBlock = block - 1
+	}
+	return nil
+}
+
+func (pm *Simulator) restorePool(addr common.Address, pool *CorePool) {
+	current, ok := pm.Pools[addr]
+	if ok {
+		delete(pm.dirtyPools, current.PoolAddress)
+	}
+	if pool == nil {
+		delete(pm.Pools, addr)
+		return
+	}
+	if ok {
+		pool.Model = current.Model
+		pool.HasCreated = current.HasCreated
+	}
+	pm.Pools[addr] = pool
+	pm.dirtyPools[pool.PoolAddress] = pool
+}
+
+// 轮询时按顺序检查未落地区块的hash, 回滚第一个不在链上的区块及之后的区块. 新链上的区块可能已经
+// 接在旧区块之后应用, 所以最新的区块一致时更早的区块也要检查. 调用方持有syncLock
+func (pm *Simulator) checkReorg(ctx context.Context) error {
+	pm.lock.RLock()
+	checkpoints := append([]*blockCheckpoint{}, pm.checkpoints...)
+	pm.lock.RUnlock()
+	for i, checkpoint := range checkpoints {
+		header, err := pm.rpc.HeaderByNumber(ctx, new(big.Int).SetUint64(checkpoint.block))
+		if err != nil {
+			return err
+		}
+		if header.Hash() == checkpoint.hash {
+			continue
+		}
+		// 分叉点在上一个仍在链上的区块之后, 没有时回到已落地的区块
+		var removed uint64
+		if i > 0 {
+			removed = checkpoints[i-1].block + 1
+		} else {
+			committed, err := pm.CommittedBlockNum()
+			if err != nil {
+				return err
+			}
+			removed = committed + 1
+		}
+		pm.lock.Lock()
+		defer pm.lock.Unlock()
+		return pm.rewind(removed)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package uniswap_v3_simulator
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// 写时复制的标记. forks是owner被Fork的次数, 节点的gen与它相同时才能原地修改,
+// 所以Fork只需要原子地增加计数, 不修改map本身, 可以和读并发
+type cowOwner struct {
+	forks atomic.Uint64
+}
+
+type cowNode[K cmp.Ordered, V any] struct {
+	key      K
+	value    V
+	priority uint32
+	left     *cowNode[K, V]
+	right    *cowNode[K, V]
+	owner    *cowOwner
+	gen      uint64 // 创建节点时owner.forks的值
+}
+
+// 持久化有序map(treap). 节点属于当前owner时原地修改, 否则沿路径复制,
+// 复制节点时同时用clone复制value, 所以owner相同的节点的value也只属于这个map.
+// Fork后新旧两个map共享所有节点, 各自写入时只复制被修改的路径.
+type cowMap[K cmp.Ordered, V any] struct {
+	root  *cowNode[K, V]
+	size  int
+	owner *cowOwner
+	clone func(V) V
+}
+
+func newCowMap[K cmp.Ordered, V any](clone func(V) V) *cowMap[K, V] {
+	return &cowMap[K, V]{owner: &cowOwner{}, clone: clone}
+}
+
+// O(1), 调用后原map和返回的map都不能再原地修改共享的节点.
+// 可以和其它Fork及读操作并发, 不能和写并发
+func (m *cowMap[K, V]) Fork() *cowMap[K, V] {
+	m.owner.forks.Add(1)
+	return &cowMap[K, V]{root: m.root, size: m.size, owner: &cowOwner{}, clone: m.clone}
+}
+
+func (m *cowMap[K, V]) gen() uint64 {
+	return m.owner.forks.Load()
+}
+
+func (m *cowMap[K, V]) Len() int {
+	return m.size
+}
+
+func (m *cowMap[K, V]) writable(n *cowNode[K, V]) *cowNode[K, V] {
+	gen := m.gen()
+	if n.owner == m.owner && n.gen == gen {
+		return n
+	}
+	return &cowNode[K, V]{
+		key:      n.key,
+		value:    m.clone(n.value),
+		priority: n.priority,
+		left:     n.left,
+		right:    n.right,
+		owner:    m.owner,
+		gen:      gen,
+	}
+}
+
+func (m *cowMap[K, V]) Get(key K) (V, bool) {
+	n := m.root
+	for n != nil {
+		c := cmp.Compare(key, n.key)
+		if c == 0 {
+			return n.value, true
+		}
+		if c < 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// 返回可以原地修改的value, 不存在时返回false
+func (m *cowMap[K, V]) GetMut(key K) (V, bool) {
+	// 只在确认key存在时复制路径
+	if !m.contains(m.root, key) {
+		var zero V
+		return zero, false
+	}
+	var found *cowNode[K, V]
+	m.root = m.getMut(m.root, key, &found)
+	return found.value, true
+}
+
+func (m *cowMap[K, V]) getMut(n *cowNode[K, V], key K, found **cowNode[K, V]) *cowNode[K, V] {
+	n = m.writable(n)
+	c := cmp.Compare(key, n.key)
+	if c == 0 {
+		*found = n
+	} else if c < 0 {
+		n.left = m.getMut(n.left, key, found)
+	} else {
+		n.right = m.getMut(n.right, key, found)
+	}
+	return n
+}
+
+func (m *cowMap[K, V]) contains(n *cowNode[K, V], key K) bool {
+	for n != nil {
+		c := cmp.Compare(key, n.key)
+		if c == 0 {
+			return true
+		}
+		if c < 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return false
+}
+
+func (m *cowMap[K, V]) Set(key K, value V) {
+	m.root = m.insert(m.root, key, value)
+}
+
+func (m *cowMap[K, V]) insert(n *cowNode[K, V], key K, value V) *cowNode[K, V] {
+	if n == nil {
+		m.size++
+		return &cowNode[K, V]{key: key, value: value, priority: rand.Uint32(), owner: m.owner, gen: m.gen()}
+	}
+	n = m.writable(n)
+	c := cmp.Compare(key, n.key)
+	if c == 0 {
+		n.value = value
+		return n
+	}
+	if c < 0 {
+		n.left = m.insert(n.left, key, value)
+		if n.left.priority > n.priority {
+			// n.left由insert返回, 已经属于当前owner
+			l := n.left
+			n.left = l.right
+			l.right = n
+			return l
+		}
+	} else {
+		n.right = m.insert(n.right, key, value)
+		if n.right.priority > n.priority {
+			r := n.right
+			n.right = r.left
+			r.left = n
+			return r
+		}
+	}
+	return n
+}
+
+func (m *cowMap[K, V]) Delete(key K) {
+	if m.contains(m.root, key) {
+		m.root = m.delete(m.root, key)
+		m.size--
+	}
+}
+
+func (m *cowMap[K, V]) delete(n *cowNode[K, V], key K) *cowNode[K, V] {
+	c := cmp.Compare(key, n.key)
+	if c == 0 {
+		return m.merge(n.left, n.right)
+	}
+	n = m.writable(n)
+	if c < 0 {
+		n.left = m.delete(n.left, key)
+	} else {
+		n.right = m.delete(n.right, key)
+	}
+	return n
+}
+
+func (m *cowMap[K, V]) merge(a, b *cowNode[K, V]) *cowNode[K, V] {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a = m.writable(a)
+		a.right = m.merge(a.right, b)
+		return a
+	}
+	b = m.writable(b)
+	b.left = m.merge(a, b.left)
+	return b
+}
+
+func (m *cowMap[K, V]) Min() (K, V, bool) {
+	n := m.root
+	if n == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	for n.left != nil {
+		n = n.left
+	}
+	return n.key, n.value, true
+}
+
+func (m *cowMap[K, V]) Max() (K, V, bool) {
+	n := m.root
+	if n == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	for n.right != nil {
+		n = n.right
+	}
+	return n.key, n.value, true
+}
+
+// 小于等于key的最大元素
+func (m *cowMap[K, V]) Floor(key K) (K, V, bool) {
+	var best *cowNode[K, V]
+	n := m.root
+	for n != nil {
+		if cmp.Compare(n.key, key) <= 0 {
+			best = n
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	if best == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	return best.key, best.value, true
+}
+
+// 大于key的最小元素
+func (m *cowMap[K, V]) Higher(key K) (K, V, bool) {
+	var best *cowNode[K, V]
+	n := m.root
+	for n != nil {
+		if cmp.Compare(n.key, key) > 0 {
+			best = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	if best == nil {
+		var k K
+		var v V
+		return k, v, false
+	}
+	return best.key, best.value, true
+}
+
+// 按key升序遍历, fn返回false时停止
+func (m *cowMap[K, V]) Ascend(fn func(key K, value V) bool) {
+	ascend(m.root, fn)
+}
+
+func ascend[K cmp.Ordered, V any](n *cowNode[K, V], fn func(key K, value V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if !ascend(n.left, fn) {
+		return false
+	}
+	if !fn(n.key, n.value) {
+		return false
+	}
+	return ascend(n.right, fn)
+}
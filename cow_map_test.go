@@ -0,0 +1,203 @@
+package uniswap_v3_simulator
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCowMap_MatchesBuiltinMap(t *testing.T) {
+	m := newCowMap[int, *Tick]((*Tick).Clone)
+	ref := map[int]int64{}
+	r := rand.New(rand.NewPCG(1, 2))
+	var forks []*cowMap[int, *Tick]
+	var forkRefs []map[int]int64
+	for i := 0; i < 5000; i++ {
+		key := r.IntN(500) - 250
+		switch r.IntN(4) {
+		case 0, 1:
+			m.Set(key, &Tick{TickIndex: key, LiquidityGross: decimal.NewFromInt(int64(i))})
+			ref[key] = int64(i)
+		case 2:
+			m.Delete(key)
+			delete(ref, key)
+		case 3:
+			if tick, ok := m.GetMut(key); ok {
+				tick.LiquidityGross = decimal.NewFromInt(int64(-i))
+				ref[key] = int64(-i)
+			}
+		}
+		if i%500 == 0 {
+			snapshot := map[int]int64{}
+			for k, v := range ref {
+				snapshot[k] = v
+			}
+			forks = append(forks, m.Fork())
+			forkRefs = append(forkRefs, snapshot)
+		}
+	}
+	assertCowMapEqual(t, m, ref)
+	// 父map之后的修改不影响fork
+	for i, fork := range forks {
+		assertCowMapEqual(t, fork, forkRefs[i])
+	}
+}
+
+func assertCowMapEqual(t *testing.T, m *cowMap[int, *Tick], ref map[int]int64) {
+	assert.Equal(t, len(ref), m.Len())
+	prev := MIN_TICK
+	count := 0
+	m.Ascend(func(key int, tick *Tick) bool {
+		assert.Greater(t, key, prev)
+		prev = key
+		assert.Equal(t, ref[key], tick.LiquidityGross.IntPart(), fmt.Sprint(key))
+		count++
+		return true
+	})
+	assert.Equal(t, len(ref), count)
+	for key := range ref {
+		floor, _, ok := m.Floor(key)
+		assert.True(t, ok)
+		assert.Equal(t, key, floor)
+		higher, _, ok := m.Higher(key - 1)
+		assert.True(t, ok)
+		assert.Equal(t, key, higher)
+	}
+}
+
+func TestCowMap_ForkConcurrentWithReads(t *testing.T) {
+	m := newCowMap[int, *Tick]((*Tick).Clone)
+	for i := 0; i < 100; i++ {
+		m.Set(i, &Tick{TickIndex: i, LiquidityGross: decimal.NewFromInt(int64(i))})
+	}
+	owner := m.owner
+	var wg sync.WaitGroup
+	forks := make([]*cowMap[int, *Tick], 8)
+	for i := range forks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			forks[i] = m.Fork()
+			_, ok := m.Get(i)
+			assert.True(t, ok)
+		}(i)
+	}
+	wg.Wait()
+	// Fork不替换原map的owner, 之后的写仍然复制共享的节点
+	assert.Same(t, owner, m.owner)
+	tick, ok := m.GetMut(3)
+	assert.True(t, ok)
+	tick.LiquidityGross = decimal.NewFromInt(-3)
+	for _, fork := range forks {
+		forked, _ := fork.Get(3)
+		assert.Equal(t, int64(3), forked.LiquidityGross.IntPart())
+	}
+}
+
+func TestCorePool_ForkIsolation(t *testing.T) {
+	pool := newTestPool(t)
+	before, err := NewPoolExport(pool)
+	assert.NoError(t, err)
+
+	fork := pool.Fork()
+	_, _, err = fork.Mint("0x2222222222222222222222222222222222222222", -1200, 1200, decimal.NewFromInt(1e18))
+	assert.NoError(t, err)
+	_, _, _, err = fork.HandleSwap(true, decimal.NewFromInt(1e17), nil, false)
+	assert.NoError(t, err)
+	_, _, err = fork.Burn("0xc36442b4a4522e871399cd717abdd847ab11fe88", -120, 120, decimal.NewFromInt(1e18))
+	assert.NoError(t, err)
+
+	after, err := NewPoolExport(pool)
+	assert.NoError(t, err)
+	after.ExportedAt = before.ExportedAt
+	assert.Equal(t, before, after)
+
+	// 父pool的修改也不影响fork
+	forkState, err := NewPoolExport(fork)
+	assert.NoError(t, err)
+	_, _, _, err = pool.HandleSwap(false, decimal.NewFromInt(1e17), nil, false)
+	assert.NoError(t, err)
+	forkAfter, err := NewPoolExport(fork)
+	assert.NoError(t, err)
+	forkAfter.ExportedAt = forkState.ExportedAt
+	assert.Equal(t, forkState, forkAfter)
+}
+
+func TestCorePool_DeprecatedAccessors(t *testing.T) {
+	pool := newTestPool(t)
+	sorted := pool.TickManager.SortedTicks()
+	assert.Len(t, sorted, pool.TickManager.Len())
+	ticks := pool.TickManager.Ticks()
+	assert.Len(t, ticks, len(sorted))
+	for i, tick := range sorted {
+		assert.Equal(t, tick, ticks[tick.TickIndex])
+		if i > 0 {
+			assert.Less(t, sorted[i-1].TickIndex, tick.TickIndex)
+		}
+	}
+	positions := pool.PositionManager.Positions()
+	assert.Len(t, positions, pool.PositionManager.Len())
+
+	// 返回的是拷贝, 修改不影响pool
+	sorted[0].LiquidityGross = ZERO
+	tick, err := pool.TickManager.GetTickReadonly(sorted[0].TickIndex)
+	assert.NoError(t, err)
+	assert.True(t, tick.LiquidityGross.IsPositive())
+}
+
+func newBenchmarkPool(b *testing.B, positions int) *CorePool {
+	pool := NewCorePoolFromConfig("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640", *NewPoolConfig(10, [20]byte{1}, [20]byte{2}, FeeAmount(500)))
+	if err := pool.Initialize(Q96); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < positions; i++ {
+		owner := fmt.Sprintf("0x%040x", i)
+		_, _, err := pool.Mint(owner, -10*(i+1), 10*(i+1), decimal.NewFromInt(1e15))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return pool
+}
+
+func BenchmarkCorePool_Clone(b *testing.B) {
+	pool := newBenchmarkPool(b, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool.Clone()
+	}
+}
+
+func BenchmarkCorePool_Fork(b *testing.B) {
+	pool := newBenchmarkPool(b, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool.Fork()
+	}
+}
+
+func BenchmarkCorePool_CloneAndSwap(b *testing.B) {
+	pool := newBenchmarkPool(b, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clone := pool.Clone()
+		if _, _, _, err := clone.HandleSwap(true, decimal.NewFromInt(1e15), nil, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCorePool_ForkAndSwap(b *testing.B) {
+	pool := newBenchmarkPool(b, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fork := pool.Fork()
+		if _, _, _, err := fork.HandleSwap(true, decimal.NewFromInt(1e15), nil, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package uniswap_v3_simulator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyncBlocks每flush 10批时复制一份的数据库文件
+type DBSnapshot struct {
+	Path     string    `json:"path"`
+	BlockNum uint64    `json:"block_num"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+}
+
+func dbSnapshotPath(dbFile string, blockNum uint64) string {
+	return fmt.Sprintf("%s.snapshot-%d", dbFile, blockNum)
+}
+
+// 数据库文件旁的所有快照, 按区块排序
+func ListDBSnapshots(dbFile string) ([]DBSnapshot, error) {
+	prefix := filepath.Base(dbFile) + ".snapshot-"
+	entries, err := os.ReadDir(filepath.Dir(dbFile))
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []DBSnapshot{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		blockNum, err := strconv.ParseUint(strings.TrimPrefix(entry.Name(), prefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, DBSnapshot{
+			Path:     filepath.Join(filepath.Dir(dbFile), entry.Name()),
+			BlockNum: blockNum,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].BlockNum < snapshots[j].BlockNum
+	})
+	return snapshots, nil
+}
+
+// 用blockNum的快照替换数据库文件, 调用时不能有Simulator打开这个数据库
+func RestoreDBSnapshot(dbFile string, blockNum uint64) error {
+	src, err := os.Open(dbSnapshotPath(dbFile, blockNum))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := dbFile + ".restore"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// 旧数据库的日志文件不能留给快照使用
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		err = os.Remove(dbFile + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmp, dbFile)
+}
@@ -0,0 +1,36 @@
+package uniswap_v3_simulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBSnapshot_ListAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "simulator.db")
+	assert.NoError(t, os.WriteFile(dbFile, []byte("current"), 0644))
+	assert.NoError(t, os.WriteFile(dbFile+"-wal", []byte("wal"), 0644))
+	assert.NoError(t, os.WriteFile(dbSnapshotPath(dbFile, 200), []byte("at 200"), 0644))
+	assert.NoError(t, os.WriteFile(dbSnapshotPath(dbFile, 100), []byte("at 100"), 0644))
+	// 其它数据库的快照和无法解析的文件名不算
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "other.db.snapshot-50"), nil, 0644))
+	assert.NoError(t, os.WriteFile(dbFile+".snapshot-tmp", nil, 0644))
+
+	snapshots, err := ListDBSnapshots(dbFile)
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, uint64(100), snapshots[0].BlockNum)
+	assert.Equal(t, uint64(200), snapshots[1].BlockNum)
+	assert.Equal(t, int64(6), snapshots[1].Size)
+
+	assert.NoError(t, RestoreDBSnapshot(dbFile, 100))
+	data, err := os.ReadFile(dbFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "at 100", string(data))
+	_, err = os.Stat(dbFile + "-wal")
+	assert.True(t, os.IsNotExist(err))
+	assert.Error(t, RestoreDBSnapshot(dbFile, 300))
+}
@@ -0,0 +1,340 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// mainnet的部署地址
+var (
+	UniswapV3FactoryAddress = common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984")
+	QuoterV2Address         = common.HexToAddress("0x61fFE014bA17989E743c5F6cB21bF9697530B21e")
+	poolInitCodeHash        = common.FromHex("0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54")
+)
+
+const quoterV2ABI = `[
+{"inputs":[{"components":[{"internalType":"address","name":"tokenIn","type":"address"},{"internalType":"address","name":"tokenOut","type":"address"},{"internalType":"uint256","name":"amountIn","type":"uint256"},{"internalType":"uint24","name":"fee","type":"uint24"},{"internalType":"uint160","name":"sqrtPriceLimitX96","type":"uint160"}],"internalType":"struct IQuoterV2.QuoteExactInputSingleParams","name":"params","type":"tuple"}],"name":"quoteExactInputSingle","outputs":[{"internalType":"uint256","name":"amountOut","type":"uint256"},{"internalType":"uint160","name":"sqrtPriceX96After","type":"uint160"},{"internalType":"uint32","name":"initializedTicksCrossed","type":"uint32"},{"internalType":"uint256","name":"gasEstimate","type":"uint256"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"components":[{"internalType":"address","name":"tokenIn","type":"address"},{"internalType":"address","name":"tokenOut","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"},{"internalType":"uint24","name":"fee","type":"uint24"},{"internalType":"uint160","name":"sqrtPriceLimitX96","type":"uint160"}],"internalType":"struct IQuoterV2.QuoteExactOutputSingleParams","name":"params","type":"tuple"}],"name":"quoteExactOutputSingle","outputs":[{"internalType":"uint256","name":"amountIn","type":"uint256"},{"internalType":"uint160","name":"sqrtPriceX96After","type":"uint160"},{"internalType":"uint32","name":"initializedTicksCrossed","type":"uint32"},{"internalType":"uint256","name":"gasEstimate","type":"uint256"}],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var quoterABI = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(quoterV2ABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// 与PoolAddress.computeAddress相同, 用CREATE2计算pool地址
+func ComputePoolAddress(factory, tokenA, tokenB common.Address, fee FeeAmount) common.Address {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) > 0 {
+		tokenA, tokenB = tokenB, tokenA
+	}
+	salt := crypto.Keccak256Hash(
+		common.LeftPadBytes(tokenA.Bytes(), 32),
+		common.LeftPadBytes(tokenB.Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(int64(fee)).Bytes(), 32),
+	)
+	return crypto.CreateAddress2(factory, salt, poolInitCodeHash)
+}
+
+// 链上positions(bytes32)的key: keccak256(abi.encodePacked(owner, tickLower, tickUpper))
+func positionKeyHash(owner common.Address, tickLower, tickUpper int) common.Hash {
+	int24 := func(v int) []byte {
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+	return crypto.Keccak256Hash(owner.Bytes(), int24(tickLower), int24(tickUpper))
+}
+
+// 和节点一样的execution reverted错误, 客户端可以从data中解析出revert原因
+type RevertError struct {
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+func (e *RevertError) ErrorCode() int {
+	return 3
+}
+
+func (e *RevertError) ErrorData() interface{} {
+	if e.Reason == "" {
+		return nil
+	}
+	stringType, _ := abi.NewType("string", "", nil)
+	data, _ := abi.Arguments{{Type: stringType}}.Pack(e.Reason)
+	// Error(string)
+	return hexutil.Encode(append(common.FromHex("0x08c379a0"), data...))
+}
+
+// 用同步的pool状态回答eth_call, 支持pool的view函数和QuoterV2的单池报价.
+// 只有最新的同步高度可用, 其它区块返回错误
+type EthCall struct {
+	api     *API
+	Factory common.Address // 计算Quoter参数对应的pool
+	Quoter  common.Address
+	ChainID uint64
+}
+
+func NewEthCall(api *API) *EthCall {
+	return &EthCall{api: api, Factory: UniswapV3FactoryAddress, Quoter: QuoterV2Address, ChainID: 1}
+}
+
+func checkCallBlock(requested *rpc.BlockNumberOrHash, synced uint64) error {
+	if requested == nil {
+		return nil
+	}
+	if _, ok := requested.Hash(); ok {
+		return errors.New("block hash is not supported")
+	}
+	number, _ := requested.Number()
+	if number >= 0 && uint64(number) != synced {
+		return fmt.Errorf("state of block %d is not available, synced block %d", number, synced)
+	}
+	return nil
+}
+
+// 在synced pool上执行一次调用, 返回ABI编码的结果
+func (e *EthCall) Call(to common.Address, data []byte, block *rpc.BlockNumberOrHash) ([]byte, error) {
+	if to == e.Quoter {
+		return e.callQuoter(data, block)
+	}
+	pool, synced, err := e.api.forkPool(to)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCallBlock(block, synced)
+	if err != nil {
+		return nil, err
+	}
+	return callPool(pool, data)
+}
+
+func unpackCall(a *abi.ABI, data []byte) (*abi.Method, []interface{}, error) {
+	if len(data) < 4 {
+		return nil, nil, &RevertError{}
+	}
+	method, err := a.MethodById(data[:4])
+	if err != nil {
+		return nil, nil, &RevertError{}
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, nil, &RevertError{}
+	}
+	return method, args, nil
+}
+
+func callPool(pool *CorePool, data []byte) ([]byte, error) {
+	method, args, err := unpackCall(&poolABI, data)
+	if err != nil {
+		return nil, err
+	}
+	switch method.Name {
+	case "slot0":
+		// 不模拟oracle, observation相关的字段为0
+		return method.Outputs.Pack(pool.SqrtPriceX96.BigInt(), big.NewInt(int64(pool.TickCurrent)), uint16(0), uint16(0), uint16(0), uint8(0), true)
+	case "liquidity":
+		return method.Outputs.Pack(pool.Liquidity.BigInt())
+	case "feeGrowthGlobal0X128":
+		return method.Outputs.Pack(pool.FeeGrowthGlobal0X128.BigInt())
+	case "feeGrowthGlobal1X128":
+		return method.Outputs.Pack(pool.FeeGrowthGlobal1X128.BigInt())
+	case "token0":
+		return method.Outputs.Pack(common.HexToAddress(pool.Token0))
+	case "token1":
+		return method.Outputs.Pack(common.HexToAddress(pool.Token1))
+	case "fee":
+		return method.Outputs.Pack(big.NewInt(int64(pool.Fee)))
+	case "tickSpacing":
+		return method.Outputs.Pack(big.NewInt(int64(pool.TickSpacing)))
+	case "ticks":
+		index := args[0].(*big.Int)
+		tick, ok := pool.TickManager.getTick(int(index.Int64()))
+		if !ok {
+			return method.Outputs.Pack(new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int), uint32(0), false)
+		}
+		return method.Outputs.Pack(tick.LiquidityGross.BigInt(), tick.LiquidityNet.BigInt(), tick.FeeGrowthOutside0X128.BigInt(),
+			tick.FeeGrowthOutside1X128.BigInt(), new(big.Int), new(big.Int), uint32(0), tick.Initialized())
+	case "tickBitmap":
+		return method.Outputs.Pack(pool.tickBitmapWord(int(args[0].(int16))))
+	case "positions":
+		key := common.Hash(args[0].([32]byte))
+		var found *Position
+		pool.PositionManager.Ascend(func(k string, position *Position) bool {
+			owner, tickLower, tickUpper, err := ParsePositionKey(k)
+			if err == nil && positionKeyHash(common.HexToAddress(owner), tickLower, tickUpper) == key {
+				found = position
+				return false
+			}
+			return true
+		})
+		if found == nil {
+			found = NewPosition()
+		}
+		return method.Outputs.Pack(found.Liquidity.BigInt(), found.FeeGrowthInside0LastX128.BigInt(), found.FeeGrowthInside1LastX128.BigInt(),
+			found.TokensOwed0.BigInt(), found.TokensOwed1.BigInt())
+	}
+	return nil, fmt.Errorf("%s is not supported by the simulator", method.Sig)
+}
+
+// tickBitmap中wordPos对应的256位, 由已初始化的tick计算
+func (p *CorePool) tickBitmapWord(wordPos int) *big.Int {
+	word := new(big.Int)
+	spacing := p.TickSpacing
+	// word覆盖的tick范围[wordPos*256*spacing, (wordPos+1)*256*spacing)
+	index := wordPos*256*spacing - 1
+	for {
+		next, _, ok := p.TickManager.ticks.Higher(index)
+		if !ok || next >= (wordPos+1)*256*spacing {
+			return word
+		}
+		compressed := next / spacing
+		if next < 0 && next%spacing != 0 {
+			compressed--
+		}
+		word.SetBit(word, compressed&0xff, 1)
+		index = next
+	}
+}
+
+type quoteExactInputSingleParams struct {
+	TokenIn           common.Address
+	TokenOut          common.Address
+	AmountIn          *big.Int
+	Fee               *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+type quoteExactOutputSingleParams struct {
+	TokenIn           common.Address
+	TokenOut          common.Address
+	Amount            *big.Int
+	Fee               *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+func (e *EthCall) callQuoter(data []byte, block *rpc.BlockNumberOrHash) ([]byte, error) {
+	method, args, err := unpackCall(&quoterABI, data)
+	if err != nil {
+		return nil, err
+	}
+	var tokenIn, tokenOut common.Address
+	var amount, fee, limit *big.Int
+	exactOutput := method.Name == "quoteExactOutputSingle"
+	if exactOutput {
+		params := *abi.ConvertType(args[0], new(quoteExactOutputSingleParams)).(*quoteExactOutputSingleParams)
+		tokenIn, tokenOut, amount, fee, limit = params.TokenIn, params.TokenOut, params.Amount, params.Fee, params.SqrtPriceLimitX96
+	} else {
+		params := *abi.ConvertType(args[0], new(quoteExactInputSingleParams)).(*quoteExactInputSingleParams)
+		tokenIn, tokenOut, amount, fee, limit = params.TokenIn, params.TokenOut, params.AmountIn, params.Fee, params.SqrtPriceLimitX96
+	}
+
+	addr := ComputePoolAddress(e.Factory, tokenIn, tokenOut, FeeAmount(fee.Int64()))
+	pool, synced, err := e.api.forkPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCallBlock(block, synced)
+	if err != nil {
+		return nil, err
+	}
+	req := &QuoteRequest{
+		Pool:        addr,
+		ZeroForOne:  bytes.Compare(tokenIn.Bytes(), tokenOut.Bytes()) < 0,
+		ExactOutput: exactOutput,
+		Amount:      decimal.NewFromBigInt(amount, 0),
+	}
+	if limit.Sign() != 0 {
+		l := decimal.NewFromBigInt(limit, 0)
+		req.SqrtPriceLimitX96 = &l
+	}
+	if req.Amount.IsZero() {
+		return nil, &RevertError{Reason: "AS"}
+	}
+	quote, err := quotePool(pool, req)
+	if err != nil {
+		return nil, revert(err)
+	}
+	// 没有价格限制时必须得到全部输出
+	if exactOutput && limit.Sign() == 0 && !quote.AmountOut.Equal(req.Amount) {
+		return nil, &RevertError{}
+	}
+	result := quote.AmountOut
+	if exactOutput {
+		result = quote.AmountIn
+	}
+	// 无法估计gas, gasEstimate为0
+	return method.Outputs.Pack(result.BigInt(), quote.SqrtPriceX96After.BigInt(), uint32(quote.InitializedTicksCrossed), new(big.Int))
+}
+
+// eth_call的参数, 其它字段(from/gas/value等)不影响结果
+type CallArgs struct {
+	To    *common.Address `json:"to"`
+	Data  *hexutil.Bytes  `json:"data"`
+	Input *hexutil.Bytes  `json:"input"`
+}
+
+// 注册到rpc server的eth命名空间, 只导出要提供的方法
+type ethNamespace struct {
+	call *EthCall
+}
+
+func (n *ethNamespace) Call(args CallArgs, block *rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if args.To == nil {
+		return nil, errors.New("contract creation is not supported")
+	}
+	var data []byte
+	if args.Input != nil {
+		data = *args.Input
+	} else if args.Data != nil {
+		data = *args.Data
+	}
+	return n.call.Call(*args.To, data, block)
+}
+
+func (n *ethNamespace) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(n.call.api.SyncedBlock())
+}
+
+func (n *ethNamespace) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).SetUint64(n.call.ChainID))
+}
+
+// 提供eth_call/eth_blockNumber/eth_chainId的JSON-RPC server
+func (e *EthCall) RPCServer() (*rpc.Server, error) {
+	server := rpc.NewServer()
+	err := server.RegisterName("eth", &ethNamespace{call: e})
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// 在addr上提供JSON-RPC, 直到ctx取消
+func (e *EthCall) Serve(ctx context.Context, addr string) error {
+	server, err := e.RPCServer()
+	if err != nil {
+		return err
+	}
+	defer server.Stop()
+	logrus.Infof("serve eth_call json-rpc on %s", addr)
+	return serveHTTP(ctx, addr, server)
+}
@@ -0,0 +1,137 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEthClient(t *testing.T) (*ethclient.Client, *CorePool) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	pm.Pools[common.HexToAddress(pool.PoolAddress)] = pool
+	pm.currentBlock = 100
+	server, err := NewEthCall(NewAPI(pm)).RPCServer()
+	assert.NoError(t, err)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	client, err := ethclient.Dial(httpServer.URL)
+	assert.NoError(t, err)
+	return client, pool
+}
+
+func ethCall(t *testing.T, client *ethclient.Client, a *abi.ABI, to common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := a.Pack(method, args...)
+	assert.NoError(t, err)
+	out, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return a.Unpack(method, out)
+}
+
+func TestEthCall_Selectors(t *testing.T) {
+	assert.Equal(t, "1a686502", common.Bytes2Hex(poolABI.Methods["liquidity"].ID))
+	assert.Equal(t, "f30dba93", common.Bytes2Hex(poolABI.Methods["ticks"].ID))
+	assert.Equal(t, "514ea4bf", common.Bytes2Hex(poolABI.Methods["positions"].ID))
+	assert.Equal(t, "c6a5026a", common.Bytes2Hex(quoterABI.Methods["quoteExactInputSingle"].ID))
+	assert.Equal(t, "bd21704a", common.Bytes2Hex(quoterABI.Methods["quoteExactOutputSingle"].ID))
+	// USDC/WETH 0.3%
+	assert.Equal(t, common.HexToAddress("0x8ad599c3A0ff1De082011EFDDc58f1908eb6e6D8"), ComputePoolAddress(UniswapV3FactoryAddress,
+		common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"), common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), 3000))
+}
+
+func TestEthCall_PoolViews(t *testing.T) {
+	client, pool := newTestEthClient(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+
+	block, err := client.BlockNumber(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), block)
+
+	out, err := ethCall(t, client, &poolABI, addr, "slot0")
+	assert.NoError(t, err)
+	assert.Equal(t, pool.SqrtPriceX96.BigInt(), out[0])
+	assert.Equal(t, int64(pool.TickCurrent), out[1].(*big.Int).Int64())
+	out, err = ethCall(t, client, &poolABI, addr, "liquidity")
+	assert.NoError(t, err)
+	assert.Equal(t, pool.Liquidity.BigInt(), out[0])
+	out, err = ethCall(t, client, &poolABI, addr, "feeGrowthGlobal0X128")
+	assert.NoError(t, err)
+	assert.Equal(t, pool.FeeGrowthGlobal0X128.BigInt(), out[0])
+
+	out, err = ethCall(t, client, &poolABI, addr, "ticks", big.NewInt(-120))
+	assert.NoError(t, err)
+	assert.Equal(t, decimal.NewFromInt(1e18).BigInt(), out[0])
+	assert.Equal(t, true, out[7])
+	out, err = ethCall(t, client, &poolABI, addr, "ticks", big.NewInt(-180))
+	assert.NoError(t, err)
+	assert.Equal(t, false, out[7])
+
+	// tick -600/-120/60/120, spacing 60: 压缩后-10/-2在word -1, 1/2在word 0
+	out, err = ethCall(t, client, &poolABI, addr, "tickBitmap", int16(0))
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(0b110), out[0])
+	out, err = ethCall(t, client, &poolABI, addr, "tickBitmap", int16(-1))
+	assert.NoError(t, err)
+	expected := new(big.Int).SetBit(new(big.Int).SetBit(new(big.Int), 254, 1), 246, 1)
+	assert.Equal(t, expected, out[0])
+
+	key := positionKeyHash(common.HexToAddress("0xc36442b4a4522e871399cd717abdd847ab11fe88"), -120, 120)
+	out, err = ethCall(t, client, &poolABI, addr, "positions", key)
+	assert.NoError(t, err)
+	assert.Equal(t, decimal.NewFromInt(1e18).BigInt(), out[0])
+
+	_, err = ethCall(t, client, &poolABI, addr, "observations", big.NewInt(0))
+	assert.Error(t, err)
+	_, err = ethCall(t, client, &poolABI, common.HexToAddress("0x01"), "liquidity")
+	assert.Error(t, err)
+	data, _ := poolABI.Pack("liquidity")
+	_, err = client.CallContract(context.Background(), ethereum.CallMsg{To: &addr, Data: data}, big.NewInt(99))
+	assert.Error(t, err)
+}
+
+func TestEthCall_Quoter(t *testing.T) {
+	client, pool := newTestEthClient(t)
+	token0, token1 := common.HexToAddress(pool.Token0), common.HexToAddress(pool.Token1)
+
+	out, err := ethCall(t, client, &quoterABI, QuoterV2Address, "quoteExactInputSingle", quoteExactInputSingleParams{
+		TokenIn: token1, TokenOut: token0, AmountIn: big.NewInt(1e15), Fee: big.NewInt(3000), SqrtPriceLimitX96: new(big.Int),
+	})
+	assert.NoError(t, err)
+	fork := pool.Clone()
+	amount0, _, price, err := fork.HandleSwap(false, decimal.NewFromInt(1e15), nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, amount0.Neg().BigInt(), out[0])
+	assert.Equal(t, price.BigInt(), out[1])
+	amountOut := out[0].(*big.Int)
+
+	out, err = ethCall(t, client, &quoterABI, QuoterV2Address, "quoteExactOutputSingle", quoteExactOutputSingleParams{
+		TokenIn: token1, TokenOut: token0, Amount: amountOut, Fee: big.NewInt(3000), SqrtPriceLimitX96: new(big.Int),
+	})
+	assert.NoError(t, err)
+	assert.True(t, out[0].(*big.Int).Cmp(big.NewInt(1e15)) <= 0)
+
+	// 价格限制在错误的一侧时revert
+	_, err = ethCall(t, client, &quoterABI, QuoterV2Address, "quoteExactInputSingle", quoteExactInputSingleParams{
+		TokenIn: token0, TokenOut: token1, AmountIn: big.NewInt(1e15), Fee: big.NewInt(3000), SqrtPriceLimitX96: new(big.Int).Add(pool.SqrtPriceX96.BigInt(), big.NewInt(1)),
+	})
+	var dataErr rpc.DataError
+	assert.True(t, errors.As(err, &dataErr))
+	reason, unpackErr := abi.UnpackRevert(common.FromHex(dataErr.ErrorData().(string)))
+	assert.NoError(t, unpackErr)
+	assert.Equal(t, "SPL", reason)
+}
@@ -0,0 +1,455 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrPoolNotFound       = errors.New("pool not initialized")
+	ErrPoolExists         = errors.New("pool already initialized")
+	ErrParseEvent         = errors.New("failed parse event")
+	ErrInitializePool     = errors.New("failed initialize pool")
+	ErrSwapUnresolved     = errors.New("failed resolve swap input from event")
+	ErrInvariantViolation = errors.New("event violates pool invariant")
+)
+
+// 处理单个事件时的错误, Kind是上面的某个Err*, 可以用errors.Is判断
+type EventError struct {
+	Kind     error
+	Pool     common.Address
+	Event    string
+	TxHash   common.Hash
+	LogIndex uint
+	BlockNum uint64
+	Err      error
+}
+
+func newEventError(kind error, event string, log *types.Log, err error) *EventError {
+	return &EventError{
+		Kind:     kind,
+		Pool:     log.Address,
+		Event:    event,
+		TxHash:   log.TxHash,
+		LogIndex: log.Index,
+		BlockNum: log.BlockNumber,
+		Err:      err,
+	}
+}
+
+func (e *EventError) Error() string {
+	msg := fmt.Sprintf("%s: %s event of pool %s, block %d tx %s log %d", e.Kind, e.Event, e.Pool, e.BlockNum, e.TxHash, e.LogIndex)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *EventError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// EventApplier读写pool的位置, Simulator和SimulatorFork各自实现
+type PoolStore interface {
+	// 不存在时返回false
+	Pool(addr common.Address) (*CorePool, bool)
+	AddPool(addr common.Address, pool *CorePool)
+	// 每个事件成功应用后调用, initialize时record为nil
+	PoolChanged(pool *CorePool, record *Record)
+	// 事件应用成功之后调用, 用于通知observer
+	EventApplied(event *PoolEvent)
+}
+
+// 决定异常事件如何处理, 返回nil跳过该事件继续处理, 返回error中止整个批次
+type ApplyPolicy interface {
+	// 是否忽略该pool的所有事件
+	Skipped(addr common.Address) bool
+	// 事件所属的pool未初始化, ErrPoolNotFound
+	OnUnknownPool(log *types.Log, err *EventError) error
+	// 事件解析失败, ErrParseEvent
+	OnParseFailure(log *types.Log, err *EventError) error
+	// 查询pool元数据失败, ErrInitializePool
+	OnInitializeFailure(log *types.Log, err *EventError) error
+	// 无法从swap事件反推出输入参数, ErrSwapUnresolved
+	OnUnresolvedSwap(log *types.Log, err *EventError) error
+	// 事件在pool上执行失败, ErrInvariantViolation或ErrPoolExists.
+	// 此时pool可能已经被部分修改
+	OnApplyFailure(log *types.Log, err *EventError) error
+}
+
+// 同步主流程的策略: 未初始化的pool和解析失败的事件跳过, 非标准合约(reverted)跳过,
+// 无法解析swap、初始化或执行失败的pool加入Quarantine, 其它pool继续同步
+type DefaultPolicy struct {
+	Quarantine *QuarantinePolicy // 为nil时不跳过任何pool, 初始化或执行失败时中止批次
+	Strict     bool              // 初始化或执行失败时中止批次而不是隔离pool
+}
+
+func (p DefaultPolicy) Skipped(addr common.Address) bool {
+	return p.Quarantine != nil && p.Quarantine.Quarantined(addr)
+}
+
+func (DefaultPolicy) OnUnknownPool(log *types.Log, err *EventError) error {
+	return nil
+}
+
+func (DefaultPolicy) OnParseFailure(log *types.Log, err *EventError) error {
+	logrus.Warn(err)
+	return nil
+}
+
+func (p DefaultPolicy) OnInitializeFailure(log *types.Log, err *EventError) error {
+	logrus.Warn(err)
+	// reverted 就是不规范合约， 忽略
+	if strings.Contains(err.Err.Error(), "reverted") {
+		return nil
+	}
+	return p.quarantine(err)
+}
+
+func (p DefaultPolicy) OnUnresolvedSwap(log *types.Log, err *EventError) error {
+	logrus.Error(err)
+	if p.Quarantine == nil {
+		return nil
+	}
+	return p.Quarantine.Quarantine(err)
+}
+
+func (p DefaultPolicy) OnApplyFailure(log *types.Log, err *EventError) error {
+	logrus.Error(err)
+	return p.quarantine(err)
+}
+
+// 隔离出错的pool, 同步被取消时仍然中止
+func (p DefaultPolicy) quarantine(err *EventError) error {
+	if p.Quarantine == nil || p.Strict || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return p.Quarantine.Quarantine(err)
+}
+
+// 把链上事件按顺序应用到PoolStore中的pool
+type EventApplier struct {
+	simulator *Simulator
+	store     PoolStore
+	policy    ApplyPolicy
+	metrics   *Metrics
+	// 当前交易中每个pool已处理的swap数量, 用于匹配交易中的swap调用
+	swapTx       common.Hash
+	swapOrdinals map[common.Address]int
+}
+
+func NewEventApplier(simulator *Simulator, store PoolStore, policy ApplyPolicy) *EventApplier {
+	if policy == nil {
+		policy = DefaultPolicy{Quarantine: simulator.Quarantine}
+	}
+	return &EventApplier{
+		simulator:    simulator,
+		store:        store,
+		policy:       policy,
+		metrics:      simulator.metrics,
+		swapOrdinals: map[common.Address]int{},
+	}
+}
+
+func (a *EventApplier) Apply(logs []types.Log) error {
+	for i := range logs {
+		err := a.ApplyLog(&logs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *EventApplier) ApplyLog(log *types.Log) error {
+	if len(log.Topics) == 0 || a.policy.Skipped(log.Address) {
+		return nil
+	}
+	s := a.simulator
+	topic0 := log.Topics[0]
+	if topic0 == s.InitializeID {
+		return a.applyInitialize(log)
+	}
+	if topic0 != s.MintID && topic0 != s.BurnID && topic0 != s.SwapID && topic0 != s.CollectID && topic0 != s.FlashID {
+		return nil
+	}
+	pool, ok := a.store.Pool(log.Address)
+	if !ok {
+		return a.policy.OnUnknownPool(log, newEventError(ErrPoolNotFound, eventName(s, topic0), log, nil))
+	}
+	before := Slot0Export{SqrtPriceX96: pool.SqrtPriceX96, Tick: pool.TickCurrent}
+	liquidity := pool.Liquidity
+	var record *Record
+	var err error
+	switch topic0 {
+	case s.MintID:
+		record, err = a.applyMint(pool, log)
+	case s.BurnID:
+		record, err = a.applyBurn(pool, log)
+	case s.SwapID:
+		record, err = a.applySwap(pool, log)
+	case s.CollectID:
+		record, err = a.applyCollect(pool, log)
+	case s.FlashID:
+		record, err = a.applyFlash(pool, log)
+	}
+	if err != nil || record == nil {
+		return err
+	}
+	pool.CurrentBlockNum = log.BlockNumber
+	a.store.PoolChanged(pool, record)
+	a.metrics.eventApplied(eventName(s, topic0))
+	a.store.EventApplied(newPoolEvent(eventName(s, topic0), log, &before, liquidity, pool, record))
+	return nil
+}
+
+func eventName(s *Simulator, topic0 common.Hash) string {
+	switch topic0 {
+	case s.InitializeID:
+		return "initialize"
+	case s.MintID:
+		return "mint"
+	case s.BurnID:
+		return "burn"
+	case s.SwapID:
+		return "swap"
+	case s.CollectID:
+		return "collect"
+	case s.FlashID:
+		return "flash"
+	}
+	return topic0.String()
+}
+
+func (a *EventApplier) applyInitialize(log *types.Log) error {
+	if _, exist := a.store.Pool(log.Address); exist {
+		return a.policy.OnApplyFailure(log, newEventError(ErrPoolExists, "initialize", log, nil))
+	}
+	pool, err := a.simulator.NewPool(log)
+	if err != nil {
+		return a.policy.OnInitializeFailure(log, newEventError(ErrInitializePool, "initialize", log, err))
+	}
+	pool.DeployBlockNum = log.BlockNumber
+	pool.CurrentBlockNum = log.BlockNumber
+	a.store.AddPool(log.Address, pool)
+	a.store.PoolChanged(pool, nil)
+	a.metrics.eventApplied("initialize")
+	a.store.EventApplied(newPoolEvent("initialize", log, nil, ZERO, pool, nil))
+	return nil
+}
+
+// 以下apply函数返回nil record表示事件被策略跳过
+
+func (a *EventApplier) applyMint(pool *CorePool, log *types.Log) (*Record, error) {
+	mint, err := parseUniv3MintEvent(log)
+	if err != nil {
+		return nil, a.policy.OnParseFailure(log, newEventError(ErrParseEvent, "mint", log, err))
+	}
+	amount0, amount1, err := pool.Mint(mint.Owner, mint.TickLower, mint.TickUpper, mint.Amount)
+	if err != nil {
+		return nil, a.policy.OnApplyFailure(log, newEventError(ErrInvariantViolation, "mint", log, err))
+	}
+	return NewRecord(log, ActionMint, mint.Owner, RecordParams{
+		"sender":     mint.Sender,
+		"tick_lower": strconv.Itoa(mint.TickLower),
+		"tick_upper": strconv.Itoa(mint.TickUpper),
+		"amount":     mint.Amount.String(),
+	}, amount0, amount1), nil
+}
+
+func (a *EventApplier) applyBurn(pool *CorePool, log *types.Log) (*Record, error) {
+	burn, err := parseUniv3BurnEvent(log)
+	if err != nil {
+		return nil, a.policy.OnParseFailure(log, newEventError(ErrParseEvent, "burn", log, err))
+	}
+	amount0, amount1, err := pool.Burn(burn.Owner, burn.TickLower, burn.TickUpper, burn.Amount)
+	if err != nil {
+		return nil, a.policy.OnApplyFailure(log, newEventError(ErrInvariantViolation, "burn", log, err))
+	}
+	return NewRecord(log, ActionBurn, burn.Owner, RecordParams{
+		"tick_lower": strconv.Itoa(burn.TickLower),
+		"tick_upper": strconv.Itoa(burn.TickUpper),
+		"amount":     burn.Amount.String(),
+	}, amount0, amount1), nil
+}
+
+func (a *EventApplier) nextSwapOrdinal(log *types.Log) int {
+	if log.TxHash != a.swapTx {
+		a.swapTx = log.TxHash
+		clear(a.swapOrdinals)
+	}
+	ordinal := a.swapOrdinals[log.Address]
+	a.swapOrdinals[log.Address] = ordinal + 1
+	return ordinal
+}
+
+// 按SwapResolveMode得到swap的输入参数, resolvedBy为空表示无法解析
+func (a *EventApplier) resolveSwap(pool *CorePool, log *types.Log, swap *UniV3SwapEvent, ordinal int) (bool, decimal.Decimal, *decimal.Decimal, string, int, error) {
+	s := a.simulator
+	if s.SwapResolveMode == SwapResolveCalldata && s.CallSource != nil {
+		input, err := ResolveSwapInput(s.ctx, s.CallSource, log, ordinal)
+		if err == nil && pool.matchSwapResult(swap, input.ZeroForOne, input.AmountSpecified, &input.SqrtPriceLimitX96) {
+			return input.ZeroForOne, input.AmountSpecified, &input.SqrtPriceLimitX96, swapResolvedByCalldata, -1, nil
+		}
+		if err != nil {
+			logrus.Warnf("failed resolve swap from calldata, tx: %s  pool: %s, %s", log.TxHash, log.Address, err)
+		}
+	}
+	amountSpecified, sqrtPriceX96, solution, err := pool.resolveSwapSolution(swap)
+	if err != nil {
+		return false, ZERO, nil, "", -1, err
+	}
+	return swap.Amount0.IsPositive(), amountSpecified, sqrtPriceX96, swapResolvedByDryRun, solution, nil
+}
+
+func (a *EventApplier) applySwap(pool *CorePool, log *types.Log) (*Record, error) {
+	// 解析失败的swap也占用交易中的一次swap调用
+	ordinal := a.nextSwapOrdinal(log)
+	swap, err := parseUniv3SwapEvent(log)
+	if err != nil {
+		return nil, a.policy.OnParseFailure(log, newEventError(ErrParseEvent, "swap", log, err))
+	}
+	params := RecordParams{
+		"recipient":      swap.Recipient,
+		"sqrt_price_x96": swap.SqrtPriceX96.String(),
+		"liquidity":      swap.Liquidity.String(),
+	}
+	zeroForOne, amountSpecified, sqrtPriceX96, resolvedBy, solution, err := a.resolveSwap(pool, log, swap, ordinal)
+	if err != nil {
+		if a.simulator.SwapResolveMode != SwapResolveCalldata {
+			a.metrics.swapResolved(swapUnresolved, -1)
+			return nil, a.policy.OnUnresolvedSwap(log, newEventError(ErrSwapUnresolved, "swap", log, err))
+		}
+		logrus.Warnf("apply swap result directly, tx: %s  pool: %s", log.TxHash, log.Address)
+		exact, err := pool.ApplySwapResult(swap)
+		if err != nil {
+			return nil, a.policy.OnApplyFailure(log, newEventError(ErrInvariantViolation, "swap", log, err))
+		}
+		resolvedBy := swapResolvedByState
+		if !exact {
+			resolvedBy = swapResolvedByStateApprox
+		}
+		params["zero_for_one"] = strconv.FormatBool(swap.Amount0.IsPositive())
+		params["resolved_by"] = resolvedBy
+		a.metrics.swapResolved(resolvedBy, -1)
+		return NewRecord(log, ActionSwap, swap.Sender, params, swap.Amount0, swap.Amount1), nil
+	}
+	amount0, amount1, _, err := pool.HandleSwap(zeroForOne, amountSpecified, sqrtPriceX96, false)
+	if err != nil {
+		return nil, a.policy.OnApplyFailure(log, newEventError(ErrInvariantViolation, "swap", log, err))
+	}
+	params["zero_for_one"] = strconv.FormatBool(zeroForOne)
+	params["amount_specified"] = amountSpecified.String()
+	params["resolved_by"] = resolvedBy
+	if solution >= 0 {
+		params["solution_index"] = strconv.Itoa(solution)
+	}
+	a.metrics.swapResolved(resolvedBy, solution)
+	if sqrtPriceX96 != nil {
+		params["sqrt_price_limit_x96"] = sqrtPriceX96.String()
+	}
+	return NewRecord(log, ActionSwap, swap.Sender, params, amount0, amount1), nil
+}
+
+func (a *EventApplier) applyCollect(pool *CorePool, log *types.Log) (*Record, error) {
+	collect, err := parseUniv3CollectEvent(log)
+	if err != nil {
+		return nil, a.policy.OnParseFailure(log, newEventError(ErrParseEvent, "collect", log, err))
+	}
+	amount0, amount1, err := pool.Collect(collect.Owner, collect.TickLower, collect.TickUpper, collect.Amount0, collect.Amount1)
+	if err != nil {
+		// collect不影响价格和流动性, 校验失败(例如position不在历史中)只记录事件, 不中止同步
+		logrus.Warn(newEventError(ErrInvariantViolation, "collect", log, err))
+		amount0, amount1 = collect.Amount0, collect.Amount1
+	}
+	return NewRecord(log, ActionCollect, collect.Owner, RecordParams{
+		"recipient":  collect.Recipient,
+		"tick_lower": strconv.Itoa(collect.TickLower),
+		"tick_upper": strconv.Itoa(collect.TickUpper),
+	}, amount0, amount1), nil
+}
+
+func (a *EventApplier) applyFlash(pool *CorePool, log *types.Log) (*Record, error) {
+	flash, err := parseUniv3FlashEvent(log)
+	if err != nil {
+		return nil, a.policy.OnParseFailure(log, newEventError(ErrParseEvent, "flash", log, err))
+	}
+	err = pool.Flash(flash.Paid0, flash.Paid1)
+	if err != nil {
+		// 同collect, 只记录事件
+		logrus.Warn(newEventError(ErrInvariantViolation, "flash", log, err))
+	}
+	return NewRecord(log, ActionFlash, flash.Sender, RecordParams{
+		"recipient": flash.Recipient,
+		"amount0":   flash.Amount0.String(),
+		"amount1":   flash.Amount1.String(),
+	}, flash.Paid0, flash.Paid1), nil
+}
+
+// Simulator作为PoolStore: 变更的pool标记为dirty, 记录事件历史
+type simulatorStore struct {
+	pm     *Simulator
+	events []*PoolEvent
+}
+
+func (s *simulatorStore) Pool(addr common.Address) (*CorePool, bool) {
+	pool, ok := s.pm.Pools[addr]
+	return pool, ok
+}
+
+func (s *simulatorStore) AddPool(addr common.Address, pool *CorePool) {
+	s.pm.Pools[addr] = pool
+}
+
+func (s *simulatorStore) PoolChanged(pool *CorePool, record *Record) {
+	s.pm.dirtyPools[pool.PoolAddress] = pool
+	if record != nil {
+		s.pm.addRecord(record)
+	}
+}
+
+// 这一批日志全部应用成功后再通知observer, 和并行执行一致
+func (s *simulatorStore) EventApplied(event *PoolEvent) {
+	if s.pm.observing() {
+		snapshotEvent(event)
+		s.events = append(s.events, event)
+	}
+}
+
+// SimulatorFork作为PoolStore: 首次访问时从parent分叉, 不记录历史, 只通知fork的Observer
+type forkStore struct {
+	fork *SimulatorFork
+}
+
+func (s forkStore) Pool(addr common.Address) (*CorePool, bool) {
+	pool, err := s.fork.GetPool(addr)
+	if err != nil {
+		return nil, false
+	}
+	return pool, true
+}
+
+func (s forkStore) AddPool(addr common.Address, pool *CorePool) {
+	s.fork.Pools[addr] = pool
+}
+
+func (s forkStore) PoolChanged(pool *CorePool, record *Record) {
+}
+
+func (s forkStore) EventApplied(event *PoolEvent) {
+	if s.fork.Observer != nil {
+		snapshotEvent(event)
+		s.fork.Observer.OnPoolEvent(event)
+	}
+}
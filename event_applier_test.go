@@ -0,0 +1,146 @@
+package uniswap_v3_simulator
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventApplier_ForkMatchesSimulator(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	fork := NewSimulatorSnapshot(pm)
+
+	owner := "0x1111111111111111111111111111111111111111"
+	mint := testMintLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 0)
+	swap := testSwapLog(t, pool, owner, true, decimal.NewFromInt(1e15), 11, 0)
+	// 旧的fork实现只检查skipAddress前三个地址
+	skipped := testMintLog(legacySkipAddress[3], owner, -60, 60, decimal.NewFromInt(1e17), 11, 1)
+	logs := []types.Log{mint, swap, skipped}
+
+	assert.NoError(t, fork.HandleLogs(logs))
+	assert.NoError(t, pm.HandleLogs(logs))
+
+	forked, err := fork.GetPool(addr)
+	assert.NoError(t, err)
+	assert.True(t, DiffPools(pm.Pools[addr], forked).Empty())
+	assert.Equal(t, uint64(11), forked.CurrentBlockNum)
+	_, ok := fork.Pools[legacySkipAddress[3]]
+	assert.False(t, ok)
+	// fork不记录事件历史
+	assert.Len(t, pm.pendingRecords, 2)
+}
+
+type strictPolicy struct {
+	DefaultPolicy
+}
+
+func (strictPolicy) OnUnknownPool(log *types.Log, err *EventError) error {
+	return err
+}
+
+func TestEventApplier_Policy(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	unknown := testMintLog(common.HexToAddress("0x2222222222222222222222222222222222222222"), "0x1111111111111111111111111111111111111111", -60, 60, decimal.NewFromInt(1e17), 10, 0)
+	assert.NoError(t, pm.HandleLogs([]types.Log{unknown}))
+
+	pm.Policy = strictPolicy{}
+	assert.ErrorIs(t, pm.HandleLogs([]types.Log{unknown}), ErrPoolNotFound)
+	fork := NewSimulatorSnapshot(pm)
+	assert.ErrorIs(t, fork.HandleLogs([]types.Log{unknown}), ErrPoolNotFound)
+}
+
+func testBurnLog(pool common.Address, owner string, tickLower, tickUpper int, amount decimal.Decimal, block uint64, index uint) types.Log {
+	data := append(word(amount), word(ZERO)...)
+	data = append(data, word(ZERO)...)
+	return types.Log{
+		Address:     pool,
+		Topics:      []common.Hash{TOPIC_BURN, addrTopic(owner), intTopic(tickLower), intTopic(tickUpper)},
+		Data:        data,
+		BlockNumber: block,
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(block*1000 + uint64(index))),
+		Index:       index,
+	}
+}
+
+func TestEventApplier_QuarantinePolicy(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	other := newTestPool(t)
+	otherAddr := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	other.PoolAddress = otherAddr.String()
+	pm.Pools[otherAddr] = other
+
+	owner := "0x1111111111111111111111111111111111111111"
+	// 没有流动性的position burn失败
+	burn := testBurnLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 0)
+	mint := testMintLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 2)
+	otherMint := testMintLog(otherAddr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 3)
+	logs := []types.Log{burn, {}, mint, otherMint}
+
+	pm.Policy = DefaultPolicy{Quarantine: pm.Quarantine, Strict: true}
+	err := pm.HandleLogs(logs)
+	assert.ErrorIs(t, err, ErrInvariantViolation)
+	var eventErr *EventError
+	assert.ErrorAs(t, err, &eventErr)
+	assert.Equal(t, addr, eventErr.Pool)
+	assert.Equal(t, "burn", eventErr.Event)
+
+	policy := NewQuarantinePolicy()
+	fork := NewSimulatorSnapshot(pm)
+	fork.Policy = policy
+	assert.NoError(t, fork.HandleLogs(logs))
+	assert.True(t, policy.Quarantined(addr))
+	// 隔离后的事件不再处理, 空log不会中止批次
+	forked, _ := fork.GetPool(addr)
+	assert.True(t, forked.Liquidity.Equal(pool.Liquidity))
+	forkedOther, _ := fork.GetPool(otherAddr)
+	assert.Equal(t, uint64(10), forkedOther.CurrentBlockNum)
+
+	report := policy.Report()
+	assert.Len(t, report, 1)
+	assert.Equal(t, addr.String(), report[0].PoolAddress)
+	assert.Equal(t, ErrInvariantViolation.Error(), report[0].Kind)
+	assert.Equal(t, uint64(10), report[0].BlockNum)
+}
+
+func TestSimulator_DefaultPolicyQuarantinesFailingPool(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	pm := newTestSimulator(t, dbFile)
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	other := newTestPool(t)
+	otherAddr := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	other.PoolAddress = otherAddr.String()
+	pm.Pools[otherAddr] = other
+
+	// burn失败的pool被隔离, 之后的事件跳过, 其它pool继续同步
+	owner := "0x1111111111111111111111111111111111111111"
+	burn := testBurnLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 0)
+	mint := testMintLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 1)
+	otherMint := testMintLog(otherAddr, owner, -60, 60, decimal.NewFromInt(1e17), 10, 2)
+	assert.NoError(t, pm.HandleLogs([]types.Log{burn, mint}))
+	assert.NoError(t, pm.HandleLogs([]types.Log{otherMint}))
+	assert.True(t, pm.Quarantine.Quarantined(addr))
+	assert.False(t, pm.Quarantine.Quarantined(otherAddr))
+	assert.Equal(t, uint64(10), other.CurrentBlockNum)
+	assert.Equal(t, uint64(0), pool.CurrentBlockNum)
+	pm.currentBlock = 10
+	assert.NoError(t, pm.FlushPools())
+
+	reopened := newTestSimulator(t, dbFile)
+	entry, ok := reopened.Quarantine.Get(addr)
+	assert.True(t, ok)
+	assert.Equal(t, ErrInvariantViolation.Error(), entry.Kind)
+	assert.Equal(t, uint64(10), reopened.CurrentBlock())
+}
@@ -22,6 +22,7 @@ type UniV3SwapEvent struct {
 	Amount1      decimal.Decimal `json:"amount1"`
 	SqrtPriceX96 decimal.Decimal `json:"sqrt_price_x96"`
 	Liquidity    decimal.Decimal `json:"Liquidity"`
+	Tick         *int            `json:"tick"` // 部分节点返回的data不含tick
 	Recipient    string          `json:"to"`
 	LogIndex     string          `json:"logIndex"`
 	Removed      bool            `json:"removed"`
@@ -37,6 +38,24 @@ type UniV3MintEvent struct {
 	Amount0   decimal.Decimal `json:"amount0"`
 	Amount1   decimal.Decimal `json:"amount1"`
 }
+type UniV3CollectEvent struct {
+	RawEvent  *types.Log      `json:"raw_event"`
+	Owner     string          `json:"owner"` // index value
+	Recipient string          `json:"recipient"`
+	TickLower int             `json:"tick_lower"`
+	TickUpper int             `json:"tick_upper"`
+	Amount0   decimal.Decimal `json:"amount0"`
+	Amount1   decimal.Decimal `json:"amount1"`
+}
+type UniV3FlashEvent struct {
+	RawEvent  *types.Log      `json:"raw_event"`
+	Sender    string          `json:"sender"`    // index value
+	Recipient string          `json:"recipient"` // index value
+	Amount0   decimal.Decimal `json:"amount0"`
+	Amount1   decimal.Decimal `json:"amount1"`
+	Paid0     decimal.Decimal `json:"paid0"`
+	Paid1     decimal.Decimal `json:"paid1"`
+}
 type UniV3BurnEvent struct {
 	RawEvent  *types.Log      `json:"raw_event"`
 	Owner     string          `json:"owner"` // index value
@@ -60,6 +79,9 @@ func parseUniv3SwapEvent(log *types.Log) (*UniV3SwapEvent, error) {
 	if len(event.Topics) != 3 {
 		return nil, fmt.Errorf("topic not match,expect %d, got %d", 3, len(event.Topics))
 	}
+	if len(data) < 32*4 {
+		return nil, fmt.Errorf("data too short, expect %d, got %d", 32*4, len(data))
+	}
 	amount0Raw, err := abi.ReadInteger(int256, data[0:32])
 	if err != nil {
 		return nil, err
@@ -96,11 +118,25 @@ func parseUniv3SwapEvent(log *types.Log) (*UniV3SwapEvent, error) {
 	}
 	parsed := &UniV3SwapEvent{
 		RawEvent:     log,
+		Sender:       hash2Addr(event.Topics[1]),
+		Recipient:    hash2Addr(event.Topics[2]),
 		Amount0:      decimal.NewFromBigInt(amount0, 0),
 		Amount1:      decimal.NewFromBigInt(amount1, 0),
 		SqrtPriceX96: decimal.NewFromBigInt(sqrtPriceX96, 0),
 		Liquidity:    decimal.NewFromBigInt(liquidity, 0),
 	}
+	if len(data) >= 32*5 {
+		tickRaw, err := abi.ReadInteger(int24, data[32*4:32*5])
+		if err != nil {
+			return nil, err
+		}
+		tick, ok := tickRaw.(*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("parse swap err tick not a int")
+		}
+		t := int(tick.Int64())
+		parsed.Tick = &t
+	}
 	// swap 逻辑来处理
 	//if parsed.Amount0.IsZero() && parsed.Amount1.IsZero() && parsed.Liquidity.IsZero() {
 	//	return nil, fmt.Errorf("swap amoun is 0: %s", log.TxHash)
@@ -182,6 +218,62 @@ func parseUniv3BurnEvent(log *types.Log) (*UniV3BurnEvent, error) {
 	//}
 	return parsed, nil
 }
+func parseUniv3CollectEvent(log *types.Log) (*UniV3CollectEvent, error) {
+	event := log
+	data := event.Data
+	if len(event.Topics) != 4 {
+		return nil, fmt.Errorf("topic not match,expect %d, got %d", 4, len(event.Topics))
+	}
+	if len(data) < 32*3 {
+		return nil, fmt.Errorf("data too short, expect %d, got %d", 32*3, len(data))
+	}
+	tickLowerRaw, err := abi.ReadInteger(int24, event.Topics[2].Bytes())
+	if err != nil {
+		return nil, err
+	}
+	tickLower, ok := tickLowerRaw.(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("failed read collect.tick_lower %s, tx: %s", tickLower, event.TxHash)
+	}
+	tickUpperRaw, err := abi.ReadInteger(int24, event.Topics[3].Bytes())
+	if err != nil {
+		return nil, err
+	}
+	tickUpper, ok := tickUpperRaw.(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("failed read collect.tick_upper %s, tx: %s", tickUpper, event.TxHash)
+	}
+	parsed := &UniV3CollectEvent{
+		RawEvent:  log,
+		Owner:     hash2Addr(event.Topics[1]),
+		Recipient: strings.ToLower(common.BytesToAddress(data[:32]).Hex()),
+		TickLower: int(tickLower.Int64()),
+		TickUpper: int(tickUpper.Int64()),
+		Amount0:   decimal.NewFromBigInt(big.NewInt(0).SetBytes(data[32*1:32*2]), 0),
+		Amount1:   decimal.NewFromBigInt(big.NewInt(0).SetBytes(data[32*2:32*3]), 0),
+	}
+	return parsed, nil
+}
+func parseUniv3FlashEvent(log *types.Log) (*UniV3FlashEvent, error) {
+	event := log
+	data := event.Data
+	if len(event.Topics) != 3 {
+		return nil, fmt.Errorf("topic not match,expect %d, got %d", 3, len(event.Topics))
+	}
+	if len(data) < 32*4 {
+		return nil, fmt.Errorf("data too short, expect %d, got %d", 32*4, len(data))
+	}
+	parsed := &UniV3FlashEvent{
+		RawEvent:  log,
+		Sender:    hash2Addr(event.Topics[1]),
+		Recipient: hash2Addr(event.Topics[2]),
+		Amount0:   decimal.NewFromBigInt(big.NewInt(0).SetBytes(data[:32]), 0),
+		Amount1:   decimal.NewFromBigInt(big.NewInt(0).SetBytes(data[32*1:32*2]), 0),
+		Paid0:     decimal.NewFromBigInt(big.NewInt(0).SetBytes(data[32*2:32*3]), 0),
+		Paid1:     decimal.NewFromBigInt(big.NewInt(0).SetBytes(data[32*3:32*4]), 0),
+	}
+	return parsed, nil
+}
 func parseUniv3InitializeEvent(log *types.Log) (*UniV3InitializeEvent, error) {
 	event := log
 	data := event.Data
@@ -0,0 +1,513 @@
+package uniswap_v3_simulator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/parquet-go/parquet-go"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	PoolExportSchema  = "uniswap-v3-simulator/pool"
+	PoolExportVersion = 1
+)
+
+type ExportFormat string
+
+const (
+	ExportJSON    ExportFormat = "json"
+	ExportCSV     ExportFormat = "csv"
+	ExportParquet ExportFormat = "parquet"
+)
+
+// 单个pool的完整导出, 所有uint256/int256数值均以十进制字符串表示
+type PoolExport struct {
+	Schema               string           `json:"schema"`
+	Version              int              `json:"version"`
+	ExportedAt           time.Time        `json:"exported_at"`
+	PoolAddress          string           `json:"pool_address"`
+	Token0               string           `json:"token0"`
+	Token1               string           `json:"token1"`
+	Fee                  FeeAmount        `json:"fee"`
+	TickSpacing          int              `json:"tick_spacing"`
+	MaxLiquidityPerTick  decimal.Decimal  `json:"max_liquidity_per_tick"`
+	DeployBlockNum       uint64           `json:"deploy_block_num"`
+	CurrentBlockNum      uint64           `json:"current_block_num"`
+	Token0Balance        decimal.Decimal  `json:"token0_balance"`
+	Token1Balance        decimal.Decimal  `json:"token1_balance"`
+	Slot0                Slot0Export      `json:"slot0"`
+	Liquidity            decimal.Decimal  `json:"liquidity"`
+	FeeGrowthGlobal0X128 decimal.Decimal  `json:"fee_growth_global0_x128"`
+	FeeGrowthGlobal1X128 decimal.Decimal  `json:"fee_growth_global1_x128"`
+	Ticks                []TickExport     `json:"ticks"`
+	Positions            []PositionExport `json:"positions"`
+}
+
+type Slot0Export struct {
+	SqrtPriceX96 decimal.Decimal `json:"sqrt_price_x96"`
+	Tick         int             `json:"tick"`
+}
+
+type TickExport struct {
+	TickIndex             int             `json:"tick_index"`
+	LiquidityGross        decimal.Decimal `json:"liquidity_gross"`
+	LiquidityNet          decimal.Decimal `json:"liquidity_net"`
+	FeeGrowthOutside0X128 decimal.Decimal `json:"fee_growth_outside0_x128"`
+	FeeGrowthOutside1X128 decimal.Decimal `json:"fee_growth_outside1_x128"`
+}
+
+type PositionExport struct {
+	Owner                    string          `json:"owner"`
+	TickLower                int             `json:"tick_lower"`
+	TickUpper                int             `json:"tick_upper"`
+	Liquidity                decimal.Decimal `json:"liquidity"`
+	FeeGrowthInside0LastX128 decimal.Decimal `json:"fee_growth_inside0_last_x128"`
+	FeeGrowthInside1LastX128 decimal.Decimal `json:"fee_growth_inside1_last_x128"`
+	TokensOwed0              decimal.Decimal `json:"tokens_owed0"`
+	TokensOwed1              decimal.Decimal `json:"tokens_owed1"`
+}
+
+func NewPoolExport(p *CorePool) (*PoolExport, error) {
+	export := &PoolExport{
+		Schema:               PoolExportSchema,
+		Version:              PoolExportVersion,
+		ExportedAt:           time.Now().UTC(),
+		PoolAddress:          p.PoolAddress,
+		Token0:               p.Token0,
+		Token1:               p.Token1,
+		Fee:                  p.Fee,
+		TickSpacing:          p.TickSpacing,
+		MaxLiquidityPerTick:  p.MaxLiquidityPerTick,
+		DeployBlockNum:       p.DeployBlockNum,
+		CurrentBlockNum:      p.CurrentBlockNum,
+		Token0Balance:        p.Token0Balance,
+		Token1Balance:        p.Token1Balance,
+		Slot0:                Slot0Export{SqrtPriceX96: p.SqrtPriceX96, Tick: p.TickCurrent},
+		Liquidity:            p.Liquidity,
+		FeeGrowthGlobal0X128: p.FeeGrowthGlobal0X128,
+		FeeGrowthGlobal1X128: p.FeeGrowthGlobal1X128,
+		Ticks:                []TickExport{},
+		Positions:            []PositionExport{},
+	}
+	for _, tick := range p.TickManager.GetSortedTicks() {
+		export.Ticks = append(export.Ticks, TickExport{
+			TickIndex:             tick.TickIndex,
+			LiquidityGross:        tick.LiquidityGross,
+			LiquidityNet:          tick.LiquidityNet,
+			FeeGrowthOutside0X128: tick.FeeGrowthOutside0X128,
+			FeeGrowthOutside1X128: tick.FeeGrowthOutside1X128,
+		})
+	}
+	var err error
+	p.PositionManager.Ascend(func(key string, position *Position) bool {
+		var owner string
+		var tickLower, tickUpper int
+		owner, tickLower, tickUpper, err = ParsePositionKey(key)
+		if err != nil {
+			return false
+		}
+		export.Positions = append(export.Positions, PositionExport{
+			Owner:                    owner,
+			TickLower:                tickLower,
+			TickUpper:                tickUpper,
+			Liquidity:                position.Liquidity,
+			FeeGrowthInside0LastX128: position.FeeGrowthInside0LastX128,
+			FeeGrowthInside1LastX128: position.FeeGrowthInside1LastX128,
+			TokensOwed0:              position.TokensOwed0,
+			TokensOwed1:              position.TokensOwed1,
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// 从导出结果重建CorePool, 返回的pool未写入数据库(HasCreated=false)
+func (e *PoolExport) ToCorePool() (*CorePool, error) {
+	if e.Schema != PoolExportSchema {
+		return nil, fmt.Errorf("unknown pool export schema %q", e.Schema)
+	}
+	if e.Version != PoolExportVersion {
+		return nil, fmt.Errorf("unsupported pool export version %d", e.Version)
+	}
+	pool := &CorePool{
+		PoolAddress:          e.PoolAddress,
+		Token0:               e.Token0,
+		Token1:               e.Token1,
+		Fee:                  e.Fee,
+		TickSpacing:          e.TickSpacing,
+		MaxLiquidityPerTick:  e.MaxLiquidityPerTick,
+		CurrentBlockNum:      e.CurrentBlockNum,
+		DeployBlockNum:       e.DeployBlockNum,
+		Token0Balance:        e.Token0Balance,
+		Token1Balance:        e.Token1Balance,
+		SqrtPriceX96:         e.Slot0.SqrtPriceX96,
+		Liquidity:            e.Liquidity,
+		TickCurrent:          e.Slot0.Tick,
+		FeeGrowthGlobal0X128: e.FeeGrowthGlobal0X128,
+		FeeGrowthGlobal1X128: e.FeeGrowthGlobal1X128,
+		TickManager:          NewTickManager(),
+		PositionManager:      NewPositionManager(),
+	}
+	for _, t := range e.Ticks {
+		tick, err := NewTick(t.TickIndex)
+		if err != nil {
+			return nil, err
+		}
+		tick.LiquidityGross = t.LiquidityGross
+		tick.LiquidityNet = t.LiquidityNet
+		tick.FeeGrowthOutside0X128 = t.FeeGrowthOutside0X128
+		tick.FeeGrowthOutside1X128 = t.FeeGrowthOutside1X128
+		pool.TickManager.Set(tick)
+	}
+	for _, p := range e.Positions {
+		pool.PositionManager.Set(GetPositionKey(p.Owner, p.TickLower, p.TickUpper), &Position{
+			Liquidity:                p.Liquidity,
+			FeeGrowthInside0LastX128: p.FeeGrowthInside0LastX128,
+			FeeGrowthInside1LastX128: p.FeeGrowthInside1LastX128,
+			TokensOwed0:              p.TokensOwed0,
+			TokensOwed1:              p.TokensOwed1,
+		})
+	}
+	return pool, nil
+}
+
+func ParsePositionKey(key string) (string, int, int, error) {
+	parts := strings.Split(key, "_")
+	if len(parts) < 3 {
+		return "", 0, 0, fmt.Errorf("invalid position key %s", key)
+	}
+	tickLower, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid position key %s: %w", key, err)
+	}
+	tickUpper, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid position key %s: %w", key, err)
+	}
+	return strings.Join(parts[:len(parts)-2], "_"), tickLower, tickUpper, nil
+}
+
+func WritePoolJSON(w io.Writer, p *CorePool) error {
+	export, err := NewPoolExport(p)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+func ReadPoolJSON(r io.Reader) (*CorePool, error) {
+	var export PoolExport
+	err := json.NewDecoder(r).Decode(&export)
+	if err != nil {
+		return nil, err
+	}
+	return export.ToCorePool()
+}
+
+// 导出目录结构:
+//
+//	pools/<address>.json
+//	pools.csv ticks.csv positions.csv
+//	pools.parquet ticks.parquet positions.parquet
+type Exporter struct {
+	Dir     string
+	Formats []ExportFormat
+}
+
+func NewExporter(dir string, formats ...ExportFormat) *Exporter {
+	if len(formats) == 0 {
+		formats = []ExportFormat{ExportJSON, ExportCSV, ExportParquet}
+	}
+	return &Exporter{Dir: dir, Formats: formats}
+}
+
+func (e *Exporter) Export(pools map[common.Address]*CorePool) error {
+	exports := make([]*PoolExport, 0, len(pools))
+	for _, pool := range pools {
+		export, err := NewPoolExport(pool)
+		if err != nil {
+			return err
+		}
+		exports = append(exports, export)
+	}
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].PoolAddress < exports[j].PoolAddress
+	})
+	err := os.MkdirAll(e.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	for _, format := range e.Formats {
+		switch format {
+		case ExportJSON:
+			err = e.writeJSON(exports)
+		case ExportCSV:
+			err = e.writeCSV(exports)
+		case ExportParquet:
+			err = e.writeParquet(exports)
+		default:
+			err = fmt.Errorf("unknown export format %s", format)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) writeJSON(exports []*PoolExport) error {
+	dir := filepath.Join(e.Dir, "pools")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		err = writeFile(filepath.Join(dir, export.PoolAddress+".json"), func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(export)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从JSON导出目录加载所有pool
+func ImportPoolsJSON(dir string) (map[common.Address]*CorePool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "pools", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	pools := map[common.Address]*CorePool{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := ReadPoolJSON(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed import %s: %w", file, err)
+		}
+		pools[common.HexToAddress(pool.PoolAddress)] = pool
+	}
+	return pools, nil
+}
+
+var (
+	poolCSVHeader     = []string{"pool_address", "token0", "token1", "fee", "tick_spacing", "deploy_block_num", "current_block_num", "sqrt_price_x96", "tick", "liquidity", "fee_growth_global0_x128", "fee_growth_global1_x128"}
+	tickCSVHeader     = []string{"pool_address", "current_block_num", "tick_index", "liquidity_gross", "liquidity_net", "fee_growth_outside0_x128", "fee_growth_outside1_x128"}
+	positionCSVHeader = []string{"pool_address", "current_block_num", "owner", "tick_lower", "tick_upper", "liquidity", "fee_growth_inside0_last_x128", "fee_growth_inside1_last_x128", "tokens_owed0", "tokens_owed1"}
+)
+
+func (e *Exporter) writeCSV(exports []*PoolExport) error {
+	err := writeCSVFile(filepath.Join(e.Dir, "pools.csv"), poolCSVHeader, func(w *csv.Writer) error {
+		for _, p := range exports {
+			err := w.Write([]string{
+				p.PoolAddress, p.Token0, p.Token1, strconv.Itoa(int(p.Fee)), strconv.Itoa(p.TickSpacing),
+				strconv.FormatUint(p.DeployBlockNum, 10), strconv.FormatUint(p.CurrentBlockNum, 10),
+				p.Slot0.SqrtPriceX96.String(), strconv.Itoa(p.Slot0.Tick), p.Liquidity.String(),
+				p.FeeGrowthGlobal0X128.String(), p.FeeGrowthGlobal1X128.String(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeCSVFile(filepath.Join(e.Dir, "ticks.csv"), tickCSVHeader, func(w *csv.Writer) error {
+		for _, p := range exports {
+			for _, t := range p.Ticks {
+				err := w.Write([]string{
+					p.PoolAddress, strconv.FormatUint(p.CurrentBlockNum, 10), strconv.Itoa(t.TickIndex),
+					t.LiquidityGross.String(), t.LiquidityNet.String(),
+					t.FeeGrowthOutside0X128.String(), t.FeeGrowthOutside1X128.String(),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeCSVFile(filepath.Join(e.Dir, "positions.csv"), positionCSVHeader, func(w *csv.Writer) error {
+		for _, p := range exports {
+			for _, pos := range p.Positions {
+				err := w.Write([]string{
+					p.PoolAddress, strconv.FormatUint(p.CurrentBlockNum, 10), pos.Owner,
+					strconv.Itoa(pos.TickLower), strconv.Itoa(pos.TickUpper), pos.Liquidity.String(),
+					pos.FeeGrowthInside0LastX128.String(), pos.FeeGrowthInside1LastX128.String(),
+					pos.TokensOwed0.String(), pos.TokensOwed1.String(),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// parquet中大整数同样以十进制字符串保存, uint256超出parquet DECIMAL的精度
+type poolRow struct {
+	PoolAddress          string `parquet:"pool_address"`
+	Token0               string `parquet:"token0"`
+	Token1               string `parquet:"token1"`
+	Fee                  int32  `parquet:"fee"`
+	TickSpacing          int32  `parquet:"tick_spacing"`
+	DeployBlockNum       uint64 `parquet:"deploy_block_num"`
+	CurrentBlockNum      uint64 `parquet:"current_block_num"`
+	SqrtPriceX96         string `parquet:"sqrt_price_x96"`
+	Tick                 int32  `parquet:"tick"`
+	Liquidity            string `parquet:"liquidity"`
+	FeeGrowthGlobal0X128 string `parquet:"fee_growth_global0_x128"`
+	FeeGrowthGlobal1X128 string `parquet:"fee_growth_global1_x128"`
+}
+
+type tickRow struct {
+	PoolAddress           string `parquet:"pool_address"`
+	CurrentBlockNum       uint64 `parquet:"current_block_num"`
+	TickIndex             int32  `parquet:"tick_index"`
+	LiquidityGross        string `parquet:"liquidity_gross"`
+	LiquidityNet          string `parquet:"liquidity_net"`
+	FeeGrowthOutside0X128 string `parquet:"fee_growth_outside0_x128"`
+	FeeGrowthOutside1X128 string `parquet:"fee_growth_outside1_x128"`
+}
+
+type positionRow struct {
+	PoolAddress              string `parquet:"pool_address"`
+	CurrentBlockNum          uint64 `parquet:"current_block_num"`
+	Owner                    string `parquet:"owner"`
+	TickLower                int32  `parquet:"tick_lower"`
+	TickUpper                int32  `parquet:"tick_upper"`
+	Liquidity                string `parquet:"liquidity"`
+	FeeGrowthInside0LastX128 string `parquet:"fee_growth_inside0_last_x128"`
+	FeeGrowthInside1LastX128 string `parquet:"fee_growth_inside1_last_x128"`
+	TokensOwed0              string `parquet:"tokens_owed0"`
+	TokensOwed1              string `parquet:"tokens_owed1"`
+}
+
+func (e *Exporter) writeParquet(exports []*PoolExport) error {
+	var pools []poolRow
+	var ticks []tickRow
+	var positions []positionRow
+	for _, p := range exports {
+		pools = append(pools, poolRow{
+			PoolAddress:          p.PoolAddress,
+			Token0:               p.Token0,
+			Token1:               p.Token1,
+			Fee:                  int32(p.Fee),
+			TickSpacing:          int32(p.TickSpacing),
+			DeployBlockNum:       p.DeployBlockNum,
+			CurrentBlockNum:      p.CurrentBlockNum,
+			SqrtPriceX96:         p.Slot0.SqrtPriceX96.String(),
+			Tick:                 int32(p.Slot0.Tick),
+			Liquidity:            p.Liquidity.String(),
+			FeeGrowthGlobal0X128: p.FeeGrowthGlobal0X128.String(),
+			FeeGrowthGlobal1X128: p.FeeGrowthGlobal1X128.String(),
+		})
+		for _, t := range p.Ticks {
+			ticks = append(ticks, tickRow{
+				PoolAddress:           p.PoolAddress,
+				CurrentBlockNum:       p.CurrentBlockNum,
+				TickIndex:             int32(t.TickIndex),
+				LiquidityGross:        t.LiquidityGross.String(),
+				LiquidityNet:          t.LiquidityNet.String(),
+				FeeGrowthOutside0X128: t.FeeGrowthOutside0X128.String(),
+				FeeGrowthOutside1X128: t.FeeGrowthOutside1X128.String(),
+			})
+		}
+		for _, pos := range p.Positions {
+			positions = append(positions, positionRow{
+				PoolAddress:              p.PoolAddress,
+				CurrentBlockNum:          p.CurrentBlockNum,
+				Owner:                    pos.Owner,
+				TickLower:                int32(pos.TickLower),
+				TickUpper:                int32(pos.TickUpper),
+				Liquidity:                pos.Liquidity.String(),
+				FeeGrowthInside0LastX128: pos.FeeGrowthInside0LastX128.String(),
+				FeeGrowthInside1LastX128: pos.FeeGrowthInside1LastX128.String(),
+				TokensOwed0:              pos.TokensOwed0.String(),
+				TokensOwed1:              pos.TokensOwed1.String(),
+			})
+		}
+	}
+	err := writeParquetFile(filepath.Join(e.Dir, "pools.parquet"), pools)
+	if err != nil {
+		return err
+	}
+	err = writeParquetFile(filepath.Join(e.Dir, "ticks.parquet"), ticks)
+	if err != nil {
+		return err
+	}
+	return writeParquetFile(filepath.Join(e.Dir, "positions.parquet"), positions)
+}
+
+func writeParquetFile[T any](path string, rows []T) error {
+	return writeFile(path, func(w io.Writer) error {
+		return parquet.Write(w, rows)
+	})
+}
+
+func writeCSVFile(path string, header []string, rows func(w *csv.Writer) error) error {
+	return writeFile(path, func(f io.Writer) error {
+		w := csv.NewWriter(f)
+		err := w.Write(header)
+		if err != nil {
+			return err
+		}
+		err = rows(w)
+		if err != nil {
+			return err
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
+
+// 先写临时文件再rename, 避免读到写了一半的导出
+func writeFile(path string, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (pm *Simulator) Export(dir string, formats ...ExportFormat) error {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return NewExporter(dir, formats...).Export(pm.Pools)
+}
@@ -0,0 +1,97 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/parquet-go/parquet-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPool(t *testing.T) *CorePool {
+	pool := NewCorePoolFromConfig("0x8ad599c3A0ff1De082011EFDDc58f1908eb6e6D8", *NewPoolConfig(
+		60,
+		common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"),
+		common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"),
+		FeeAmount(3000),
+	))
+	assert.NoError(t, pool.Initialize(Q96))
+	liquidity := decimal.NewFromInt(1e18)
+	_, _, err := pool.Mint("0xc36442b4a4522e871399cd717abdd847ab11fe88", -120, 120, liquidity)
+	assert.NoError(t, err)
+	_, _, err = pool.Mint("0xc36442b4a4522e871399cd717abdd847ab11fe88", -600, 60, liquidity)
+	assert.NoError(t, err)
+	_, _, _, err = pool.HandleSwap(true, decimal.NewFromInt(1e16), nil, false)
+	assert.NoError(t, err)
+	return pool
+}
+
+func TestPoolExport_JSONRoundTrip(t *testing.T) {
+	pool := newTestPool(t)
+	var buf bytes.Buffer
+	assert.NoError(t, WritePoolJSON(&buf, pool))
+
+	imported, err := ReadPoolJSON(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, pool.PoolAddress, imported.PoolAddress)
+	assert.True(t, pool.SqrtPriceX96.Equal(imported.SqrtPriceX96))
+	assert.True(t, pool.Liquidity.Equal(imported.Liquidity))
+	assert.True(t, pool.FeeGrowthGlobal0X128.Equal(imported.FeeGrowthGlobal0X128))
+	assert.Equal(t, pool.TickCurrent, imported.TickCurrent)
+	assert.Equal(t, len(pool.TickManager.GetSortedTicks()), len(imported.TickManager.GetSortedTicks()))
+	assert.Equal(t, pool.PositionManager.Len(), imported.PositionManager.Len())
+
+	// 导入的pool可以继续执行swap并得到相同结果
+	a0, a1, price, err := pool.HandleSwap(false, decimal.NewFromInt(1e15), nil, true)
+	assert.NoError(t, err)
+	b0, b1, importedPrice, err := imported.HandleSwap(false, decimal.NewFromInt(1e15), nil, true)
+	assert.NoError(t, err)
+	assert.True(t, a0.Equal(b0))
+	assert.True(t, a1.Equal(b1))
+	assert.True(t, price.Equal(importedPrice))
+}
+
+func TestExporter_Export(t *testing.T) {
+	pool := newTestPool(t)
+	dir := t.TempDir()
+	pools := map[common.Address]*CorePool{common.HexToAddress(pool.PoolAddress): pool}
+	assert.NoError(t, NewExporter(dir).Export(pools))
+
+	f, err := os.Open(filepath.Join(dir, "ticks.csv"))
+	assert.NoError(t, err)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, tickCSVHeader, rows[0])
+	assert.Len(t, rows, 1+len(pool.TickManager.GetSortedTicks()))
+
+	for _, name := range []string{"pools.csv", "positions.csv"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err, name)
+	}
+	poolRows, err := parquet.ReadFile[poolRow](filepath.Join(dir, "pools.parquet"))
+	assert.NoError(t, err)
+	assert.Len(t, poolRows, 1)
+	assert.Equal(t, pool.PoolAddress, poolRows[0].PoolAddress)
+	assert.Equal(t, pool.SqrtPriceX96.String(), poolRows[0].SqrtPriceX96)
+	assert.Equal(t, pool.Liquidity.String(), poolRows[0].Liquidity)
+	tickRows, err := parquet.ReadFile[tickRow](filepath.Join(dir, "ticks.parquet"))
+	assert.NoError(t, err)
+	assert.Len(t, tickRows, len(pool.TickManager.GetSortedTicks()))
+	positionRows, err := parquet.ReadFile[positionRow](filepath.Join(dir, "positions.parquet"))
+	assert.NoError(t, err)
+	assert.Len(t, positionRows, pool.PositionManager.Len())
+	// 临时文件都已rename
+	tmp, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.NoError(t, err)
+	assert.Len(t, tmp, 0)
+
+	imported, err := ImportPoolsJSON(dir)
+	assert.NoError(t, err)
+	assert.Len(t, imported, 1)
+}
@@ -0,0 +1,253 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+var ErrForkConflict = errors.New("parent pool changed since fork")
+
+type ValueChange struct {
+	Before decimal.Decimal `json:"before"`
+	After  decimal.Decimal `json:"after"`
+}
+
+type Slot0Change struct {
+	Before Slot0Export `json:"before"`
+	After  Slot0Export `json:"after"`
+}
+
+// Before为nil表示新增, After为nil表示删除
+type TickChange struct {
+	TickIndex int         `json:"tick_index"`
+	Before    *TickExport `json:"before"`
+	After     *TickExport `json:"after"`
+}
+
+type PositionChange struct {
+	Owner     string          `json:"owner"`
+	TickLower int             `json:"tick_lower"`
+	TickUpper int             `json:"tick_upper"`
+	Before    *PositionExport `json:"before"`
+	After     *PositionExport `json:"after"`
+}
+
+type PoolDiff struct {
+	PoolAddress          string           `json:"pool_address"`
+	Created              bool             `json:"created"` // fork中新初始化的pool
+	Slot0                *Slot0Change     `json:"slot0,omitempty"`
+	Liquidity            *ValueChange     `json:"liquidity,omitempty"`
+	FeeGrowthGlobal0X128 *ValueChange     `json:"fee_growth_global0_x128,omitempty"`
+	FeeGrowthGlobal1X128 *ValueChange     `json:"fee_growth_global1_x128,omitempty"`
+	Ticks                []TickChange     `json:"ticks,omitempty"`
+	Positions            []PositionChange `json:"positions,omitempty"`
+}
+
+func (d *PoolDiff) Empty() bool {
+	return !d.Created && d.Slot0 == nil && d.Liquidity == nil && d.FeeGrowthGlobal0X128 == nil &&
+		d.FeeGrowthGlobal1X128 == nil && len(d.Ticks) == 0 && len(d.Positions) == 0
+}
+
+type ForkDiff struct {
+	Pools []*PoolDiff `json:"pools"`
+}
+
+// 比较同一个pool的两个状态, before为nil时视为新建的空pool
+func DiffPools(before, after *CorePool) *PoolDiff {
+	diff := &PoolDiff{PoolAddress: after.PoolAddress}
+	if before == nil {
+		diff.Created = true
+		before = NewCorePoolFromConfig(after.PoolAddress, PoolConfig{TickSpacing: int64(after.TickSpacing), Fee: after.Fee})
+	}
+	if !before.SqrtPriceX96.Equal(after.SqrtPriceX96) || before.TickCurrent != after.TickCurrent {
+		diff.Slot0 = &Slot0Change{
+			Before: Slot0Export{SqrtPriceX96: before.SqrtPriceX96, Tick: before.TickCurrent},
+			After:  Slot0Export{SqrtPriceX96: after.SqrtPriceX96, Tick: after.TickCurrent},
+		}
+	}
+	diff.Liquidity = diffValue(before.Liquidity, after.Liquidity)
+	diff.FeeGrowthGlobal0X128 = diffValue(before.FeeGrowthGlobal0X128, after.FeeGrowthGlobal0X128)
+	diff.FeeGrowthGlobal1X128 = diffValue(before.FeeGrowthGlobal1X128, after.FeeGrowthGlobal1X128)
+	diff.Ticks = diffTicks(before.TickManager.GetSortedTicks(), after.TickManager.GetSortedTicks())
+	diff.Positions = diffPositions(before.PositionManager, after.PositionManager)
+	return diff
+}
+
+func diffValue(before, after decimal.Decimal) *ValueChange {
+	if before.Equal(after) {
+		return nil
+	}
+	return &ValueChange{Before: before, After: after}
+}
+
+func tickEqual(a, b *Tick) bool {
+	return a == b || (a.LiquidityGross.Equal(b.LiquidityGross) && a.LiquidityNet.Equal(b.LiquidityNet) &&
+		a.FeeGrowthOutside0X128.Equal(b.FeeGrowthOutside0X128) && a.FeeGrowthOutside1X128.Equal(b.FeeGrowthOutside1X128))
+}
+
+func newTickExport(t *Tick) *TickExport {
+	return &TickExport{
+		TickIndex:             t.TickIndex,
+		LiquidityGross:        t.LiquidityGross,
+		LiquidityNet:          t.LiquidityNet,
+		FeeGrowthOutside0X128: t.FeeGrowthOutside0X128,
+		FeeGrowthOutside1X128: t.FeeGrowthOutside1X128,
+	}
+}
+
+// 两个有序tick列表的归并比较, 未修改的tick与parent共享同一个指针
+func diffTicks(before, after []*Tick) []TickChange {
+	var changes []TickChange
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || (i < len(before) && before[i].TickIndex < after[j].TickIndex):
+			changes = append(changes, TickChange{TickIndex: before[i].TickIndex, Before: newTickExport(before[i])})
+			i++
+		case i == len(before) || after[j].TickIndex < before[i].TickIndex:
+			changes = append(changes, TickChange{TickIndex: after[j].TickIndex, After: newTickExport(after[j])})
+			j++
+		default:
+			if !tickEqual(before[i], after[j]) {
+				changes = append(changes, TickChange{TickIndex: after[j].TickIndex, Before: newTickExport(before[i]), After: newTickExport(after[j])})
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+type keyedPosition struct {
+	key      string
+	position *Position
+}
+
+func sortedPositions(pm *PositionManager) []keyedPosition {
+	result := make([]keyedPosition, 0, pm.Len())
+	pm.Ascend(func(key string, position *Position) bool {
+		result = append(result, keyedPosition{key: key, position: position})
+		return true
+	})
+	return result
+}
+
+func positionEqual(a, b *Position) bool {
+	return a == b || (a.Liquidity.Equal(b.Liquidity) && a.FeeGrowthInside0LastX128.Equal(b.FeeGrowthInside0LastX128) &&
+		a.FeeGrowthInside1LastX128.Equal(b.FeeGrowthInside1LastX128) && a.TokensOwed0.Equal(b.TokensOwed0) &&
+		a.TokensOwed1.Equal(b.TokensOwed1))
+}
+
+func newPositionChange(key string, before, after *Position) PositionChange {
+	owner, tickLower, tickUpper, _ := ParsePositionKey(key)
+	change := PositionChange{Owner: owner, TickLower: tickLower, TickUpper: tickUpper}
+	export := func(p *Position) *PositionExport {
+		return &PositionExport{
+			Owner:                    owner,
+			TickLower:                tickLower,
+			TickUpper:                tickUpper,
+			Liquidity:                p.Liquidity,
+			FeeGrowthInside0LastX128: p.FeeGrowthInside0LastX128,
+			FeeGrowthInside1LastX128: p.FeeGrowthInside1LastX128,
+			TokensOwed0:              p.TokensOwed0,
+			TokensOwed1:              p.TokensOwed1,
+		}
+	}
+	if before != nil {
+		change.Before = export(before)
+	}
+	if after != nil {
+		change.After = export(after)
+	}
+	return change
+}
+
+func diffPositions(beforeManager, afterManager *PositionManager) []PositionChange {
+	before := sortedPositions(beforeManager)
+	after := sortedPositions(afterManager)
+	var changes []PositionChange
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || (i < len(before) && before[i].key < after[j].key):
+			changes = append(changes, newPositionChange(before[i].key, before[i].position, nil))
+			i++
+		case i == len(before) || after[j].key < before[i].key:
+			changes = append(changes, newPositionChange(after[j].key, nil, after[j].position))
+			j++
+		default:
+			if !positionEqual(before[i].position, after[j].position) {
+				changes = append(changes, newPositionChange(after[j].key, before[i].position, after[j].position))
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+func (s *SimulatorFork) sortedAddresses() []common.Address {
+	addresses := make([]common.Address, 0, len(s.Pools))
+	for addr := range s.Pools {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	return addresses
+}
+
+// fork相对parent(或Simulator)的变更, 只包含有变化的pool
+func (s *SimulatorFork) Diff() *ForkDiff {
+	s.simulator.lock.RLock()
+	defer s.simulator.lock.RUnlock()
+	return s.diff()
+}
+
+func (s *SimulatorFork) diff() *ForkDiff {
+	diff := &ForkDiff{Pools: []*PoolDiff{}}
+	for _, addr := range s.sortedAddresses() {
+		poolDiff := DiffPools(s.parentPool(addr), s.Pools[addr])
+		if !poolDiff.Empty() {
+			diff.Pools = append(diff.Pools, poolDiff)
+		}
+	}
+	return diff
+}
+
+// 把fork中有变化的pool应用到parent(或Simulator).
+// parent中的pool在分叉之后被修改过时返回ErrForkConflict, 不做任何修改
+func (s *SimulatorFork) Commit() error {
+	// 检查冲突和写入期间不允许同步修改Simulator
+	s.simulator.lock.Lock()
+	defer s.simulator.lock.Unlock()
+	diff := s.diff()
+	for _, poolDiff := range diff.Pools {
+		addr := common.HexToAddress(poolDiff.PoolAddress)
+		parent := s.parentPool(addr)
+		if poolDiff.Created {
+			if parent != nil {
+				return fmt.Errorf("%w: %s initialized in parent", ErrForkConflict, addr)
+			}
+		} else if parent == nil || parent.Version() != s.baseVersions[addr] {
+			return fmt.Errorf("%w: %s", ErrForkConflict, addr)
+		}
+	}
+	for _, poolDiff := range diff.Pools {
+		addr := common.HexToAddress(poolDiff.PoolAddress)
+		pool := s.Pools[addr]
+		committed := pool.Fork()
+		if s.parent != nil {
+			s.parent.Pools[addr] = committed
+		} else {
+			s.simulator.replacePool(committed)
+		}
+		s.baseVersions[addr] = pool.Version()
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package uniswap_v3_simulator
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFork_NestedDiffAndCommit(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	priceBefore := pool.SqrtPriceX96
+
+	root := NewSimulatorSnapshot(pm)
+	child := root.Fork()
+	childPool, err := child.GetPool(addr)
+	assert.NoError(t, err)
+	_, _, _, err = childPool.HandleSwap(false, decimal.NewFromInt(1e16), nil, false)
+	assert.NoError(t, err)
+	_, _, err = childPool.Mint("0x3333333333333333333333333333333333333333", -60, 600, decimal.NewFromInt(1e17))
+	assert.NoError(t, err)
+
+	// 子fork的修改不影响parent
+	rootPool, err := root.GetPool(addr)
+	assert.NoError(t, err)
+	assert.True(t, rootPool.SqrtPriceX96.Equal(priceBefore))
+	assert.Empty(t, root.Diff().Pools)
+
+	diff := child.Diff()
+	assert.Len(t, diff.Pools, 1)
+	assert.NotNil(t, diff.Pools[0].Slot0)
+	assert.Len(t, diff.Pools[0].Positions, 1)
+	assert.Nil(t, diff.Pools[0].Positions[0].Before)
+	assert.Equal(t, 600, diff.Pools[0].Ticks[len(diff.Pools[0].Ticks)-1].TickIndex)
+
+	assert.NoError(t, child.Commit())
+	assert.Len(t, root.Diff().Pools, 1)
+	assert.True(t, pm.Pools[addr].SqrtPriceX96.Equal(priceBefore))
+
+	assert.NoError(t, root.Commit())
+	assert.True(t, pm.Pools[addr].SqrtPriceX96.Equal(childPool.SqrtPriceX96))
+	assert.Contains(t, pm.dirtyPools, pool.PoolAddress)
+}
+
+func TestSimulatorFork_CommitConflict(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+
+	fork := NewSimulatorSnapshot(pm)
+	forkPool, err := fork.GetPool(addr)
+	assert.NoError(t, err)
+	_, _, _, err = forkPool.HandleSwap(true, decimal.NewFromInt(1e15), nil, false)
+	assert.NoError(t, err)
+
+	_, _, _, err = pool.HandleSwap(false, decimal.NewFromInt(1e15), nil, false)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(fork.Commit(), ErrForkConflict))
+}
+
+// 同步和应用日志的同时fork/报价/提交, 需要在-race下运行
+func TestSimulator_ForkPoolWithReadLock(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	// 其它读者持有读锁时仍然可以分叉
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := pm.ForkPool(addr)
+		assert.NoError(t, err)
+		_, _, err = pm.Snapshot(addr)
+		assert.NoError(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fork blocked by a reader")
+	}
+}
+
+func TestSimulator_ForkDuringSync(t *testing.T) {
+	initial, logs := testInterleavedLogs(t, 2, 200)
+	_, url := newFakeLogRPC(t, 1000, false)
+	pm := NewPoolManager(filepath.Join(t.TempDir(), "simulator.db"), url, 0)
+	reference := newTestSimulator(t, "")
+	for addr, pool := range initial {
+		pm.Pools[addr] = pool.Clone()
+		reference.Pools[addr] = pool.Clone()
+	}
+	assert.NoError(t, reference.HandleLogs(logs))
+	// 只由fork提交修改的pool
+	committed := newTestPool(t)
+	committed.PoolAddress = "0x3333333333333333333333333333333333333333"
+	committedAddr := common.HexToAddress(committed.PoolAddress)
+	pm.Pools[committedAddr] = committed
+
+	var writers, readers sync.WaitGroup
+	stop := make(chan struct{})
+	writers.Add(2)
+	go func() {
+		defer writers.Done()
+		_, err := pm.SyncBlocks(500, 9)
+		assert.NoError(t, err)
+	}()
+	go func() {
+		defer writers.Done()
+		for i := 0; i < len(logs); i += 4 {
+			assert.NoError(t, pm.HandleLogs(logs[i:i+4]))
+		}
+	}()
+	for addr := range initial {
+		readers.Add(1)
+		go func(addr common.Address) {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				pool, err := pm.ForkPool(addr)
+				assert.NoError(t, err)
+				_, _, _, err = pool.HandleSwap(true, decimal.NewFromInt(1e12), nil, false)
+				assert.NoError(t, err)
+				fork := NewSimulatorSnapshot(pm)
+				_, err = fork.GetPool(addr)
+				assert.NoError(t, err)
+				fork.Diff()
+				pm.CurrentBlock()
+			}
+		}(addr)
+	}
+	commits := 0
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			fork := NewSimulatorSnapshot(pm)
+			pool, err := fork.GetPool(committedAddr)
+			assert.NoError(t, err)
+			_, _, _, err = pool.HandleSwap(commits%2 == 0, decimal.NewFromInt(1e12), nil, false)
+			assert.NoError(t, err)
+			assert.NoError(t, fork.Commit())
+			commits++
+		}
+	}()
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	assert.Equal(t, uint64(500), pm.CurrentBlock())
+	for addr, pool := range reference.Pools {
+		assert.True(t, DiffPools(pool, pm.Pools[addr]).Empty(), "pool %s differs", addr)
+	}
+	expected := newTestPool(t)
+	for i := 0; i < commits; i++ {
+		_, _, _, err := expected.HandleSwap(i%2 == 0, decimal.NewFromInt(1e12), nil, false)
+		assert.NoError(t, err)
+	}
+	assert.True(t, expected.SqrtPriceX96.Equal(pm.Pools[committedAddr].SqrtPriceX96))
+}
@@ -0,0 +1,386 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/CoinSummer/uniswap-v3-simulator/simulatorpb"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 每个订阅缓冲的事件数, 满了以后订阅以RESOURCE_EXHAUSTED结束
+const streamBufferSize = 4096
+
+// simulatorpb.SimulatorServer的实现, 和HTTP接口共用API
+type GRPCServer struct {
+	simulatorpb.UnimplementedSimulatorServer
+	api *API
+}
+
+func NewGRPCServer(api *API) *GRPCServer {
+	return &GRPCServer{api: api}
+}
+
+// 在addr上提供gRPC服务, 直到ctx取消
+func (a *API) ServeGRPC(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	simulatorpb.RegisterSimulatorServer(server, NewGRPCServer(a))
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	logrus.Infof("serve grpc on %s", addr)
+	return server.Serve(listener)
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrPoolNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidRequest):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func parseRequestAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("%w: invalid address %q", ErrInvalidRequest, s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+func parseRequestDecimal(name, s string) (decimal.Decimal, error) {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return d, fmt.Errorf("%w: invalid %s %q", ErrInvalidRequest, name, s)
+	}
+	return d, nil
+}
+
+// 为空时返回nil
+func parseOptionalDecimal(name, s string) (*decimal.Decimal, error) {
+	if s == "" {
+		return nil, nil
+	}
+	d, err := parseRequestDecimal(name, s)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func pbSlot0(slot0 Slot0Export) *simulatorpb.Slot0 {
+	return &simulatorpb.Slot0{SqrtPriceX96: slot0.SqrtPriceX96.String(), Tick: int32(slot0.Tick)}
+}
+
+func pbPoolState(state *PoolState) *simulatorpb.PoolState {
+	return &simulatorpb.PoolState{
+		PoolAddress:          state.PoolAddress,
+		Block:                state.Block,
+		Token0:               state.Token0,
+		Token1:               state.Token1,
+		Fee:                  uint32(state.Fee),
+		TickSpacing:          int32(state.TickSpacing),
+		Slot0:                pbSlot0(state.Slot0),
+		Liquidity:            state.Liquidity.String(),
+		FeeGrowthGlobal0X128: state.FeeGrowthGlobal0X128.String(),
+		FeeGrowthGlobal1X128: state.FeeGrowthGlobal1X128.String(),
+	}
+}
+
+func pbTick(tick *TickExport) *simulatorpb.Tick {
+	return &simulatorpb.Tick{
+		TickIndex:             int32(tick.TickIndex),
+		LiquidityGross:        tick.LiquidityGross.String(),
+		LiquidityNet:          tick.LiquidityNet.String(),
+		FeeGrowthOutside0X128: tick.FeeGrowthOutside0X128.String(),
+		FeeGrowthOutside1X128: tick.FeeGrowthOutside1X128.String(),
+	}
+}
+
+func pbPosition(position *PositionExport) *simulatorpb.Position {
+	return &simulatorpb.Position{
+		Owner:                    position.Owner,
+		TickLower:                int32(position.TickLower),
+		TickUpper:                int32(position.TickUpper),
+		Liquidity:                position.Liquidity.String(),
+		FeeGrowthInside0LastX128: position.FeeGrowthInside0LastX128.String(),
+		FeeGrowthInside1LastX128: position.FeeGrowthInside1LastX128.String(),
+		TokensOwed0:              position.TokensOwed0.String(),
+		TokensOwed1:              position.TokensOwed1.String(),
+	}
+}
+
+func pbGetPoolResponse(pool *CorePool, block uint64, ticks, positions bool) (*simulatorpb.GetPoolResponse, error) {
+	resp := &simulatorpb.GetPoolResponse{State: pbPoolState(newPoolState(pool, block))}
+	if !ticks && !positions {
+		return resp, nil
+	}
+	export, err := NewPoolExport(pool)
+	if err != nil {
+		return nil, err
+	}
+	if ticks {
+		for i := range export.Ticks {
+			resp.Ticks = append(resp.Ticks, pbTick(&export.Ticks[i]))
+		}
+	}
+	if positions {
+		for i := range export.Positions {
+			resp.Positions = append(resp.Positions, pbPosition(&export.Positions[i]))
+		}
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) GetPool(ctx context.Context, req *simulatorpb.GetPoolRequest) (*simulatorpb.GetPoolResponse, error) {
+	addr, err := parseRequestAddress(req.Pool)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	pool, block, err := s.api.forkPool(addr)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp, err := pbGetPoolResponse(pool, block, req.IncludeTicks, req.IncludePositions)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) Quote(ctx context.Context, req *simulatorpb.QuoteRequest) (*simulatorpb.QuoteResponse, error) {
+	quote := &QuoteRequest{ZeroForOne: req.ZeroForOne, ExactOutput: req.ExactOutput}
+	var err error
+	quote.Pool, err = parseRequestAddress(req.Pool)
+	if err == nil {
+		quote.Amount, err = parseRequestDecimal("amount", req.Amount)
+	}
+	if err == nil {
+		quote.SqrtPriceLimitX96, err = parseOptionalDecimal("sqrt_price_limit_x96", req.SqrtPriceLimitX96)
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp, err := s.api.Quote(quote)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &simulatorpb.QuoteResponse{
+		Block:                   resp.Block,
+		AmountIn:                resp.AmountIn.String(),
+		AmountOut:               resp.AmountOut.String(),
+		Amount0:                 resp.Amount0.String(),
+		Amount1:                 resp.Amount1.String(),
+		SqrtPriceX96After:       resp.SqrtPriceX96After.String(),
+		TickAfter:               int32(resp.TickAfter),
+		LiquidityAfter:          resp.LiquidityAfter.String(),
+		InitializedTicksCrossed: uint32(resp.InitializedTicksCrossed),
+	}, nil
+}
+
+var pbActionTypes = map[simulatorpb.ActionType]ActionType{
+	simulatorpb.ActionType_ACTION_TYPE_SWAP:    ActionSwap,
+	simulatorpb.ActionType_ACTION_TYPE_MINT:    ActionMint,
+	simulatorpb.ActionType_ACTION_TYPE_BURN:    ActionBurn,
+	simulatorpb.ActionType_ACTION_TYPE_COLLECT: ActionCollect,
+	simulatorpb.ActionType_ACTION_TYPE_FLASH:   ActionFlash,
+}
+
+func parseAction(action *simulatorpb.Action) (SimulateAction, error) {
+	result := SimulateAction{
+		ZeroForOne:  action.ZeroForOne,
+		ExactOutput: action.ExactOutput,
+		Owner:       action.Owner,
+		TickLower:   int(action.TickLower),
+		TickUpper:   int(action.TickUpper),
+	}
+	var ok bool
+	result.Type, ok = pbActionTypes[action.Type]
+	if !ok {
+		return result, fmt.Errorf("%w: unknown action type %s", ErrInvalidRequest, action.Type)
+	}
+	var err error
+	result.Pool, err = parseRequestAddress(action.Pool)
+	if err == nil && action.Amount != "" {
+		result.Amount, err = parseRequestDecimal("amount", action.Amount)
+	}
+	if err == nil {
+		result.SqrtPriceLimitX96, err = parseOptionalDecimal("sqrt_price_limit_x96", action.SqrtPriceLimitX96)
+	}
+	if err == nil {
+		result.Amount0Requested, err = parseOptionalDecimal("amount0_requested", action.Amount0Requested)
+	}
+	if err == nil {
+		result.Amount1Requested, err = parseOptionalDecimal("amount1_requested", action.Amount1Requested)
+	}
+	if err == nil {
+		result.Paid0, err = parseOptionalDecimal("paid0", action.Paid0)
+	}
+	if err == nil {
+		result.Paid1, err = parseOptionalDecimal("paid1", action.Paid1)
+	}
+	return result, err
+}
+
+func (s *GRPCServer) SimulateBatch(ctx context.Context, req *simulatorpb.SimulateBatchRequest) (*simulatorpb.SimulateBatchResponse, error) {
+	simulate := &SimulateRequest{}
+	for i, action := range req.Actions {
+		parsed, err := parseAction(action)
+		if err != nil {
+			return nil, grpcError(fmt.Errorf("action %d: %w", i, err))
+		}
+		simulate.Actions = append(simulate.Actions, parsed)
+	}
+	resp, err := s.api.Simulate(simulate)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	result := &simulatorpb.SimulateBatchResponse{Block: resp.Block, Reverted: resp.Reverted}
+	for _, r := range resp.Results {
+		result.Results = append(result.Results, &simulatorpb.ActionResult{
+			Amount0:  r.Amount0.String(),
+			Amount1:  r.Amount1.String(),
+			Reverted: r.Reverted,
+			Revert:   r.Revert,
+		})
+	}
+	for _, state := range resp.Pools {
+		result.Pools = append(result.Pools, pbPoolState(state))
+	}
+	return result, nil
+}
+
+// 只转发订阅的pool的事件, 避免无关事件占满缓冲
+type poolFilterObserver struct {
+	pools map[common.Address]bool // nil时不过滤
+	out   *ChannelObserver
+}
+
+func (o *poolFilterObserver) OnPoolEvent(event *PoolEvent) {
+	if o.pools == nil || o.pools[event.Pool] {
+		o.out.OnPoolEvent(event)
+	}
+}
+
+func pbPoolEvent(event *PoolEvent) *simulatorpb.PoolEvent {
+	e := &simulatorpb.PoolEvent{
+		Event:           event.Event,
+		TxHash:          event.TxHash.String(),
+		LogIndex:        uint64(event.LogIndex),
+		Block:           event.BlockNum,
+		Before:          pbSlot0(event.Before),
+		LiquidityBefore: event.Liquidity.Before.String(),
+	}
+	if event.Record != nil {
+		e.Owner = event.Record.Owner
+		e.Params = event.Record.Params
+		e.Amount0 = event.Record.Amount0.String()
+		e.Amount1 = event.Record.Amount1.String()
+	}
+	return e
+}
+
+// 副本在上一次状态上应用的变化
+func pbDiff(update *simulatorpb.PoolUpdate, diff *PoolDiff) {
+	for _, change := range diff.Ticks {
+		tick := &simulatorpb.TickChange{TickIndex: int32(change.TickIndex)}
+		if change.After != nil {
+			tick.After = pbTick(change.After)
+		}
+		update.Ticks = append(update.Ticks, tick)
+	}
+	for _, change := range diff.Positions {
+		position := &simulatorpb.PositionChange{Owner: change.Owner, TickLower: int32(change.TickLower), TickUpper: int32(change.TickUpper)}
+		if change.After != nil {
+			position.After = pbPosition(change.After)
+		}
+		update.Positions = append(update.Positions, position)
+	}
+}
+
+func (s *GRPCServer) StreamPoolUpdates(req *simulatorpb.StreamPoolUpdatesRequest, stream simulatorpb.Simulator_StreamPoolUpdatesServer) error {
+	observer := &poolFilterObserver{out: NewChannelObserver(streamBufferSize)}
+	var addresses []common.Address
+	if len(req.Pools) > 0 {
+		observer.pools = map[common.Address]bool{}
+		for _, pool := range req.Pools {
+			addr, err := parseRequestAddress(pool)
+			if err != nil {
+				return grpcError(err)
+			}
+			observer.pools[addr] = true
+			addresses = append(addresses, addr)
+		}
+	}
+	pm := s.api.simulator
+	// 上一次发送的状态, 用来计算tick/position的变化
+	last := map[common.Address]*CorePool{}
+	if req.Snapshot {
+		fork, block, id, err := pm.ObserveFromSnapshot(observer, addresses...)
+		if err != nil {
+			return grpcError(err)
+		}
+		defer pm.RemoveObserver(id)
+		addresses = addresses[:0]
+		for addr := range fork.Pools {
+			addresses = append(addresses, addr)
+		}
+		sort.Slice(addresses, func(i, j int) bool {
+			return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+		})
+		for _, addr := range addresses {
+			pool := fork.Pools[addr]
+			snapshot, err := pbGetPoolResponse(pool, block, true, true)
+			if err != nil {
+				return grpcError(err)
+			}
+			err = stream.Send(&simulatorpb.PoolUpdate{Pool: pool.PoolAddress, Snapshot: snapshot})
+			if err != nil {
+				return err
+			}
+			last[addr] = pool
+		}
+	} else {
+		defer pm.RemoveObserver(pm.AddObserver(observer))
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case event := <-observer.out.C:
+			if observer.out.Dropped() > 0 {
+				return status.Error(codes.ResourceExhausted, "subscriber too slow, events dropped")
+			}
+			update := &simulatorpb.PoolUpdate{
+				Pool:  event.State.PoolAddress,
+				Event: pbPoolEvent(event),
+				State: pbPoolState(newPoolState(event.State, event.BlockNum)),
+			}
+			if req.Snapshot {
+				// 订阅之后新初始化的pool相对空pool计算
+				pbDiff(update, DiffPools(last[event.Pool], event.State))
+				last[event.Pool] = event.State
+			}
+			err := stream.Send(update)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CoinSummer/uniswap-v3-simulator/simulatorpb"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestGRPCClient(t *testing.T) (simulatorpb.SimulatorClient, *Simulator, *CorePool) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	pm.Pools[common.HexToAddress(pool.PoolAddress)] = pool
+	pm.currentBlock = 100
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	simulatorpb.RegisterSimulatorServer(server, NewGRPCServer(NewAPI(pm)))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return simulatorpb.NewSimulatorClient(conn), pm, pool
+}
+
+func TestGRPC_GetPoolAndQuote(t *testing.T) {
+	client, _, pool := newTestGRPCClient(t)
+	ctx := context.Background()
+
+	resp, err := client.GetPool(ctx, &simulatorpb.GetPoolRequest{Pool: pool.PoolAddress, IncludeTicks: true, IncludePositions: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), resp.State.Block)
+	assert.Equal(t, pool.SqrtPriceX96.String(), resp.State.Slot0.SqrtPriceX96)
+	assert.Equal(t, pool.Liquidity.String(), resp.State.Liquidity)
+	assert.Len(t, resp.Ticks, 4)
+	assert.Len(t, resp.Positions, 2)
+
+	_, err = client.GetPool(ctx, &simulatorpb.GetPoolRequest{Pool: "0x0000000000000000000000000000000000000001"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	quote, err := client.Quote(ctx, &simulatorpb.QuoteRequest{Pool: pool.PoolAddress, ZeroForOne: true, Amount: "1000000000000000"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1000000000000000", quote.AmountIn)
+	_, err = client.Quote(ctx, &simulatorpb.QuoteRequest{Pool: pool.PoolAddress, Amount: "abc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPC_SimulateBatch(t *testing.T) {
+	client, _, pool := newTestGRPCClient(t)
+	ctx := context.Background()
+	owner := "0x1111111111111111111111111111111111111111"
+
+	resp, err := client.SimulateBatch(ctx, &simulatorpb.SimulateBatchRequest{Actions: []*simulatorpb.Action{
+		{Type: simulatorpb.ActionType_ACTION_TYPE_MINT, Pool: pool.PoolAddress, Owner: owner, TickLower: -600, TickUpper: 600, Amount: "100000000000000000"},
+		{Type: simulatorpb.ActionType_ACTION_TYPE_SWAP, Pool: pool.PoolAddress, Amount: "1000000000000000"},
+		{Type: simulatorpb.ActionType_ACTION_TYPE_COLLECT, Pool: pool.PoolAddress, Owner: owner, TickLower: -600, TickUpper: 600},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Results, 3)
+	assert.Len(t, resp.Pools, 1)
+	assert.NotEqual(t, pool.Liquidity.String(), resp.Pools[0].Liquidity)
+
+	resp, err = client.SimulateBatch(ctx, &simulatorpb.SimulateBatchRequest{Actions: []*simulatorpb.Action{
+		{Type: simulatorpb.ActionType_ACTION_TYPE_FLASH, Pool: pool.PoolAddress, Amount0Requested: "1000000", Paid0: "3000"},
+		{Type: simulatorpb.ActionType_ACTION_TYPE_BURN, Pool: pool.PoolAddress, Owner: owner, TickLower: -600, TickUpper: 600, Amount: "1"},
+	}})
+	assert.NoError(t, err)
+	assert.True(t, resp.Reverted)
+	assert.Len(t, resp.Results, 2)
+	assert.Equal(t, "3000", resp.Results[0].Amount0)
+	assert.Equal(t, "LS", resp.Results[1].Revert)
+	// revert时pool为分叉时的状态
+	assert.Equal(t, pool.FeeGrowthGlobal0X128.String(), resp.Pools[0].FeeGrowthGlobal0X128)
+	_, err = client.SimulateBatch(ctx, &simulatorpb.SimulateBatchRequest{Actions: []*simulatorpb.Action{{Pool: pool.PoolAddress}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPC_StreamPoolUpdates(t *testing.T) {
+	client, pm, pool := newTestGRPCClient(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.StreamPoolUpdates(ctx, &simulatorpb.StreamPoolUpdatesRequest{Pools: []string{pool.PoolAddress}, Snapshot: true})
+	assert.NoError(t, err)
+	update, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.NotNil(t, update.Snapshot)
+	assert.Len(t, update.Snapshot.Ticks, 4)
+	liquidity := pool.Liquidity
+
+	// 收到快照之后已经订阅
+	owner := "0x1111111111111111111111111111111111111111"
+	assert.NoError(t, pm.HandleLogs([]types.Log{testMintLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 101, 0)}))
+	update, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Nil(t, update.Snapshot)
+	assert.Equal(t, "mint", update.Event.Event)
+	assert.Equal(t, uint64(101), update.Event.Block)
+	assert.Equal(t, liquidity.String(), update.Event.LiquidityBefore)
+	assert.Equal(t, owner, update.Event.Owner)
+	assert.Len(t, update.Ticks, 2)
+	assert.Len(t, update.Positions, 1)
+	assert.Equal(t, "100000000000000000", update.Positions[0].After.Liquidity)
+
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	// 订阅结束后移除observer
+	assert.Eventually(t, func() bool {
+		pm.lock.RLock()
+		defer pm.lock.RUnlock()
+		return len(pm.observers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
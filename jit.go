@@ -0,0 +1,239 @@
+package uniswap_v3_simulator
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// 同一区块同一pool中, 同一owner在其它交易的swap前mint, 之后burn同一个tick范围
+type JITLiquidity struct {
+	Id           string `gorm:"primarykey"` // mint的txHash_logIndex
+	PoolAddress  string `gorm:"index:idx_jit_pool_block"`
+	BlockNum     uint64 `gorm:"index:idx_jit_pool_block"`
+	Owner        string `gorm:"index"`
+	TickLower    int
+	TickUpper    int
+	Liquidity    decimal.Decimal // mint的流动性
+	MintTxHash   string
+	MintLogIndex uint
+	BurnTxHash   string
+	BurnLogIndex uint
+	Swaps        int // mint和burn之间其它交易的swap数量
+	// JIT流动性在mint和burn之间获得的手续费
+	Fees0 decimal.Decimal
+	Fees1 decimal.Decimal
+	// mint之前已有且与JIT范围重叠的position获得的手续费
+	PassiveFees0 decimal.Decimal
+	PassiveFees1 decimal.Decimal
+	// 去掉mint和burn重放得到的已有position手续费, Replayed为false时为0
+	PassiveFeesWithoutJIT0 decimal.Decimal
+	PassiveFeesWithoutJIT1 decimal.Decimal
+	// 有mint之前的状态时才能重放
+	Replayed bool
+}
+
+type jitRange struct {
+	owner     common.Address
+	tickLower int
+	tickUpper int
+}
+
+func recordRange(record *Record) (jitRange, error) {
+	tickLower, err := recordParamInt(record, "tick_lower")
+	if err != nil {
+		return jitRange{}, err
+	}
+	tickUpper, err := recordParamInt(record, "tick_upper")
+	if err != nil {
+		return jitRange{}, err
+	}
+	return jitRange{owner: common.HexToAddress(record.Owner), tickLower: tickLower, tickUpper: tickUpper}, nil
+}
+
+func isAction(event *PoolEvent, action ActionType) bool {
+	return event.Record != nil && event.Record.ActionType == action
+}
+
+// before为events之前的状态, 为nil时不重放. events为同一pool同一区块按日志顺序的事件
+func detectJITLiquidity(before *CorePool, events []*PoolEvent) []*JITLiquidity {
+	found := []*JITLiquidity{}
+	used := map[int]bool{}
+	for i, mint := range events {
+		if !isAction(mint, ActionMint) {
+			continue
+		}
+		r, err := recordRange(mint.Record)
+		if err != nil {
+			logrus.Warnf("failed detect jit liquidity: %s", err)
+			continue
+		}
+		for j := i + 1; j < len(events); j++ {
+			burn := events[j]
+			if !isAction(burn, ActionBurn) || used[j] {
+				continue
+			}
+			if br, err := recordRange(burn.Record); err != nil || br != r {
+				continue
+			}
+			jit := newJITLiquidity(before, events, i, j, r)
+			if jit != nil {
+				found = append(found, jit)
+				used[j] = true
+			}
+			break
+		}
+	}
+	return found
+}
+
+func newJITLiquidity(before *CorePool, events []*PoolEvent, i, j int, r jitRange) *JITLiquidity {
+	mint, burn := events[i], events[j]
+	jit := &JITLiquidity{
+		Id:                     mint.Record.Id,
+		PoolAddress:            mint.Record.PoolAddress,
+		BlockNum:               mint.BlockNum,
+		Owner:                  r.owner.String(),
+		TickLower:              r.tickLower,
+		TickUpper:              r.tickUpper,
+		MintTxHash:             mint.Record.TxHash,
+		MintLogIndex:           mint.LogIndex,
+		BurnTxHash:             burn.Record.TxHash,
+		BurnLogIndex:           burn.LogIndex,
+		Fees0:                  ZERO,
+		Fees1:                  ZERO,
+		PassiveFees0:           ZERO,
+		PassiveFees1:           ZERO,
+		PassiveFeesWithoutJIT0: ZERO,
+		PassiveFeesWithoutJIT1: ZERO,
+	}
+	var err error
+	jit.Liquidity, err = recordParamDecimal(mint.Record, "amount")
+	if err != nil {
+		logrus.Warnf("failed detect jit liquidity: %s", err)
+		return nil
+	}
+	for k := i + 1; k < j; k++ {
+		event := events[k]
+		if isSwap(event) && event.TxHash != mint.TxHash && event.TxHash != burn.TxHash {
+			jit.Swaps++
+		}
+	}
+	if jit.Swaps == 0 {
+		return nil
+	}
+
+	// burn之前JIT范围内每单位流动性的手续费增长, 和burn时记到position上的相同
+	minted, beforeBurn := mint.State, events[j-1].State
+	jit.Fees0, jit.Fees1, err = rangeFees(minted, beforeBurn, r.tickLower, r.tickUpper, jit.Liquidity)
+	if err != nil {
+		logrus.Warnf("failed compute jit fees %s: %s", jit.Id, err)
+		return jit
+	}
+	pre := before
+	if i > 0 {
+		pre = events[i-1].State
+	}
+	if pre == nil {
+		return jit
+	}
+	without := pre.Fork()
+	for k := i + 1; k < j; k++ {
+		if events[k].Record == nil {
+			continue
+		}
+		if _, _, err := replayRecord(without, events[k].Record); err != nil {
+			logrus.Warnf("failed replay %s without jit liquidity %s: %s", events[k].Record.Id, jit.Id, err)
+			return jit
+		}
+	}
+	positions := passivePositions(pre, r)
+	jit.PassiveFees0, jit.PassiveFees1 = positionsFees(pre, beforeBurn, positions)
+	jit.PassiveFeesWithoutJIT0, jit.PassiveFeesWithoutJIT1 = positionsFees(pre, without, positions)
+	jit.Replayed = true
+	return jit
+}
+
+// 流动性为liquidity的范围从from到to的状态之间获得的手续费
+func rangeFees(from, to *CorePool, tickLower, tickUpper int, liquidity decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	before0, before1, err := from.TickManager.GetFeeGrowthInside(tickLower, tickUpper, from.TickCurrent, from.FeeGrowthGlobal0X128, from.FeeGrowthGlobal1X128)
+	if err != nil {
+		return ZERO, ZERO, err
+	}
+	after0, after1, err := to.TickManager.GetFeeGrowthInside(tickLower, tickUpper, to.TickCurrent, to.FeeGrowthGlobal0X128, to.FeeGrowthGlobal1X128)
+	if err != nil {
+		return ZERO, ZERO, err
+	}
+	fees0 := after0.Sub(before0).Mul(liquidity).Div(Q128).RoundDown(0)
+	fees1 := after1.Sub(before1).Mul(liquidity).Div(Q128).RoundDown(0)
+	return fees0, fees1, nil
+}
+
+type passivePosition struct {
+	tickLower int
+	tickUpper int
+	liquidity decimal.Decimal
+}
+
+// pool中有流动性且与r重叠的position, 不含JIT自己的position
+func passivePositions(pool *CorePool, r jitRange) []passivePosition {
+	var positions []passivePosition
+	pool.PositionManager.Ascend(func(key string, position *Position) bool {
+		if !position.Liquidity.IsPositive() {
+			return true
+		}
+		owner, tickLower, tickUpper, err := ParsePositionKey(key)
+		if err != nil || (jitRange{owner: common.HexToAddress(owner), tickLower: tickLower, tickUpper: tickUpper}) == r {
+			return true
+		}
+		if tickLower < r.tickUpper && tickUpper > r.tickLower {
+			positions = append(positions, passivePosition{tickLower: tickLower, tickUpper: tickUpper, liquidity: position.Liquidity})
+		}
+		return true
+	})
+	return positions
+}
+
+// 期间被完全burn的position的tick可能已清除, 跳过
+func positionsFees(from, to *CorePool, positions []passivePosition) (decimal.Decimal, decimal.Decimal) {
+	total0, total1 := ZERO, ZERO
+	for _, position := range positions {
+		fees0, fees1, err := rangeFees(from, to, position.tickLower, position.tickUpper, position.liquidity)
+		if err != nil {
+			continue
+		}
+		total0, total1 = total0.Add(fees0), total1.Add(fees1)
+	}
+	return total0, total1
+}
+
+type JITLiquidityQuery struct {
+	PoolAddress string
+	Owner       string
+	FromBlock   uint64 // 0表示不限制
+	ToBlock     uint64 // 0表示不限制, inclusive
+	Limit       int
+}
+
+// 按区块顺序返回检测到的JIT流动性
+func (pm *Simulator) QueryJITLiquidity(q JITLiquidityQuery) ([]*JITLiquidity, error) {
+	db := pm.db.Model(&JITLiquidity{})
+	if q.PoolAddress != "" {
+		db = db.Where("pool_address = ?", q.PoolAddress)
+	}
+	if q.Owner != "" {
+		db = db.Where("owner = ?", q.Owner)
+	}
+	if q.FromBlock > 0 {
+		db = db.Where("block_num >= ?", q.FromBlock)
+	}
+	if q.ToBlock > 0 {
+		db = db.Where("block_num <= ?", q.ToBlock)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	var found []*JITLiquidity
+	err := db.Order("block_num, mint_log_index").Find(&found).Error
+	return found, err
+}
@@ -0,0 +1,58 @@
+package uniswap_v3_simulator
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMEVAnalyzer_JITLiquidity(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestMEVPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	shadow := pool.Clone()
+
+	// 攻击者在受害者swap前后mint和burn当前价格附近的大额流动性
+	jitLiquidity := decimal.NewFromInt(1e18).Mul(decimal.NewFromInt(1000))
+	logs := []types.Log{testMintLog(addr, testAttacker, -600, 600, jitLiquidity, 50, 0)}
+	_, _, err := shadow.Mint(testAttacker, -600, 600, jitLiquidity)
+	assert.NoError(t, err)
+	logs = append(logs, testSwapLog(t, shadow, testVictim, false, decimal.NewFromInt(1e18), 50, 1))
+	logs = append(logs, testBurnLog(addr, testAttacker, -600, 600, jitLiquidity, 50, 2))
+	// 同一区块中其它owner的burn和没有swap的mint/burn不是JIT
+	logs = append(logs,
+		testMintLog(addr, testVictim, -120, 120, decimal.NewFromInt(1e18), 51, 0),
+		testBurnLog(addr, testVictim, -120, 120, decimal.NewFromInt(1e18), 51, 1),
+	)
+
+	analyzer := pm.NewMEVAnalyzer()
+	found, err := analyzer.AnalyzeLogs(NewSimulatorSnapshot(pm), logs)
+	assert.NoError(t, err)
+	assert.Len(t, found, 0)
+	detected := analyzer.TakeJITLiquidity()
+	assert.Len(t, detected, 1)
+	assert.Len(t, analyzer.TakeJITLiquidity(), 0)
+	jit := detected[0]
+	assert.Equal(t, uint64(50), jit.BlockNum)
+	assert.Equal(t, common.HexToAddress(testAttacker).String(), jit.Owner)
+	assert.Equal(t, 1, jit.Swaps)
+	assert.True(t, jit.Liquidity.Equal(jitLiquidity))
+	assert.True(t, jit.Replayed)
+	// 受害者输入token1, 手续费都是token1
+	assert.True(t, jit.Fees0.IsZero())
+	assert.True(t, jit.Fees1.IsPositive())
+	assert.True(t, jit.PassiveFees1.IsPositive())
+	assert.True(t, jit.PassiveFees1.LessThan(jit.PassiveFeesWithoutJIT1))
+	// 都在范围内时JIT分走的就是已有position少得的手续费, 只差取整
+	assert.True(t, jit.Fees1.Add(jit.PassiveFees1).Sub(jit.PassiveFeesWithoutJIT1).Abs().LessThanOrEqual(decimal.NewFromInt(2)))
+
+	saved, err := pm.QueryJITLiquidity(JITLiquidityQuery{Owner: jit.Owner})
+	assert.NoError(t, err)
+	assert.Len(t, saved, 1)
+	assert.True(t, saved[0].Fees1.Equal(jit.Fees1))
+	assert.True(t, saved[0].PassiveFeesWithoutJIT1.Equal(jit.PassiveFeesWithoutJIT1))
+}
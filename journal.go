@@ -0,0 +1,174 @@
+package uniswap_v3_simulator
+
+import (
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+
+// 撤销日志中的一条记录, 修改前不存在时tick/position为nil
+type journalEntry struct {
+	isTick      bool
+	tickIndex   int
+	tick        *Tick
+	positionKey string
+	position    *Position
+}
+
+// 记录checkpoint之后tick和position修改前的值. 同一个checkpoint之后每个key只记录第一次修改
+type poolJournal struct {
+	entries     []journalEntry
+	checkpoints []uint64 // 仍然有效的checkpoint, 递增
+	nextID      uint64
+	ticks       map[int]bool
+	positions   map[string]bool
+}
+
+func newPoolJournal() *poolJournal {
+	return &poolJournal{ticks: map[int]bool{}, positions: map[string]bool{}}
+}
+
+// 新的checkpoint之后需要重新记录所有key
+func (j *poolJournal) reset() {
+	j.ticks = map[int]bool{}
+	j.positions = map[string]bool{}
+}
+
+func (j *poolJournal) recordTick(ticks *cowMap[int, *Tick], index int) {
+	if j.ticks[index] {
+		return
+	}
+	j.ticks[index] = true
+	entry := journalEntry{isTick: true, tickIndex: index}
+	if tick, ok := ticks.Get(index); ok {
+		entry.tick = tick.Clone()
+	}
+	j.entries = append(j.entries, entry)
+}
+
+func (j *poolJournal) recordPosition(positions *cowMap[string, *Position], key string) {
+	if j.positions[key] {
+		return
+	}
+	j.positions[key] = true
+	entry := journalEntry{positionKey: key}
+	if position, ok := positions.Get(key); ok {
+		entry.position = position.Clone()
+	}
+	j.entries = append(j.entries, entry)
+}
+
+// 日志中记录过的tick, 按第一次修改的顺序
+func (j *poolJournal) tickIndexes() []int {
+	var result []int
+	for _, entry := range j.entries {
+		if entry.isTick {
+			result = append(result, entry.tickIndex)
+		}
+	}
+	return result
+}
+
+// pool中tick和position之外的状态, checkpoint时整体保存
+type poolScalars struct {
+	CurrentBlockNum      uint64
+	Token0Balance        decimal.Decimal
+	Token1Balance        decimal.Decimal
+	SqrtPriceX96         decimal.Decimal
+	Liquidity            decimal.Decimal
+	TickCurrent          int
+	FeeGrowthGlobal0X128 decimal.Decimal
+	FeeGrowthGlobal1X128 decimal.Decimal
+}
+
+type Checkpoint struct {
+	journal *poolJournal
+	id      uint64
+	entries int
+	scalars poolScalars
+}
+
+func (p *CorePool) scalars() poolScalars {
+	return poolScalars{
+		CurrentBlockNum:      p.CurrentBlockNum,
+		Token0Balance:        p.Token0Balance,
+		Token1Balance:        p.Token1Balance,
+		SqrtPriceX96:         p.SqrtPriceX96,
+		Liquidity:            p.Liquidity,
+		TickCurrent:          p.TickCurrent,
+		FeeGrowthGlobal0X128: p.FeeGrowthGlobal0X128,
+		FeeGrowthGlobal1X128: p.FeeGrowthGlobal1X128,
+	}
+}
+
+func (p *CorePool) setScalars(s poolScalars) {
+	p.CurrentBlockNum = s.CurrentBlockNum
+	p.Token0Balance = s.Token0Balance
+	p.Token1Balance = s.Token1Balance
+	p.SqrtPriceX96 = s.SqrtPriceX96
+	p.Liquidity = s.Liquidity
+	p.TickCurrent = s.TickCurrent
+	p.FeeGrowthGlobal0X128 = s.FeeGrowthGlobal0X128
+	p.FeeGrowthGlobal1X128 = s.FeeGrowthGlobal1X128
+}
+
+// 开始(或继续)记录撤销日志, 返回当前状态的checkpoint. 之后的修改只记录被修改的tick/position,
+// 代价和修改量成正比. checkpoint可以嵌套. 日志没有上限, 会随修改一直增长(RevertTo只截断到checkpoint),
+// 调用方用完后必须调用DiscardJournal停止记录并释放
+func (p *CorePool) Checkpoint() Checkpoint {
+	if p.journal == nil {
+		p.journal = newPoolJournal()
+		p.TickManager.journal = p.journal
+		p.PositionManager.journal = p.journal
+	}
+	j := p.journal
+	j.reset()
+	j.nextID++
+	j.checkpoints = append(j.checkpoints, j.nextID)
+	return Checkpoint{journal: j, id: j.nextID, entries: len(j.entries), scalars: p.scalars()}
+}
+
+// 恢复到checkpoint时的状态. checkpoint之后创建的checkpoint失效, checkpoint本身仍然可以再次使用
+func (p *CorePool) RevertTo(cp Checkpoint) error {
+	j := p.journal
+	if j == nil || cp.journal != j {
+		return ErrInvalidCheckpoint
+	}
+	live := len(j.checkpoints) - 1
+	for live >= 0 && j.checkpoints[live] != cp.id {
+		live--
+	}
+	if live < 0 {
+		return ErrInvalidCheckpoint
+	}
+	j.checkpoints = j.checkpoints[:live+1]
+	for i := len(j.entries) - 1; i >= cp.entries; i-- {
+		entry := j.entries[i]
+		if entry.isTick {
+			if entry.tick == nil {
+				p.TickManager.ticks.Delete(entry.tickIndex)
+			} else {
+				p.TickManager.ticks.Set(entry.tickIndex, entry.tick)
+			}
+		} else if entry.position == nil {
+			p.PositionManager.positions.Delete(entry.positionKey)
+		} else {
+			p.PositionManager.positions.Set(entry.positionKey, entry.position)
+		}
+	}
+	j.entries = j.entries[:cp.entries]
+	j.reset()
+	p.setScalars(cp.scalars)
+	// 撤销也是一次修改, fork的冲突检测需要看到
+	p.touch()
+	return nil
+}
+
+// 停止记录撤销日志并释放, 之前的checkpoint全部失效
+func (p *CorePool) DiscardJournal() {
+	p.journal = nil
+	p.TickManager.journal = nil
+	p.PositionManager.journal = nil
+}
@@ -0,0 +1,99 @@
+package uniswap_v3_simulator
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorePool_CheckpointRevert(t *testing.T) {
+	pool := newTestPool(t)
+	expected := pool.Clone()
+	owner := "0x1111111111111111111111111111111111111111"
+
+	cp := pool.Checkpoint()
+	_, _, err := pool.Mint(owner, -180, 180, decimal.NewFromInt(1e17))
+	assert.NoError(t, err)
+	// 穿过tick -120并修改其fee growth outside
+	_, _, _, err = pool.HandleSwap(true, decimal.NewFromInt(1e17), nil, false)
+	assert.NoError(t, err)
+	_, _, err = pool.Burn("0xc36442b4a4522e871399cd717abdd847ab11fe88", -120, 120, decimal.NewFromInt(1e18))
+	assert.NoError(t, err)
+	_, _, err = pool.Collect("0xc36442b4a4522e871399cd717abdd847ab11fe88", -120, 120, MaxUint128, MaxUint128)
+	assert.NoError(t, err)
+	assert.False(t, DiffPools(expected, pool).Empty())
+
+	version := pool.Version()
+	assert.NoError(t, pool.RevertTo(cp))
+	assert.True(t, DiffPools(expected, pool).Empty())
+	assert.NotEqual(t, version, pool.Version())
+
+	// checkpoint可以重复使用
+	_, _, _, err = pool.HandleSwap(false, decimal.NewFromInt(1e15), nil, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pool.RevertTo(cp))
+	assert.True(t, DiffPools(expected, pool).Empty())
+}
+
+func TestCorePool_NestedCheckpoints(t *testing.T) {
+	pool := newTestPool(t)
+	expected := pool.Clone()
+	owner := "0x1111111111111111111111111111111111111111"
+
+	outer := pool.Checkpoint()
+	_, _, err := pool.Mint(owner, -180, 180, decimal.NewFromInt(1e17))
+	assert.NoError(t, err)
+	afterMint := pool.Clone()
+
+	inner := pool.Checkpoint()
+	_, _, err = pool.Mint(owner, -180, 180, decimal.NewFromInt(1e17))
+	assert.NoError(t, err)
+	_, _, _, err = pool.HandleSwap(true, decimal.NewFromInt(1e16), nil, false)
+	assert.NoError(t, err)
+	assert.NoError(t, pool.RevertTo(inner))
+	assert.True(t, DiffPools(afterMint, pool).Empty())
+
+	assert.NoError(t, pool.RevertTo(outer))
+	assert.True(t, DiffPools(expected, pool).Empty())
+	// 回滚到outer之后inner失效
+	assert.ErrorIs(t, pool.RevertTo(inner), ErrInvalidCheckpoint)
+
+	pool.DiscardJournal()
+	assert.ErrorIs(t, pool.RevertTo(outer), ErrInvalidCheckpoint)
+	assert.ErrorIs(t, newTestPool(t).RevertTo(pool.Checkpoint()), ErrInvalidCheckpoint)
+}
+
+func TestCorePool_CheckpointFork(t *testing.T) {
+	pool := newTestPool(t)
+	cp := pool.Checkpoint()
+	_, _, _, err := pool.HandleSwap(true, decimal.NewFromInt(1e16), nil, false)
+	assert.NoError(t, err)
+	forked := pool.Fork()
+	assert.NoError(t, pool.RevertTo(cp))
+	// 撤销不影响之前的分叉
+	assert.False(t, DiffPools(forked, pool).Empty())
+	assert.ErrorIs(t, forked.RevertTo(cp), ErrInvalidCheckpoint)
+}
+
+func TestCorePool_CheckpointApplySwapResult(t *testing.T) {
+	pool := newTestPool(t)
+	expected := pool.Clone()
+	// 穿过tick -120, 试算修改的tick需要记录到pool的撤销日志
+	swapped := pool.Clone()
+	amount0, _, price, err := swapped.HandleSwap(true, decimal.NewFromInt(2e16), nil, false)
+	assert.NoError(t, err)
+	tick := swapped.TickCurrent
+	assert.Less(t, tick, -120)
+	swap := &UniV3SwapEvent{Amount0: amount0, SqrtPriceX96: price, Liquidity: swapped.Liquidity, Tick: &tick}
+
+	cp := pool.Checkpoint()
+	exact, err := pool.ApplySwapResult(swap)
+	assert.NoError(t, err)
+	assert.True(t, exact)
+	assert.True(t, DiffPools(swapped, pool).Empty())
+
+	assert.NoError(t, pool.RevertTo(cp))
+	assert.True(t, DiffPools(expected, pool).Empty())
+	pool.DiscardJournal()
+}
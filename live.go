@@ -0,0 +1,251 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFlushInterval = time.Minute
+	defaultPollInterval  = 3 * time.Second
+)
+
+var ErrChainReorg = errors.New("chain reorg removed applied logs")
+
+func (pm *Simulator) flushInterval() time.Duration {
+	if pm.FlushInterval > 0 {
+		return pm.FlushInterval
+	}
+	return defaultFlushInterval
+}
+
+func (pm *Simulator) pollInterval() time.Duration {
+	if pm.PollInterval > 0 {
+		return pm.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// 跟随链上最新区块: 先用SyncBlocks追到已确认的区块, 再订阅新的日志(需要websocket节点),
+// 不支持订阅或订阅断开时改为轮询. 每FlushInterval持久化一次, 只落地距离最新区块超过Confirmations的区块,
+// ctx取消时flush后返回nil. 未落地的区块被reorg移除时在内存中回滚并重新同步, 已经发出的observer通知不会撤回;
+// reorg超过已落地的区块时内存状态回到数据库中的游标, 返回ErrChainReorg
+func (pm *Simulator) Run(ctx context.Context, step uint64) error {
+	pm.syncLock.Lock()
+	defer pm.syncLock.Unlock()
+	defer pm.stopFollowing()
+	err := pm.syncConfirmed(ctx, step)
+	if err != nil {
+		return pm.stopRun(ctx, err)
+	}
+	logsCh := make(chan types.Log, 1024)
+	sub, err := pm.rpc.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Topics: pm.eventTopics()}, logsCh)
+	if err != nil {
+		logrus.Warnf("failed subscribe logs, fallback to polling: %s", err)
+		return pm.runPolling(ctx, step)
+	}
+	defer sub.Unsubscribe()
+	// 追上订阅开始之前产生的区块
+	err = pm.followHead(ctx, step)
+	if err != nil {
+		return pm.stopRun(ctx, err)
+	}
+	err = pm.runSubscription(ctx, sub, logsCh)
+	if errors.Is(err, errSubscriptionDropped) {
+		logrus.Warnf("%s, fallback to polling", err)
+		return pm.runPolling(ctx, step)
+	}
+	return err
+}
+
+// 同步并落地到已确认的区块, 之后应用的区块都有检查点
+func (pm *Simulator) syncConfirmed(ctx context.Context, step uint64) error {
+	head, err := pm.HeadBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if head > pm.Confirmations {
+		_, err = pm.syncBlocks(ctx, head-pm.Confirmations, step)
+		if err != nil {
+			return err
+		}
+	}
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	err = pm.flushPools()
+	if err != nil {
+		return err
+	}
+	// 已经同步超过确认高度的区块没有检查点, 也当作已确认
+	pm.confirmedBlock = pm.currentBlock
+	return nil
+}
+
+func (pm *Simulator) confirmHead(head uint64) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if head > pm.Confirmations && head-pm.Confirmations > pm.confirmedBlock {
+		pm.confirmedBlock = head - pm.Confirmations
+	}
+}
+
+// 按区块应用到最新区块的日志
+func (pm *Simulator) followHead(ctx context.Context, step uint64) error {
+	head, err := pm.HeadBlock(ctx)
+	if err != nil {
+		return err
+	}
+	pm.confirmHead(head)
+	start := pm.CurrentBlock() + 1
+	if start > head {
+		return nil
+	}
+	return pm.newLogFetcher(step).Run(ctx, start, head, func(batch LogBatch) error {
+		times, err := pm.fetchBlockTimes(ctx, batch.Logs)
+		if err != nil {
+			return err
+		}
+		pm.lock.Lock()
+		defer pm.lock.Unlock()
+		pm.addBlockTimes(times)
+		err = pm.applyBlocks(batch.Logs)
+		if err != nil {
+			if reloadErr := pm.reloadCommittedState(); reloadErr != nil {
+				logrus.Errorf("failed reload committed state %s", reloadErr)
+			}
+			return err
+		}
+		pm.currentBlock = batch.To
+		return nil
+	})
+}
+
+// 退出时丢弃未落地的区块, 内存状态和数据库一致
+func (pm *Simulator) stopFollowing() {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if len(pm.checkpoints) > 0 {
+		if err := pm.rewind(pm.checkpoints[0].block); err != nil {
+			logrus.Errorf("failed discard unconfirmed blocks %s", err)
+		}
+	}
+	if pm.confirmedBlock > 0 && pm.confirmedBlock < pm.currentBlock {
+		pm.currentBlock = pm.confirmedBlock
+	}
+	pm.confirmedBlock = 0
+	pm.checkpoints = nil
+}
+
+// ctx取消时正常退出并flush, 其它错误直接返回
+func (pm *Simulator) stopRun(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	logrus.Infof("stop following chain at block %d", pm.CurrentBlock())
+	return pm.FlushPools()
+}
+
+var errSubscriptionDropped = errors.New("log subscription dropped")
+
+// 同一区块的日志一起到达, 收到更高区块的日志时才认为前一个区块已经完整
+func (pm *Simulator) runSubscription(ctx context.Context, sub ethereum.Subscription, logsCh <-chan types.Log) error {
+	ticker := time.NewTicker(pm.flushInterval())
+	defer ticker.Stop()
+	var pending []types.Log
+	applyPending := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		times, err := pm.fetchBlockTimes(ctx, pending)
+		if err != nil {
+			return err
+		}
+		pm.lock.Lock()
+		defer pm.lock.Unlock()
+		pm.addBlockTimes(times)
+		err = pm.applyBlocks(pending)
+		pending = pending[:0]
+		if err != nil {
+			if reloadErr := pm.reloadCommittedState(); reloadErr != nil {
+				logrus.Errorf("failed reload committed state %s", reloadErr)
+			}
+			return err
+		}
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return pm.stopRun(ctx, ctx.Err())
+		case err := <-sub.Err():
+			return fmt.Errorf("%w: %v", errSubscriptionDropped, err)
+		case <-ticker.C:
+			err := pm.FlushPools()
+			if err != nil {
+				return err
+			}
+		case log := <-logsCh:
+			if log.Removed {
+				// 还没应用的日志在被移除的区块之后, 也已经不在链上
+				if len(pending) > 0 && pending[0].BlockNumber >= log.BlockNumber {
+					pending = pending[:0]
+				}
+				if log.BlockNumber > pm.CurrentBlock() {
+					continue
+				}
+				pm.lock.Lock()
+				err := pm.rewind(log.BlockNumber)
+				pm.lock.Unlock()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			pm.metrics.observeHead(log.BlockNumber)
+			pm.confirmHead(log.BlockNumber)
+			if log.BlockNumber <= pm.CurrentBlock() {
+				continue
+			}
+			if len(pending) > 0 && log.BlockNumber != pending[0].BlockNumber {
+				err := applyPending()
+				if err != nil {
+					return err
+				}
+			}
+			pending = append(pending, log)
+		}
+	}
+}
+
+// 每次轮询先检查最近应用的区块是否还在链上, 再应用新的区块
+func (pm *Simulator) runPolling(ctx context.Context, step uint64) error {
+	poll := time.NewTicker(pm.pollInterval())
+	defer poll.Stop()
+	flush := time.NewTicker(pm.flushInterval())
+	defer flush.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return pm.stopRun(ctx, ctx.Err())
+		case <-flush.C:
+			err := pm.FlushPools()
+			if err != nil {
+				return err
+			}
+		case <-poll.C:
+			err := pm.checkReorg(ctx)
+			if err == nil {
+				err = pm.followHead(ctx, step)
+			}
+			if err != nil {
+				return pm.stopRun(ctx, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator_RunPolling(t *testing.T) {
+	fake, url := newFakeLogRPC(t, 1000, false)
+	pm := NewPoolManager(filepath.Join(t.TempDir(), "simulator.db"), url, 0)
+	pm.PollInterval = 10 * time.Millisecond
+	pm.FlushInterval = 20 * time.Millisecond
+	pm.Confirmations = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pm.Run(ctx, 99)
+	}()
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 1000 }, 5*time.Second, 5*time.Millisecond)
+	fake.head.Store(1200)
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 1200 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	// 只落地已确认的区块, 退出时内存状态回到落地的区块
+	committed, err := pm.CommittedBlockNum()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1190), committed)
+	assert.Equal(t, uint64(1190), pm.CurrentBlock())
+}
+
+func TestSimulator_RunPollingReorg(t *testing.T) {
+	fake, url := newFakeLogRPC(t, 1000, false)
+	pm := NewPoolManager(filepath.Join(t.TempDir(), "simulator.db"), url, 0)
+	pm.PollInterval = 10 * time.Millisecond
+	pm.FlushInterval = 20 * time.Millisecond
+	pm.Confirmations = 10
+	hashAt := func(block uint64) common.Hash {
+		pm.lock.RLock()
+		defer pm.lock.RUnlock()
+		for _, checkpoint := range pm.checkpoints {
+			if checkpoint.block == block {
+				return checkpoint.hash
+			}
+		}
+		return common.Hash{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pm.Run(ctx, 99)
+	}()
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 1000 }, 5*time.Second, 5*time.Millisecond)
+	before := hashAt(1000)
+	assert.Equal(t, fake.header(1000).Hash(), before)
+	// 995之后的区块换成另一条链, 轮询时发现hash不一致后重新同步
+	fake.reorgAt.Store(995)
+	fake.head.Store(1005)
+	assert.Eventually(t, func() bool {
+		return pm.CurrentBlock() == 1005 && hashAt(1000) == fake.header(1000).Hash()
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.NotEqual(t, before, hashAt(1000))
+	cancel()
+	assert.NoError(t, <-done)
+	committed, err := pm.CommittedBlockNum()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(995), committed)
+}
+
+// 支持日志订阅的进程内节点
+type fakeEthService struct {
+	head uint64
+	subs chan func(log *types.Log)
+}
+
+func (s *fakeEthService) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(s.head)
+}
+
+func (s *fakeEthService) GetLogs(ctx context.Context, crit map[string]interface{}) ([]*types.Log, error) {
+	return []*types.Log{}, nil
+}
+
+func (s *fakeEthService) Logs(ctx context.Context, crit map[string]interface{}) (*rpc.Subscription, error) {
+	notifier, _ := rpc.NotifierFromContext(ctx)
+	sub := notifier.CreateSubscription()
+	s.subs <- func(log *types.Log) {
+		_ = notifier.Notify(sub.ID, log)
+	}
+	return sub, nil
+}
+
+func newSubscribingSimulator(t *testing.T) (*Simulator, func(log *types.Log)) {
+	service := &fakeEthService{head: 100, subs: make(chan func(log *types.Log), 1)}
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", service))
+	t.Cleanup(server.Stop)
+	pm := newTestSimulator(t, "")
+	pm.rpc = ethclient.NewClient(rpc.DialInProc(server))
+	pm.FlushInterval = 10 * time.Millisecond
+	notify := func(log *types.Log) {
+		send := <-service.subs
+		service.subs <- send
+		send(log)
+	}
+	return pm, notify
+}
+
+func TestSimulator_RunSubscription(t *testing.T) {
+	pm, notify := newSubscribingSimulator(t)
+	pm.Confirmations = 0
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	liquidity := pool.Liquidity
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pm.Run(ctx, 1000)
+	}()
+	owner := "0x1111111111111111111111111111111111111111"
+	first := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0)
+	second := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 102, 0)
+	notify(&first)
+	notify(&second)
+	// 收到102的日志后101才完整
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 101 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+
+	committed, err := pm.CommittedBlockNum()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(101), committed)
+	assert.True(t, pm.Pools[addr].Liquidity.Equal(liquidity.Add(decimal.NewFromInt(1e17))))
+}
+
+func TestSimulator_RunSubscriptionReorg(t *testing.T) {
+	pm, notify := newSubscribingSimulator(t)
+	pm.Confirmations = 5
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	liquidity := pool.Liquidity
+	poolLiquidity := func() decimal.Decimal {
+		pm.lock.RLock()
+		defer pm.lock.RUnlock()
+		return pm.Pools[addr].Liquidity
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pm.Run(ctx, 1000)
+	}()
+	owner := "0x1111111111111111111111111111111111111111"
+	first := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0)
+	second := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 102, 0)
+	notify(&first)
+	notify(&second)
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 101 }, 5*time.Second, 5*time.Millisecond)
+	assert.True(t, poolLiquidity().Equal(liquidity.Add(decimal.NewFromInt(1e17))))
+
+	// 101被移除, 回滚到100后应用新链上的日志
+	removed := first
+	removed.Removed = true
+	notify(&removed)
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 100 }, 5*time.Second, 5*time.Millisecond)
+	assert.True(t, poolLiquidity().Equal(liquidity))
+	replaced := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(2e17), 101, 0)
+	next := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 103, 0)
+	notify(&replaced)
+	notify(&next)
+	assert.Eventually(t, func() bool { return pm.CurrentBlock() == 101 }, 5*time.Second, 5*time.Millisecond)
+	assert.True(t, poolLiquidity().Equal(liquidity.Add(decimal.NewFromInt(2e17))))
+
+	cancel()
+	assert.NoError(t, <-done)
+	// 103确认了98之前的区块, 101还没有落地, 退出时丢弃
+	committed, err := pm.CommittedBlockNum()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(98), committed)
+	assert.Equal(t, uint64(98), pm.CurrentBlock())
+	assert.True(t, pm.Pools[addr].Liquidity.Equal(liquidity))
+	// 数据库中是101之前的状态
+	pools, err := loadPools(pm.db)
+	assert.NoError(t, err)
+	assert.True(t, pools[addr].Liquidity.Equal(liquidity))
+}
+
+func TestSimulator_RunSubscriptionDeepReorg(t *testing.T) {
+	pm, notify := newSubscribingSimulator(t)
+	pm.Confirmations = 0
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	done := make(chan error)
+	go func() {
+		done <- pm.Run(context.Background(), 1000)
+	}()
+	owner := "0x1111111111111111111111111111111111111111"
+	first := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0)
+	second := testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 102, 0)
+	notify(&first)
+	notify(&second)
+	assert.Eventually(t, func() bool {
+		committed, err := pm.CommittedBlockNum()
+		return err == nil && committed == 101
+	}, 5*time.Second, 5*time.Millisecond)
+	// 已经落地的区块不能回滚
+	removed := first
+	removed.Removed = true
+	notify(&removed)
+	assert.ErrorIs(t, <-done, ErrChainReorg)
+}
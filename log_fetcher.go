@@ -0,0 +1,188 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// 节点因为结果太多或者范围太大拒绝查询时返回的错误信息, 不同节点服务商各不相同
+var rangeTooLargeErrors = []string{
+	"query returned more than",
+	"log response size exceeded",
+	"response size should not",
+	"eth_getlogs is limited to",
+	"block range is too wide",
+	"block range too large",
+	"exceed maximum block range",
+	"query exceeds max block range",
+	"query exceeds max results",
+}
+
+// 限流的错误信息里也可能有limit exceeded之类的字样, 这些错误应该退避重试而不是拆分范围
+var rateLimitErrors = []string{
+	"rate limit",
+	"too many requests",
+	"request limit",
+	"compute units",
+	"429",
+}
+
+func containsAny(msg string, substrings []string) bool {
+	for _, s := range substrings {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRangeTooLarge(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return !containsAny(msg, rateLimitErrors) && containsAny(msg, rangeTooLargeErrors)
+}
+
+type LogFilterer interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// [From, To]区间内的所有日志
+type LogBatch struct {
+	From uint64
+	To   uint64
+	Logs []types.Log
+}
+
+// 并发预取多个区块范围的日志, 按区块顺序交给调用方.
+// 节点拒绝过大的范围时对半拆分重试, 其它错误按指数退避重试
+type LogFetcher struct {
+	client       LogFilterer
+	Topics       [][]common.Hash
+	Addresses    []common.Address
+	Step         uint64        // 每个范围为[start, start+Step], 和SyncBlocks的step含义相同
+	Concurrency  int           // 同时请求的范围数量
+	MaxRetries   int           // 每个请求的最大重试次数
+	RetryBackoff time.Duration // 第一次重试的等待时间, 之后每次翻倍
+}
+
+func NewLogFetcher(client LogFilterer, topics [][]common.Hash, step uint64) *LogFetcher {
+	return &LogFetcher{
+		client:       client,
+		Topics:       topics,
+		Step:         step,
+		Concurrency:  4,
+		MaxRetries:   5,
+		RetryBackoff: 500 * time.Millisecond,
+	}
+}
+
+type pendingBatch struct {
+	batch LogBatch
+	err   error
+	done  chan struct{}
+}
+
+// 获取[from, to]的日志, 按区块顺序对每个范围调用handle, handle返回错误时停止并返回该错误
+func (f *LogFetcher) Run(ctx context.Context, from, to uint64, handle func(batch LogBatch) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := f.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// 缓冲区大小限制了预取的范围数量
+	queue := make(chan *pendingBatch, concurrency-1)
+	go func() {
+		defer close(queue)
+		for start := from; start <= to; {
+			end := start + f.Step
+			if end > to || end < start {
+				end = to
+			}
+			p := &pendingBatch{batch: LogBatch{From: start, To: end}, done: make(chan struct{})}
+			select {
+			case queue <- p:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				defer close(p.done)
+				p.batch.Logs, p.err = f.fetchRange(ctx, p.batch.From, p.batch.To)
+			}()
+			if end == to {
+				return
+			}
+			start = end + 1
+		}
+	}()
+	for p := range queue {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if p.err != nil {
+			return p.err
+		}
+		err := handle(p.batch)
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// 范围过大时拆成两半分别获取
+func (f *LogFetcher) fetchRange(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	logs, err := f.filterWithRetry(ctx, from, to)
+	if err == nil || !isRangeTooLarge(err) {
+		return logs, err
+	}
+	if from == to {
+		return nil, fmt.Errorf("single block %d rejected: %w", from, err)
+	}
+	mid := from + (to-from)/2
+	logrus.Infof("split block range %d - %d: %s", from, to, err)
+	left, err := f.fetchRange(ctx, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	right, err := f.fetchRange(ctx, mid+1, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+func (f *LogFetcher) filterWithRetry(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	backoff := f.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		logs, err := f.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: f.Addresses,
+			Topics:    f.Topics,
+		})
+		if err == nil {
+			return logs, nil
+		}
+		if isRangeTooLarge(err) || errors.Is(err, context.Canceled) || attempt >= f.MaxRetries {
+			return nil, err
+		}
+		logrus.Warnf("failed filter logs %d - %d, retry in %s: %s", from, to, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
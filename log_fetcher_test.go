@@ -0,0 +1,209 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// 本地的假节点: 每个区块一个mint日志, 超过maxRange的查询返回结果过多, flaky时每个范围第一次请求失败
+type fakeLogRPC struct {
+	maxRange uint64
+	flaky    bool
+	head     atomic.Uint64
+	reorgAt  atomic.Uint64 // 不为0时从这个区块开始换成另一条链
+	lock     sync.Mutex
+	failed   map[uint64]bool
+	inflight atomic.Int32
+	peak     atomic.Int32
+	requests atomic.Int32
+}
+
+type fakeRPCRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func (f *fakeLogRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req fakeRPCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reply := func(result interface{}, errMsg string) {
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if errMsg != "" {
+			resp["error"] = map[string]interface{}{"code": -32005, "message": errMsg}
+		} else {
+			resp["result"] = result
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+	if req.Method == "eth_blockNumber" {
+		reply(hexutil.Uint64(f.head.Load()), "")
+		return
+	}
+	if req.Method == "eth_getBlockByNumber" {
+		var block hexutil.Uint64
+		_ = json.Unmarshal(req.Params[0], &block)
+		reply(f.header(uint64(block)), "")
+		return
+	}
+	if req.Method != "eth_getLogs" {
+		reply(nil, "method not found")
+		return
+	}
+	var query struct {
+		FromBlock hexutil.Uint64 `json:"fromBlock"`
+		ToBlock   hexutil.Uint64 `json:"toBlock"`
+	}
+	_ = json.Unmarshal(req.Params[0], &query)
+	from, to := uint64(query.FromBlock), uint64(query.ToBlock)
+
+	f.requests.Add(1)
+	n := f.inflight.Add(1)
+	defer f.inflight.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if n <= peak || f.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if to-from+1 > f.maxRange {
+		reply(nil, "query returned more than 10000 results")
+		return
+	}
+	f.lock.Lock()
+	failed := f.failed[from]
+	f.failed[from] = true
+	f.lock.Unlock()
+	if f.flaky && !failed {
+		reply(nil, "internal error")
+		return
+	}
+	logs := []*types.Log{}
+	for block := from; block <= to; block++ {
+		logs = append(logs, &types.Log{
+			Address:     common.HexToAddress("0x2222222222222222222222222222222222222222"),
+			Topics:      []common.Hash{TOPIC_MINT},
+			Data:        []byte{},
+			BlockNumber: block,
+			TxHash:      common.BigToHash(common.Big1),
+			BlockHash:   f.header(block).Hash(),
+		})
+	}
+	reply(logs, "")
+}
+
+func (f *fakeLogRPC) header(block uint64) *types.Header {
+	extra := []byte{}
+	if reorgAt := f.reorgAt.Load(); reorgAt > 0 && block >= reorgAt {
+		extra = []byte("reorg")
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(block), Difficulty: common.Big0, Extra: extra}
+}
+
+func newFakeLogRPC(t *testing.T, maxRange uint64, flaky bool) (*fakeLogRPC, string) {
+	fake := &fakeLogRPC{maxRange: maxRange, flaky: flaky, failed: map[uint64]bool{}}
+	fake.head.Store(1000)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+func TestLogFetcher_InOrderWithSplitAndRetry(t *testing.T) {
+	fake, url := newFakeLogRPC(t, 7, true)
+	client, err := ethclient.Dial(url)
+	assert.NoError(t, err)
+	fetcher := NewLogFetcher(client, nil, 19)
+	fetcher.RetryBackoff = time.Millisecond
+
+	var blocks []uint64
+	var batches []LogBatch
+	err = fetcher.Run(context.Background(), 1, 200, func(batch LogBatch) error {
+		batches = append(batches, batch)
+		for _, log := range batch.Logs {
+			blocks = append(blocks, log.BlockNumber)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 200)
+	for i, block := range blocks {
+		assert.Equal(t, uint64(i+1), block)
+	}
+	assert.Len(t, batches, 10)
+	assert.Equal(t, uint64(1), batches[0].From)
+	assert.Equal(t, uint64(20), batches[0].To)
+	assert.Equal(t, uint64(200), batches[9].To)
+	assert.Greater(t, fake.peak.Load(), int32(1))
+}
+
+func TestLogFetcher_StopsOnHandleError(t *testing.T) {
+	_, url := newFakeLogRPC(t, 100, true)
+	client, err := ethclient.Dial(url)
+	assert.NoError(t, err)
+	fetcher := NewLogFetcher(client, nil, 9)
+	fetcher.RetryBackoff = time.Millisecond
+	calls := 0
+	err = fetcher.Run(context.Background(), 1, 100, func(batch LogBatch) error {
+		calls++
+		if batch.From == 21 {
+			return assert.AnError
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 3, calls)
+
+	fetcher.MaxRetries = 0
+	err = fetcher.Run(context.Background(), 500, 520, func(batch LogBatch) error { return nil })
+	assert.ErrorContains(t, err, "internal error")
+}
+
+func TestSimulator_SyncBlocksWithFetcher(t *testing.T) {
+	_, url := newFakeLogRPC(t, 30, true)
+	pm := NewPoolManager(filepath.Join(t.TempDir(), "simulator.db"), url, 0)
+	end, err := pm.SyncBlocks(500, 99)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(500), end)
+	assert.Equal(t, uint64(500), pm.CurrentBlock())
+}
+
+func TestIsRangeTooLarge(t *testing.T) {
+	cases := []struct {
+		msg      string
+		tooLarge bool
+	}{
+		{"query returned more than 10000 results", true},
+		{"Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range", true},
+		{"eth_getLogs is limited to a 10,000 range", true},
+		{"block range is too wide", true},
+		{"rate limit exceeded", false},
+		{"daily request limit exceeded", false},
+		{"429 Too Many Requests", false},
+		{"invalid block range params", false},
+		{"internal error", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.tooLarge, isRangeTooLarge(errors.New(c.msg)), c.msg)
+	}
+}
@@ -0,0 +1,715 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	uniswap_v3_simulator "github.com/CoinSummer/uniswap-v3-simulator"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// 只读命令以只读方式打开已有的数据库, 不建表也不迁移
+func openSimulator(cfg config, readOnly bool) (*uniswap_v3_simulator.Simulator, error) {
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+	var pm *uniswap_v3_simulator.Simulator
+	if readOnly {
+		pm, err = uniswap_v3_simulator.OpenReadOnly(cfg.DB, cfg.RPC)
+		if err != nil {
+			return nil, fmt.Errorf("database %s not found: %w", cfg.DB, err)
+		}
+	} else {
+		pm = uniswap_v3_simulator.NewPoolManager(cfg.DB, cfg.RPC, cfg.StartBlock)
+	}
+	if cfg.Policy == policyStrict {
+		pm.Policy = uniswap_v3_simulator.DefaultPolicy{Quarantine: pm.Quarantine, Strict: true}
+	}
+	if cfg.SwapResolve == swapResolveCalldata {
+		pm.SwapResolveMode = uniswap_v3_simulator.SwapResolveCalldata
+		if cfg.CallFixture != "" {
+			source, err := uniswap_v3_simulator.LoadFixtureCallSource(cfg.CallFixture)
+			if err != nil {
+				return nil, err
+			}
+			pm.CallSource = source
+		} else {
+			pm.CallSource = pm.TraceCallSource()
+		}
+	}
+	pm.RecordBlockTime = cfg.RecordBlockTime
+	return pm, nil
+}
+
+func parseAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("invalid address %q", s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+// 同步时在另一个goroutine中分析应用的事件, 返回的函数停止分析并等待最后一个区块写入
+func analyzeMEV(pm *uniswap_v3_simulator.Simulator) (func(), error) {
+	analyzer := pm.NewMEVAnalyzer()
+	observer := uniswap_v3_simulator.NewChannelObserver(4096)
+	observer.Blocking = true
+	fork, _, id, err := pm.ObserveFromSnapshot(observer)
+	if err != nil {
+		return nil, err
+	}
+	analyzer.Seed(fork)
+	done := make(chan struct{})
+	go func() {
+		analyzer.Run(observer.C)
+		close(done)
+	}()
+	return func() {
+		pm.RemoveObserver(id)
+		close(observer.C)
+		<-done
+	}, nil
+}
+
+// 同步时每个区块结束后扫描经过有变化的pool的套利循环, 机会写入日志
+func scanArbitrage(pm *uniswap_v3_simulator.Simulator, maxHops int) (func(), error) {
+	scanner := uniswap_v3_simulator.NewArbitrageScanner(maxHops)
+	observer := uniswap_v3_simulator.NewChannelObserver(4096)
+	observer.Blocking = true
+	fork, _, id, err := pm.ObserveFromSnapshot(observer)
+	if err != nil {
+		return nil, err
+	}
+	scanner.Seed(fork)
+	done := make(chan struct{})
+	go func() {
+		scanner.Run(observer.C, func(block uint64, opportunities []*uniswap_v3_simulator.ArbitrageOpportunity) {
+			for _, opportunity := range opportunities {
+				logrus.Infof("arbitrage at block %d: %d hops from pool %s, token %s amount in %s profit %s", block, len(opportunity.Hops), opportunity.Hops[0].Pool, opportunity.Token, opportunity.AmountIn, opportunity.Profit)
+			}
+		})
+		close(done)
+	}()
+	return func() {
+		pm.RemoveObserver(id)
+		close(observer.C)
+		<-done
+	}, nil
+}
+
+type syncResult struct {
+	SyncedBlock    uint64 `json:"synced_block"`
+	CommittedBlock uint64 `json:"committed_block"`
+}
+
+func runSync(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("sync")
+	from := fs.Uint64("from", 0, "first block to sync when the database is empty (default: factory deploy block)")
+	to := fs.Uint64("to", 0, "last block to sync, 0 for latest")
+	step := fs.Uint64("step", 0, "blocks per log query (default 10000)")
+	follow := fs.Bool("follow", false, "keep following new blocks after catching up, until interrupted")
+	workers := fs.Int("workers", 0, "apply events of different pools in parallel")
+	fetchConcurrency := fs.Int("fetch-concurrency", 0, "block ranges fetched concurrently")
+	metricsAddr := fs.String("metrics", "", "serve /metrics on this address, e.g. :9100")
+	mev := fs.Bool("mev", false, "detect sandwiches and jit liquidity in the synced blocks and save them to the database")
+	arbitrage := fs.Bool("arbitrage", false, "log profitable arbitrage cycles after each synced block")
+	maxHops := fs.Int("max-hops", 0, "pools per arbitrage cycle (default 3)")
+	applying := newApplyFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	applying.apply(&cfg)
+	if isSet(fs, "from") {
+		if *from == 0 {
+			return nil, errors.New("-from must be greater than 0")
+		}
+		cfg.StartBlock = *from - 1
+	}
+	if isSet(fs, "step") {
+		cfg.Step = *step
+	}
+	if isSet(fs, "workers") {
+		cfg.ReplayWorkers = *workers
+	}
+	if isSet(fs, "fetch-concurrency") {
+		cfg.FetchConcurrency = *fetchConcurrency
+	}
+	if isSet(fs, "metrics") {
+		cfg.MetricsAddr = *metricsAddr
+	}
+	if *follow && *to != 0 {
+		return nil, errors.New("-follow and -to can not be used together")
+	}
+
+	pm, err := openSimulator(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	pm.ReplayWorkers = cfg.ReplayWorkers
+	pm.FetchConcurrency = cfg.FetchConcurrency
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.MetricsAddr != "" {
+		go func() {
+			err := pm.ServeMetrics(ctx, cfg.MetricsAddr)
+			if err != nil {
+				logrus.Errorf("failed serve metrics %s", err)
+			}
+		}()
+	}
+	// 上次异常退出时可能有pool超前于同步游标
+	err = pm.Recover(uniswap_v3_simulator.RecoveryRebuild, cfg.Step)
+	if err != nil {
+		return nil, err
+	}
+	if *mev {
+		stopMEV, err := analyzeMEV(pm)
+		if err != nil {
+			return nil, err
+		}
+		defer stopMEV()
+	}
+	if *arbitrage {
+		stopArbitrage, err := scanArbitrage(pm, *maxHops)
+		if err != nil {
+			return nil, err
+		}
+		defer stopArbitrage()
+	}
+	if *follow {
+		err = pm.Run(ctx, cfg.Step)
+	} else {
+		_, err = pm.SyncBlocks(*to, cfg.Step)
+		if err == nil {
+			err = pm.FlushPools()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	committed, err := pm.CommittedBlockNum()
+	if err != nil {
+		return nil, err
+	}
+	return syncResult{SyncedBlock: pm.CurrentBlock(), CommittedBlock: committed}, nil
+}
+
+func runServe(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("serve")
+	addr := fs.String("addr", "", "listen address of the http api (default :8080)")
+	grpcAddr := fs.String("grpc", "", "also serve the grpc api on this address, e.g. :9090")
+	ethRPCAddr := fs.String("eth-rpc", "", "also answer eth_call for pools and QuoterV2 on this address, e.g. :8546")
+	follow := fs.Bool("follow", false, "keep syncing new blocks while serving")
+	applying := newApplyFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	applying.apply(&cfg)
+	if isSet(fs, "addr") {
+		cfg.APIAddr = *addr
+	}
+	if isSet(fs, "grpc") {
+		cfg.GRPCAddr = *grpcAddr
+	}
+	if isSet(fs, "eth-rpc") {
+		cfg.EthRPCAddr = *ethRPCAddr
+	}
+	pm, err := openSimulator(cfg, !*follow)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *follow {
+		err = pm.Recover(uniswap_v3_simulator.RecoveryRebuild, cfg.Step)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			// 同步出错时也停止服务, 避免对外提供过期的状态
+			defer stop()
+			err := pm.Run(ctx, cfg.Step)
+			if err != nil {
+				logrus.Errorf("failed follow blocks %s", err)
+			}
+		}()
+	}
+	api := uniswap_v3_simulator.NewAPI(pm)
+	if cfg.GRPCAddr != "" {
+		go func() {
+			defer stop()
+			err := api.ServeGRPC(ctx, cfg.GRPCAddr)
+			if err != nil {
+				logrus.Errorf("failed serve grpc %s", err)
+			}
+		}()
+	}
+	if cfg.EthRPCAddr != "" {
+		go func() {
+			defer stop()
+			err := uniswap_v3_simulator.NewEthCall(api).Serve(ctx, cfg.EthRPCAddr)
+			if err != nil {
+				logrus.Errorf("failed serve eth rpc %s", err)
+			}
+		}()
+	}
+	err = api.Serve(ctx, cfg.APIAddr)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := pm.CommittedBlockNum()
+	if err != nil {
+		return nil, err
+	}
+	return syncResult{SyncedBlock: pm.CurrentBlock(), CommittedBlock: committed}, nil
+}
+
+type statusResult struct {
+	DB             string  `json:"db"`
+	DBSize         int64   `json:"db_size"`
+	SyncedBlock    uint64  `json:"synced_block"`
+	CommittedBlock uint64  `json:"committed_block"`
+	HeadBlock      *uint64 `json:"head_block,omitempty"`
+	Pools          int     `json:"pools"`
+	Quarantined    int     `json:"quarantined"`
+	Snapshots      int     `json:"snapshots"`
+}
+
+func runStatus(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("status")
+	head := fs.Bool("head", false, "also query the latest block from rpc")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := pm.CommittedBlockNum()
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := uniswap_v3_simulator.ListDBSnapshots(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	result := statusResult{
+		DB:             cfg.DB,
+		DBSize:         info.Size(),
+		SyncedBlock:    pm.CurrentBlock(),
+		CommittedBlock: committed,
+		Pools:          len(pm.PoolAddresses()),
+		Quarantined:    len(pm.QuarantinedPools()),
+		Snapshots:      len(snapshots),
+	}
+	if *head {
+		latest, err := pm.HeadBlock(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		result.HeadBlock = &latest
+	}
+	return result, nil
+}
+
+type poolSummary struct {
+	Address      string          `json:"address"`
+	Token0       string          `json:"token0"`
+	Token1       string          `json:"token1"`
+	Fee          int             `json:"fee"`
+	TickSpacing  int             `json:"tick_spacing"`
+	DeployBlock  uint64          `json:"deploy_block"`
+	CurrentBlock uint64          `json:"current_block"`
+	SqrtPriceX96 decimal.Decimal `json:"sqrt_price_x96"`
+	Tick         int             `json:"tick"`
+	Liquidity    decimal.Decimal `json:"liquidity"`
+	Quarantined  bool            `json:"quarantined"`
+}
+
+func runPoolsList(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("pools list")
+	token := fs.String("token", "", "only pools containing this token")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	pools := []poolSummary{}
+	for _, addr := range pm.PoolAddresses() {
+		pool, err := pm.ForkPool(addr)
+		if err != nil {
+			return nil, err
+		}
+		if *token != "" && !strings.EqualFold(pool.Token0, *token) && !strings.EqualFold(pool.Token1, *token) {
+			continue
+		}
+		pools = append(pools, poolSummary{
+			Address:      pool.PoolAddress,
+			Token0:       pool.Token0,
+			Token1:       pool.Token1,
+			Fee:          int(pool.Fee),
+			TickSpacing:  pool.TickSpacing,
+			DeployBlock:  pool.DeployBlockNum,
+			CurrentBlock: pool.CurrentBlockNum,
+			SqrtPriceX96: pool.SqrtPriceX96,
+			Tick:         pool.TickCurrent,
+			Liquidity:    pool.Liquidity,
+			Quarantined:  pm.Quarantine.Quarantined(addr),
+		})
+	}
+	return pools, nil
+}
+
+func runPoolShow(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("pool show")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		return nil, errors.New("usage: pool show [flags] <address>")
+	}
+	addr, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pm.ForkPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	return uniswap_v3_simulator.NewPoolExport(pool)
+}
+
+type quoteResult struct {
+	Pool              string           `json:"pool"`
+	ZeroForOne        bool             `json:"zero_for_one"`
+	AmountSpecified   decimal.Decimal  `json:"amount_specified"`
+	SqrtPriceLimitX96 *decimal.Decimal `json:"sqrt_price_limit_x96,omitempty"`
+	*uniswap_v3_simulator.QuoteResponse
+}
+
+func runQuote(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("quote")
+	poolFlag := fs.String("pool", "", "pool address")
+	zeroForOne := fs.Bool("zero-for-one", true, "swap token0 for token1")
+	amountFlag := fs.String("amount", "", "amount specified, positive for exact input, negative for exact output")
+	limitFlag := fs.String("price-limit", "", "sqrtPriceX96 limit, default no limit")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	addr, err := parseAddress(*poolFlag)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := decimal.NewFromString(*amountFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -amount: %w", err)
+	}
+	req := &uniswap_v3_simulator.QuoteRequest{
+		Pool:        addr,
+		ZeroForOne:  *zeroForOne,
+		ExactOutput: amount.IsNegative(),
+		Amount:      amount.Abs(),
+	}
+	if *limitFlag != "" {
+		v, err := decimal.NewFromString(*limitFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -price-limit: %w", err)
+		}
+		req.SqrtPriceLimitX96 = &v
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := uniswap_v3_simulator.NewAPI(pm).Quote(req)
+	if err != nil {
+		return nil, err
+	}
+	return quoteResult{
+		Pool:              addr.String(),
+		ZeroForOne:        req.ZeroForOne,
+		AmountSpecified:   amount,
+		SqrtPriceLimitX96: req.SqrtPriceLimitX96,
+		QuoteResponse:     resp,
+	}, nil
+}
+
+func runQuarantineList(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("quarantine list")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	return pm.QuarantinedPools(), nil
+}
+
+// quarantine clear/retry共用的参数解析, 返回pool原来的隔离记录
+func quarantineCommand(name string, args []string, fn func(pm *uniswap_v3_simulator.Simulator, addr common.Address, cfg config) error) (interface{}, error) {
+	fs, shared := newFlagSet("quarantine " + name)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("usage: quarantine %s [flags] <address>", name)
+	}
+	addr, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := pm.Quarantine.Get(addr)
+	if !ok {
+		return nil, fmt.Errorf("pool %s is not quarantined", addr)
+	}
+	err = fn(pm, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func runQuarantineClear(args []string) (interface{}, error) {
+	return quarantineCommand("clear", args, func(pm *uniswap_v3_simulator.Simulator, addr common.Address, cfg config) error {
+		return pm.ClearQuarantine(addr)
+	})
+}
+
+func runQuarantineRetry(args []string) (interface{}, error) {
+	return quarantineCommand("retry", args, func(pm *uniswap_v3_simulator.Simulator, addr common.Address, cfg config) error {
+		return pm.RetryQuarantined(addr, cfg.Step)
+	})
+}
+
+type arbitrageResult struct {
+	Block         uint64                                       `json:"block"`
+	Opportunities []*uniswap_v3_simulator.ArbitrageOpportunity `json:"opportunities"`
+}
+
+func runArbitrage(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("arbitrage")
+	maxHops := fs.Int("max-hops", 0, "pools per cycle (default 3)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	opportunities, block, err := pm.ScanArbitrage(*maxHops)
+	if err != nil {
+		return nil, err
+	}
+	return arbitrageResult{Block: block, Opportunities: opportunities}, nil
+}
+
+type verifyResult struct {
+	Consistent bool                                     `json:"consistent"`
+	Error      string                                   `json:"error,omitempty"`
+	Pools      []*uniswap_v3_simulator.PoolVerification `json:"pools"`
+}
+
+func (r *verifyResult) Failed() bool {
+	if !r.Consistent {
+		return true
+	}
+	for _, pool := range r.Pools {
+		if !pool.OK() {
+			return true
+		}
+	}
+	return false
+}
+
+func runVerify(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("verify")
+	poolsFlag := fs.String("pool", "", "comma separated pools to compare with the chain")
+	all := fs.Bool("all", false, "compare every pool with the chain")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	result := &verifyResult{Consistent: true, Pools: []*uniswap_v3_simulator.PoolVerification{}}
+	err = pm.CheckConsistency()
+	if err != nil {
+		result.Consistent = false
+		result.Error = err.Error()
+	}
+	var addresses []common.Address
+	if *all {
+		addresses = pm.PoolAddresses()
+	} else if *poolsFlag != "" {
+		for _, s := range strings.Split(*poolsFlag, ",") {
+			addr, err := parseAddress(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			addresses = append(addresses, addr)
+		}
+	}
+	for _, addr := range addresses {
+		verification, err := pm.VerifyPool(context.Background(), addr)
+		if err != nil {
+			return nil, fmt.Errorf("verify pool %s: %w", addr, err)
+		}
+		result.Pools = append(result.Pools, verification)
+	}
+	return result, nil
+}
+
+type exportResult struct {
+	Dir     string   `json:"dir"`
+	Formats []string `json:"formats"`
+	Pools   int      `json:"pools"`
+	Block   uint64   `json:"block"`
+}
+
+func runExport(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("export")
+	dir := fs.String("dir", "", "output directory")
+	formatsFlag := fs.String("format", "json", "comma separated formats: json, csv, parquet")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *dir == "" {
+		return nil, errors.New("-dir is required")
+	}
+	var formats []uniswap_v3_simulator.ExportFormat
+	var names []string
+	for _, s := range strings.Split(*formatsFlag, ",") {
+		format := uniswap_v3_simulator.ExportFormat(strings.TrimSpace(s))
+		switch format {
+		case uniswap_v3_simulator.ExportJSON, uniswap_v3_simulator.ExportCSV, uniswap_v3_simulator.ExportParquet:
+		default:
+			return nil, fmt.Errorf("unknown format %q", s)
+		}
+		formats = append(formats, format)
+		names = append(names, string(format))
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	pm, err := openSimulator(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	err = pm.Export(*dir, formats...)
+	if err != nil {
+		return nil, err
+	}
+	return exportResult{Dir: *dir, Formats: names, Pools: len(pm.PoolAddresses()), Block: pm.CurrentBlock()}, nil
+}
+
+func runSnapshotList(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("snapshot list")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	return uniswap_v3_simulator.ListDBSnapshots(cfg.DB)
+}
+
+func runSnapshotRestore(args []string) (interface{}, error) {
+	fs, shared := newFlagSet("snapshot restore")
+	block := fs.Uint64("block", 0, "block of the snapshot to restore, 0 for the latest")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := shared.load()
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := uniswap_v3_simulator.ListDBSnapshots(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("no snapshot of %s", cfg.DB)
+	}
+	snapshot := snapshots[len(snapshots)-1]
+	if *block != 0 {
+		found := false
+		for _, s := range snapshots {
+			if s.BlockNum == *block {
+				snapshot, found = s, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no snapshot of %s at block %d", cfg.DB, *block)
+		}
+	}
+	err = uniswap_v3_simulator.RestoreDBSnapshot(cfg.DB, snapshot.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
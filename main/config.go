@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// univ3 factory部署区块
+const defaultStartBlock = 12369620
+
+const (
+	policyQuarantine = "quarantine"
+	policyStrict     = "strict"
+
+	swapResolveDryRun   = "dry_run"
+	swapResolveCalldata = "calldata"
+)
+
+type config struct {
+	DB               string `json:"db"`
+	RPC              string `json:"rpc"`
+	StartBlock       uint64 `json:"start_block"`
+	Step             uint64 `json:"step"`
+	ReplayWorkers    int    `json:"replay_workers"`
+	FetchConcurrency int    `json:"fetch_concurrency"`
+	MetricsAddr      string `json:"metrics_addr"`
+	APIAddr          string `json:"api_addr"`
+	GRPCAddr         string `json:"grpc_addr"`
+	EthRPCAddr       string `json:"eth_rpc_addr"`
+	Policy           string `json:"policy"`            // quarantine: 隔离出错的pool继续同步, strict: 出错时中止同步
+	SwapResolve      string `json:"swap_resolve"`      // dry_run或calldata
+	CallFixture      string `json:"call_fixture"`      // calldata模式下交易调用的fixture文件, 为空时用rpc的trace
+	RecordBlockTime  bool   `json:"record_block_time"` // 事件历史写入区块时间
+}
+
+func defaultConfig() config {
+	return config{
+		DB:          "simulator.db",
+		RPC:         "http://127.0.0.1:8545",
+		StartBlock:  defaultStartBlock,
+		Step:        10000,
+		APIAddr:     ":8080",
+		Policy:      policyQuarantine,
+		SwapResolve: swapResolveDryRun,
+	}
+}
+
+// 所有子命令共用的参数, 优先级: 命令行 > 环境变量 > 配置文件 > 默认值
+type commonFlags struct {
+	fs         *flag.FlagSet
+	configFile string
+	db         string
+	rpc        string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	c := &commonFlags{fs: fs}
+	fs.StringVar(&c.configFile, "config", os.Getenv("UNIV3SIM_CONFIG"), "json config file (env UNIV3SIM_CONFIG)")
+	fs.StringVar(&c.db, "db", "", "sqlite database file (env UNIV3SIM_DB)")
+	fs.StringVar(&c.rpc, "rpc", "", "ethereum rpc url (env UNIV3SIM_RPC)")
+	return fs, c
+}
+
+func (c *commonFlags) load() (config, error) {
+	cfg := defaultConfig()
+	if c.configFile != "" {
+		data, err := os.ReadFile(c.configFile)
+		if err != nil {
+			return cfg, err
+		}
+		err = json.Unmarshal(data, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("parse config %s: %w", c.configFile, err)
+		}
+	}
+	if v := os.Getenv("UNIV3SIM_DB"); v != "" {
+		cfg.DB = v
+	}
+	if v := os.Getenv("UNIV3SIM_RPC"); v != "" {
+		cfg.RPC = v
+	}
+	if v := os.Getenv("UNIV3SIM_START_BLOCK"); v != "" {
+		block, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid UNIV3SIM_START_BLOCK: %w", err)
+		}
+		cfg.StartBlock = block
+	}
+	if c.db != "" {
+		cfg.DB = c.db
+	}
+	if c.rpc != "" {
+		cfg.RPC = c.rpc
+	}
+	return cfg, nil
+}
+
+// 命令行显式设置过的参数
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// sync和serve -follow应用事件时的参数
+type applyFlags struct {
+	fs              *flag.FlagSet
+	policy          *string
+	swapResolve     *string
+	callFixture     *string
+	recordBlockTime *bool
+}
+
+func newApplyFlags(fs *flag.FlagSet) *applyFlags {
+	return &applyFlags{
+		fs:              fs,
+		policy:          fs.String("policy", "", "what to do with a pool whose events fail: quarantine (default) skips the pool and keeps syncing, strict stops the sync"),
+		swapResolve:     fs.String("swap-resolve", "", "how swap inputs are resolved: dry_run (default) or calldata, which decodes the swap call and never quarantines a pool"),
+		callFixture:     fs.String("calls", "", "json fixture of transaction calls for -swap-resolve calldata, default trace the transactions over rpc"),
+		recordBlockTime: fs.Bool("block-time", false, "store block time in the event history, one rpc call per block"),
+	}
+}
+
+func (a *applyFlags) apply(cfg *config) {
+	if isSet(a.fs, "policy") {
+		cfg.Policy = *a.policy
+	}
+	if isSet(a.fs, "swap-resolve") {
+		cfg.SwapResolve = *a.swapResolve
+	}
+	if isSet(a.fs, "calls") {
+		cfg.CallFixture = *a.callFixture
+	}
+	if isSet(a.fs, "block-time") {
+		cfg.RecordBlockTime = *a.recordBlockTime
+	}
+}
+
+func (cfg config) validate() error {
+	if cfg.Policy != policyQuarantine && cfg.Policy != policyStrict {
+		return fmt.Errorf("unknown policy %q, expect %s or %s", cfg.Policy, policyQuarantine, policyStrict)
+	}
+	if cfg.SwapResolve != swapResolveDryRun && cfg.SwapResolve != swapResolveCalldata {
+		return fmt.Errorf("unknown swap resolve mode %q, expect %s or %s", cfg.SwapResolve, swapResolveDryRun, swapResolveCalldata)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommonFlags_LoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"db": "file.db", "rpc": "http://file", "start_block": 100, "step": 500}`), 0644))
+	cases := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		db         string
+		rpc        string
+		startBlock uint64
+		step       uint64
+		err        string
+	}{
+		{name: "default", db: "simulator.db", rpc: "http://127.0.0.1:8545", startBlock: defaultStartBlock, step: 10000},
+		{name: "file", args: []string{"-config", file}, db: "file.db", rpc: "http://file", startBlock: 100, step: 500},
+		{name: "config from env", env: map[string]string{"UNIV3SIM_CONFIG": file}, db: "file.db", rpc: "http://file", startBlock: 100, step: 500},
+		{
+			name:       "env over file",
+			args:       []string{"-config", file},
+			env:        map[string]string{"UNIV3SIM_DB": "env.db", "UNIV3SIM_START_BLOCK": "200"},
+			db:         "env.db",
+			rpc:        "http://file",
+			startBlock: 200,
+			step:       500,
+		},
+		{
+			name:       "flag over env",
+			args:       []string{"-config", file, "-db", "flag.db", "-rpc", "http://flag"},
+			env:        map[string]string{"UNIV3SIM_DB": "env.db", "UNIV3SIM_RPC": "http://env"},
+			db:         "flag.db",
+			rpc:        "http://flag",
+			startBlock: 100,
+			step:       500,
+		},
+		{name: "invalid start block", env: map[string]string{"UNIV3SIM_START_BLOCK": "abc"}, err: "invalid UNIV3SIM_START_BLOCK"},
+		{name: "missing file", args: []string{"-config", filepath.Join(t.TempDir(), "missing.json")}, err: "no such file"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, name := range []string{"UNIV3SIM_CONFIG", "UNIV3SIM_DB", "UNIV3SIM_RPC", "UNIV3SIM_START_BLOCK"} {
+				t.Setenv(name, c.env[name])
+			}
+			fs, shared := newFlagSet("test")
+			assert.NoError(t, fs.Parse(c.args))
+			cfg, err := shared.load()
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.db, cfg.DB)
+			assert.Equal(t, c.rpc, cfg.RPC)
+			assert.Equal(t, c.startBlock, cfg.StartBlock)
+			assert.Equal(t, c.step, cfg.Step)
+			assert.Equal(t, policyQuarantine, cfg.Policy)
+		})
+	}
+}
+
+func TestIsSet(t *testing.T) {
+	cases := []struct {
+		args []string
+		set  bool
+	}{
+		{args: nil, set: false},
+		{args: []string{"-from", "0"}, set: true},
+		{args: []string{"-from", "100"}, set: true},
+		{args: []string{"-db", "a.db"}, set: false},
+	}
+	for _, c := range cases {
+		fs, _ := newFlagSet("test")
+		fs.Uint64("from", 0, "")
+		assert.NoError(t, fs.Parse(c.args))
+		assert.Equal(t, c.set, isSet(fs, "from"), "%v", c.args)
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"policy": "strict", "swap_resolve": "calldata", "record_block_time": true}`), 0644))
+	t.Setenv("UNIV3SIM_CONFIG", "")
+	fs, shared := newFlagSet("test")
+	applying := newApplyFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"-config", file, "-policy", "quarantine", "-calls", "calls.json"}))
+	cfg, err := shared.load()
+	assert.NoError(t, err)
+	applying.apply(&cfg)
+	assert.NoError(t, cfg.validate())
+	assert.Equal(t, policyQuarantine, cfg.Policy)
+	assert.Equal(t, swapResolveCalldata, cfg.SwapResolve)
+	assert.Equal(t, "calls.json", cfg.CallFixture)
+	assert.True(t, cfg.RecordBlockTime)
+
+	cfg.SwapResolve = "trace"
+	assert.ErrorContains(t, cfg.validate(), "unknown swap resolve mode")
+}
@@ -1,15 +1,99 @@
 package main
 
-import uniswap_v3_simulator "github.com/CoinSummer/uniswap-v3-simulator"
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `usage: univ3sim <command> [flags]
+
+commands:
+  sync                 sync pool states from the chain
+  serve                serve pool states, quotes and simulations over http/grpc
+  status               show sync progress
+  pools list           list all pools
+  pool show <address>  show the full state of a pool
+  quote                quote a swap on a fork of a pool
+  quarantine list      list quarantined pools
+  quarantine clear     stop skipping a pool without rebuilding it
+  quarantine retry     rebuild a quarantined pool from its deploy block
+  arbitrage            find profitable arbitrage cycles among the synced pools
+  verify               check database consistency and compare pools with the chain
+  export               export pool states to json/csv/parquet
+  snapshot list        list database snapshots
+  snapshot restore     replace the database with a snapshot
+
+run 'univ3sim <command> -h' for the flags of a command.
+all commands print json to stdout.
+`
+
+type command func(args []string) (interface{}, error)
+
+var commands = map[string]command{
+	"sync":             runSync,
+	"serve":            runServe,
+	"status":           runStatus,
+	"pools list":       runPoolsList,
+	"pool show":        runPoolShow,
+	"quote":            runQuote,
+	"quarantine list":  runQuarantineList,
+	"quarantine clear": runQuarantineClear,
+	"quarantine retry": runQuarantineRetry,
+	"arbitrage":        runArbitrage,
+	"verify":           runVerify,
+	"export":           runExport,
+	"snapshot list":    runSnapshotList,
+	"snapshot restore": runSnapshotRestore,
+}
 
 func main() {
-	smt := uniswap_v3_simulator.NewPoolManager("simulator.db", "https://eth-hk1.csnodes.com/v1/973eeba6738a7d8c3bd54f91adcbea89", 12369620)
+	// 日志输出到stderr, stdout只有json结果
+	logrus.SetOutput(os.Stderr)
+	os.Exit(run(os.Args[1:]))
+}
 
-	//err := smt.Init(10000)
-	_, err := smt.SyncTo(16381994, 10000)
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	rest := args[1:]
+	if !ok && len(args) > 1 {
+		cmd, ok = commands[args[0]+" "+args[1]]
+		rest = args[2:]
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	result, err := cmd(rest)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
 	if err != nil {
-		panic(err)
+		writeJSON(map[string]string{"error": err.Error()})
+		return 1
+	}
+	if result != nil {
+		writeJSON(result)
 	}
-	smt.FlushPools()
+	if failed, ok := result.(interface{ Failed() bool }); ok && failed.Failed() {
+		return 1
+	}
+	return 0
+}
 
+func writeJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(v)
+	if err != nil {
+		logrus.Errorf("failed write output %s", err)
+	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Dispatch(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{name: "no command", args: nil, code: 2},
+		{name: "unknown command", args: []string{"unknown"}, code: 2},
+		{name: "unknown subcommand", args: []string{"pools", "unknown"}, code: 2},
+		{name: "help", args: []string{"sync", "-h"}, code: 0},
+		{name: "two word command help", args: []string{"pool", "show", "-h"}, code: 0},
+		{name: "invalid flag", args: []string{"status", "-unknown"}, code: 1},
+		// 参数检查在打开数据库之前
+		{name: "from zero", args: []string{"sync", "-from", "0"}, code: 1},
+		{name: "follow with to", args: []string{"sync", "-follow", "-to", "100"}, code: 1},
+		{name: "unknown policy", args: []string{"sync", "-policy", "skip"}, code: 1},
+		{name: "unknown swap resolve", args: []string{"serve", "-swap-resolve", "trace"}, code: 1},
+		{name: "quarantine clear without address", args: []string{"quarantine", "clear"}, code: 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.code, run(c.args))
+		})
+	}
+}
+
+func TestRun_ReadCommandsDoNotCreateDatabase(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "missing.db")
+	for _, args := range [][]string{
+		{"status"},
+		{"pools", "list"},
+		{"quarantine", "list"},
+		{"quote", "-pool", "0x8ad599c3A0ff1De082011EFDDc58f1908eb6e6D8", "-amount", "1"},
+	} {
+		assert.Equal(t, 1, run(append(args, "-db", db)), "%v", args)
+		_, err := os.Stat(db)
+		assert.True(t, os.IsNotExist(err), "%v", args)
+	}
+}
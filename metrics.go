@@ -0,0 +1,198 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const metricsPrefix = "uniswap_v3_simulator_"
+
+type swapResolveKey struct {
+	resolvedBy string
+	solution   int // dry run时成功的solution序号, 其它方式为-1
+}
+
+// 同步过程的指标, 以Prometheus文本格式输出. 只统计Simulator自身, 不包括fork上的模拟
+type Metrics struct {
+	headBlock atomic.Uint64
+	logs      atomic.Uint64
+
+	lock         sync.Mutex
+	events       map[string]uint64
+	swapResolves map[swapResolveKey]uint64
+	flushCount   uint64
+	flushErrors  uint64
+	flushSeconds float64
+	lastFlush    float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		events:       map[string]uint64{},
+		swapResolves: map[swapResolveKey]uint64{},
+	}
+}
+
+// 以下方法在Metrics为nil时不做任何事
+
+func (m *Metrics) observeHead(block uint64) {
+	if m == nil {
+		return
+	}
+	for {
+		head := m.headBlock.Load()
+		if block <= head || m.headBlock.CompareAndSwap(head, block) {
+			return
+		}
+	}
+}
+
+func (m *Metrics) logsReceived(n int) {
+	if m == nil {
+		return
+	}
+	m.logs.Add(uint64(n))
+}
+
+func (m *Metrics) eventApplied(event string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.events[event]++
+}
+
+func (m *Metrics) swapResolved(resolvedBy string, solution int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.swapResolves[swapResolveKey{resolvedBy: resolvedBy, solution: solution}]++
+}
+
+func (m *Metrics) flushed(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.flushCount++
+	if err != nil {
+		m.flushErrors++
+	}
+	m.flushSeconds += d.Seconds()
+	m.lastFlush = d.Seconds()
+}
+
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *metricsWriter) header(name, kind, help string) {
+	mw.printf("# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+}
+
+func (mw *metricsWriter) value(name string, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	mw.printf("%s%s%s %s\n", metricsPrefix, name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (mw *metricsWriter) printf(format string, args ...interface{}) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, args...)
+	}
+}
+
+// 按Prometheus文本格式写出所有指标
+func (pm *Simulator) WriteMetrics(w io.Writer) error {
+	m := pm.metrics
+	mw := &metricsWriter{w: w}
+
+	mw.header("synced_block", "gauge", "Last block applied to the in-memory state.")
+	mw.value("synced_block", "", float64(pm.CurrentBlock()))
+	// 还没有见过链上区块时不输出, 避免0被当作链头
+	if head := m.headBlock.Load(); head > 0 {
+		mw.header("head_block", "gauge", "Latest chain head seen from the node.")
+		mw.value("head_block", "", float64(head))
+	}
+	mw.header("logs_total", "counter", "Logs received for applying, use rate() for logs per second.")
+	mw.value("logs_total", "", float64(m.logs.Load()))
+	mw.header("quarantined_pools", "gauge", "Pools currently quarantined.")
+	mw.value("quarantined_pools", "", float64(len(pm.QuarantinedPools())))
+
+	m.lock.Lock()
+	mw.header("events_applied_total", "counter", "Events applied by type.")
+	events := make([]string, 0, len(m.events))
+	for event := range m.events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	for _, event := range events {
+		mw.value("events_applied_total", fmt.Sprintf("event=%q", event), float64(m.events[event]))
+	}
+	mw.header("swap_resolve_total", "counter", "Swap input resolutions by method and dry run solution index.")
+	keys := make([]swapResolveKey, 0, len(m.swapResolves))
+	for key := range m.swapResolves {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].resolvedBy != keys[j].resolvedBy {
+			return keys[i].resolvedBy < keys[j].resolvedBy
+		}
+		return keys[i].solution < keys[j].solution
+	})
+	for _, key := range keys {
+		solution := ""
+		if key.solution >= 0 {
+			solution = strconv.Itoa(key.solution)
+		}
+		mw.value("swap_resolve_total", fmt.Sprintf("resolved_by=%q,solution=%q", key.resolvedBy, solution), float64(m.swapResolves[key]))
+	}
+	mw.header("flush_duration_seconds", "summary", "Time spent flushing pools and records to the database.")
+	mw.value("flush_duration_seconds_sum", "", m.flushSeconds)
+	mw.value("flush_duration_seconds_count", "", float64(m.flushCount))
+	mw.header("last_flush_duration_seconds", "gauge", "Duration of the last flush.")
+	mw.value("last_flush_duration_seconds", "", m.lastFlush)
+	mw.header("flush_errors_total", "counter", "Failed flushes.")
+	mw.value("flush_errors_total", "", float64(m.flushErrors))
+	m.lock.Unlock()
+
+	if info, err := os.Stat(pm.dbfile); err == nil {
+		mw.header("db_size_bytes", "gauge", "Size of the sqlite database file.")
+		mw.value("db_size_bytes", "", float64(info.Size()))
+	}
+	return mw.err
+}
+
+func (pm *Simulator) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		err := pm.WriteMetrics(w)
+		if err != nil {
+			logrus.Warnf("failed write metrics %s", err)
+		}
+	})
+}
+
+// 在addr上提供/metrics, 直到ctx取消
+func (pm *Simulator) ServeMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", pm.MetricsHandler())
+	logrus.Infof("serve metrics on %s/metrics", addr)
+	return serveHTTP(ctx, addr, mux)
+}
@@ -0,0 +1,55 @@
+package uniswap_v3_simulator
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator_Metrics(t *testing.T) {
+	_, url := newFakeLogRPC(t, 1000, false)
+	pm := NewPoolManager(filepath.Join(t.TempDir(), "simulator.db"), url, 0)
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	owner := "0x1111111111111111111111111111111111111111"
+	assert.NoError(t, pm.HandleLogs([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 1, 0)}))
+	assert.NoError(t, pm.HandleLogs([]types.Log{testSwapLog(t, pool, owner, true, decimal.NewFromInt(1e16), 1, 1)}))
+	// fork上的事件不计入
+	fork := NewSimulatorSnapshot(pm)
+	assert.NoError(t, fork.HandleLogs([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 2, 0)}))
+	var out strings.Builder
+	assert.NoError(t, pm.WriteMetrics(&out))
+	assert.NotContains(t, out.String(), "head_block")
+	// 指定to的同步不查询最新区块, 链头来自同步的区块
+	_, err := pm.SyncBlocks(1000, 99)
+	assert.NoError(t, err)
+	assert.NoError(t, pm.FlushPools())
+
+	server := httptest.NewServer(pm.MetricsHandler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	text := string(body)
+	assert.Contains(t, text, "# TYPE uniswap_v3_simulator_synced_block gauge\nuniswap_v3_simulator_synced_block 1000\n")
+	assert.Contains(t, text, "uniswap_v3_simulator_head_block 1000\n")
+	assert.Contains(t, text, "uniswap_v3_simulator_logs_total 1000\n")
+	assert.Contains(t, text, `uniswap_v3_simulator_events_applied_total{event="mint"} 1`+"\n")
+	assert.Contains(t, text, `uniswap_v3_simulator_events_applied_total{event="swap"} 1`+"\n")
+	assert.Contains(t, text, `uniswap_v3_simulator_swap_resolve_total{resolved_by="dry_run",solution="0"} 1`+"\n")
+	// 新数据库带有旧版本跳过的pool
+	assert.Contains(t, text, fmt.Sprintf("uniswap_v3_simulator_quarantined_pools %d\n", len(legacySkipAddress)))
+	assert.Contains(t, text, "uniswap_v3_simulator_flush_duration_seconds_count 2\n")
+	assert.Contains(t, text, "uniswap_v3_simulator_db_size_bytes ")
+}
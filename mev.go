@@ -0,0 +1,403 @@
+package uniswap_v3_simulator
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 同一区块同一pool中, 攻击者在受害者swap前后各有一笔反向的swap
+type Sandwich struct {
+	Id            string `gorm:"primarykey"` // 前置swap的txHash_logIndex
+	PoolAddress   string `gorm:"index:idx_sandwich_pool_block"`
+	BlockNum      uint64 `gorm:"index:idx_sandwich_pool_block"`
+	Attacker      string `gorm:"index"` // 前置swap的recipient
+	FrontTxHash   string
+	FrontLogIndex uint
+	BackTxHash    string
+	BackLogIndex  uint
+	ZeroForOne    bool // 前置swap的方向
+	// 攻击者两笔swap的净收益, 不含gas和给builder的费用
+	Profit0 decimal.Decimal
+	Profit1 decimal.Decimal
+	// 有前置swap之前的状态时才能重放计算受害者损失
+	Replayed bool
+	Victims  []*SandwichVictim `gorm:"foreignKey:SandwichId"`
+}
+
+type SandwichVictim struct {
+	Id         string `gorm:"primarykey"` // txHash_logIndex
+	SandwichId string `gorm:"index"`
+	TxHash     string
+	LogIndex   uint
+	// 实际的数量减去去掉前置swap重放得到的数量, 以pool的视角, 正数为受害者多付或少收
+	Loss0 decimal.Decimal
+	Loss1 decimal.Decimal
+}
+
+func recordParamInt(record *Record, name string) (int, error) {
+	v, err := strconv.Atoi(record.Params[name])
+	if err != nil {
+		return 0, fmt.Errorf("record %s param %s: %w", record.Id, name, err)
+	}
+	return v, nil
+}
+
+func recordParamDecimal(record *Record, name string) (decimal.Decimal, error) {
+	v, err := decimal.NewFromString(record.Params[name])
+	if err != nil {
+		return ZERO, fmt.Errorf("record %s param %s: %w", record.Id, name, err)
+	}
+	return v, nil
+}
+
+func recordZeroForOne(record *Record) bool {
+	if v, err := strconv.ParseBool(record.Params["zero_for_one"]); err == nil {
+		return v
+	}
+	return record.Amount0.IsPositive()
+}
+
+// swap的输入参数. 直接应用结果的swap没有amount_specified, 按实际输入数量的exact input重放
+func recordSwapInput(record *Record) (bool, decimal.Decimal, *decimal.Decimal, error) {
+	zeroForOne := recordZeroForOne(record)
+	amountSpecified := record.Amount1
+	if zeroForOne {
+		amountSpecified = record.Amount0
+	}
+	var err error
+	if _, ok := record.Params["amount_specified"]; ok {
+		amountSpecified, err = recordParamDecimal(record, "amount_specified")
+		if err != nil {
+			return false, ZERO, nil, err
+		}
+	}
+	if _, ok := record.Params["sqrt_price_limit_x96"]; !ok {
+		return zeroForOne, amountSpecified, nil, nil
+	}
+	limit, err := recordParamDecimal(record, "sqrt_price_limit_x96")
+	if err != nil {
+		return false, ZERO, nil, err
+	}
+	return zeroForOne, amountSpecified, &limit, nil
+}
+
+// 在另一个状态上重新执行已记录的事件, 返回新的amount0/amount1
+func replayRecord(pool *CorePool, record *Record) (decimal.Decimal, decimal.Decimal, error) {
+	switch record.ActionType {
+	case ActionSwap:
+		zeroForOne, amountSpecified, limit, err := recordSwapInput(record)
+		if err != nil {
+			return ZERO, ZERO, err
+		}
+		amount0, amount1, _, err := pool.HandleSwap(zeroForOne, amountSpecified, limit, false)
+		return amount0, amount1, err
+	case ActionMint, ActionBurn, ActionCollect:
+		tickLower, err := recordParamInt(record, "tick_lower")
+		if err != nil {
+			return ZERO, ZERO, err
+		}
+		tickUpper, err := recordParamInt(record, "tick_upper")
+		if err != nil {
+			return ZERO, ZERO, err
+		}
+		if record.ActionType == ActionCollect {
+			return pool.Collect(record.Owner, tickLower, tickUpper, record.Amount0, record.Amount1)
+		}
+		amount, err := recordParamDecimal(record, "amount")
+		if err != nil {
+			return ZERO, ZERO, err
+		}
+		if record.ActionType == ActionMint {
+			return pool.Mint(record.Owner, tickLower, tickUpper, amount)
+		}
+		return pool.Burn(record.Owner, tickLower, tickUpper, amount)
+	case ActionFlash:
+		return record.Amount0, record.Amount1, pool.Flash(record.Amount0, record.Amount1)
+	}
+	return ZERO, ZERO, fmt.Errorf("record %s: unknown action %s", record.Id, record.ActionType)
+}
+
+// swap的参与方, sender一般是路由或机器人合约
+func swapActors(record *Record) (string, string) {
+	return common.HexToAddress(record.Owner).String(), common.HexToAddress(record.Params["recipient"]).String()
+}
+
+func isSwap(event *PoolEvent) bool {
+	return event.Record != nil && event.Record.ActionType == ActionSwap
+}
+
+// 按区块分析pool事件检测三明治攻击和JIT流动性, 结果写入sandwiches和jit_liquidities表.
+// 事件必须按日志顺序完整地传入, 不是并发安全的
+type MEVAnalyzer struct {
+	db      *gorm.DB
+	states  map[common.Address]*CorePool // 每个pool上一个区块结束时的状态
+	block   uint64
+	pending []*PoolEvent    // 当前区块的事件
+	jit     []*JITLiquidity // 已检测但还没有取走的JIT流动性
+}
+
+func (pm *Simulator) NewMEVAnalyzer() *MEVAnalyzer {
+	return &MEVAnalyzer{db: pm.db, states: map[common.Address]*CorePool{}}
+}
+
+// 设置分析开始时pool的状态, 例如ObserveFromSnapshot得到的fork
+func (a *MEVAnalyzer) Seed(fork *SimulatorFork) {
+	for addr, pool := range fork.Pools {
+		a.states[addr] = pool
+	}
+}
+
+// 事件进入新的区块时分析之前的区块, 返回发现的三明治
+func (a *MEVAnalyzer) Add(event *PoolEvent) ([]*Sandwich, error) {
+	var found []*Sandwich
+	var err error
+	if event.BlockNum != a.block && len(a.pending) > 0 {
+		found, err = a.Flush()
+	}
+	a.block = event.BlockNum
+	a.pending = append(a.pending, event)
+	return found, err
+}
+
+// 分析缓存的区块, 同步结束时调用. 检测到的JIT流动性通过TakeJITLiquidity取得
+func (a *MEVAnalyzer) Flush() ([]*Sandwich, error) {
+	pools := map[common.Address][]*PoolEvent{}
+	var order []common.Address
+	for _, event := range a.pending {
+		if _, ok := pools[event.Pool]; !ok {
+			order = append(order, event.Pool)
+		}
+		pools[event.Pool] = append(pools[event.Pool], event)
+	}
+	a.pending = nil
+	found := []*Sandwich{}
+	var jit []*JITLiquidity
+	for _, addr := range order {
+		events := pools[addr]
+		found = append(found, detectSandwiches(a.states[addr], events)...)
+		jit = append(jit, detectJITLiquidity(a.states[addr], events)...)
+		a.states[addr] = events[len(events)-1].State
+	}
+	a.jit = append(a.jit, jit...)
+	if a.db == nil || len(found)+len(jit) == 0 {
+		return found, nil
+	}
+	return found, a.db.Transaction(func(tx *gorm.DB) error {
+		if len(found) > 0 {
+			var victims []*SandwichVictim
+			for _, sandwich := range found {
+				victims = append(victims, sandwich.Victims...)
+			}
+			err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Omit(clause.Associations).Create(found).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(victims).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(jit) > 0 {
+			return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(jit).Error
+		}
+		return nil
+	})
+}
+
+// 返回上次调用之后Flush检测到的JIT流动性
+func (a *MEVAnalyzer) TakeJITLiquidity() []*JITLiquidity {
+	jit := a.jit
+	a.jit = nil
+	return jit
+}
+
+// 消费ChannelObserver的事件直到channel关闭. 写入失败只记录日志, 以免阻塞同步
+func (a *MEVAnalyzer) Run(events <-chan *PoolEvent) {
+	for event := range events {
+		a.logFound(a.Add(event))
+	}
+	a.logFound(a.Flush())
+}
+
+func (a *MEVAnalyzer) logFound(found []*Sandwich, err error) {
+	if err != nil {
+		logrus.Errorf("failed save mev: %s", err)
+	}
+	for _, sandwich := range found {
+		logrus.Infof("sandwich in block %d pool %s by %s, victims: %d", sandwich.BlockNum, sandwich.PoolAddress, sandwich.Attacker, len(sandwich.Victims))
+	}
+	for _, jit := range a.TakeJITLiquidity() {
+		logrus.Infof("jit liquidity in block %d pool %s by %s, fees: %s %s", jit.BlockNum, jit.PoolAddress, jit.Owner, jit.Fees0, jit.Fees1)
+	}
+}
+
+// 在fork上应用已归档的日志并分析, fork应处于这些日志之前的状态
+func (a *MEVAnalyzer) AnalyzeLogs(fork *SimulatorFork, logs []types.Log) ([]*Sandwich, error) {
+	for _, log := range logs {
+		if _, ok := a.states[log.Address]; ok {
+			continue
+		}
+		if pool, err := fork.GetPool(log.Address); err == nil {
+			a.states[log.Address] = pool.Fork()
+		}
+	}
+	var events []*PoolEvent
+	observer := fork.Observer
+	fork.Observer = ObserverFunc(func(event *PoolEvent) {
+		events = append(events, event)
+	})
+	err := fork.HandleLogs(logs)
+	fork.Observer = observer
+	if err != nil {
+		return nil, err
+	}
+	found := []*Sandwich{}
+	for _, event := range events {
+		sandwiches, err := a.Add(event)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, sandwiches...)
+	}
+	sandwiches, err := a.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return append(found, sandwiches...), nil
+}
+
+// before为events之前的状态, 为nil时不计算受害者损失. events为同一pool同一区块按日志顺序的事件
+func detectSandwiches(before *CorePool, events []*PoolEvent) []*Sandwich {
+	found := []*Sandwich{}
+	used := map[int]bool{}
+	for i, front := range events {
+		if !isSwap(front) || used[i] {
+			continue
+		}
+		_, attacker := swapActors(front.Record)
+		zeroForOne := recordZeroForOne(front.Record)
+		for j := i + 1; j < len(events); j++ {
+			back := events[j]
+			if !isSwap(back) || used[j] || back.TxHash == front.TxHash || recordZeroForOne(back.Record) == zeroForOne {
+				continue
+			}
+			sender, recipient := swapActors(back.Record)
+			if sender != attacker && recipient != attacker {
+				continue
+			}
+			sandwich := newSandwich(before, events, i, j, attacker)
+			if sandwich != nil {
+				found = append(found, sandwich)
+				used[i], used[j] = true, true
+			}
+			break
+		}
+	}
+	return found
+}
+
+func newSandwich(before *CorePool, events []*PoolEvent, i, j int, attacker string) *Sandwich {
+	front, back := events[i], events[j]
+	zeroForOne := recordZeroForOne(front.Record)
+	sandwich := &Sandwich{
+		Id:            front.Record.Id,
+		PoolAddress:   front.Record.PoolAddress,
+		BlockNum:      front.BlockNum,
+		Attacker:      attacker,
+		FrontTxHash:   front.Record.TxHash,
+		FrontLogIndex: front.LogIndex,
+		BackTxHash:    back.Record.TxHash,
+		BackLogIndex:  back.LogIndex,
+		ZeroForOne:    zeroForOne,
+		Profit0:       front.Record.Amount0.Add(back.Record.Amount0).Neg(),
+		Profit1:       front.Record.Amount1.Add(back.Record.Amount1).Neg(),
+	}
+	victims := map[int]bool{}
+	for k := i + 1; k < j; k++ {
+		event := events[k]
+		if !isSwap(event) || event.TxHash == front.TxHash || event.TxHash == back.TxHash || recordZeroForOne(event.Record) != zeroForOne {
+			continue
+		}
+		sender, recipient := swapActors(event.Record)
+		if sender == attacker || recipient == attacker {
+			continue
+		}
+		victims[k] = true
+		sandwich.Victims = append(sandwich.Victims, &SandwichVictim{
+			Id:         event.Record.Id,
+			SandwichId: sandwich.Id,
+			TxHash:     event.Record.TxHash,
+			LogIndex:   event.LogIndex,
+		})
+	}
+	if len(sandwich.Victims) == 0 {
+		return nil
+	}
+	// 前置swap之前的状态
+	pre := before
+	if i > 0 {
+		pre = events[i-1].State
+	}
+	if pre == nil {
+		return sandwich
+	}
+	pool := pre.Fork()
+	victim := 0
+	for k := i + 1; k < j; k++ {
+		if events[k].Record == nil {
+			continue
+		}
+		amount0, amount1, err := replayRecord(pool, events[k].Record)
+		if err != nil {
+			logrus.Warnf("failed replay %s without front run %s: %s", events[k].Record.Id, sandwich.Id, err)
+			return sandwich
+		}
+		if victims[k] {
+			sandwich.Victims[victim].Loss0 = events[k].Record.Amount0.Sub(amount0)
+			sandwich.Victims[victim].Loss1 = events[k].Record.Amount1.Sub(amount1)
+			victim++
+		}
+	}
+	sandwich.Replayed = true
+	return sandwich
+}
+
+type SandwichQuery struct {
+	PoolAddress string
+	Attacker    string
+	FromBlock   uint64 // 0表示不限制
+	ToBlock     uint64 // 0表示不限制, inclusive
+	Limit       int
+}
+
+// 按区块顺序返回检测到的三明治和受害者
+func (pm *Simulator) QuerySandwiches(q SandwichQuery) ([]*Sandwich, error) {
+	db := pm.db.Model(&Sandwich{}).Preload("Victims", func(db *gorm.DB) *gorm.DB {
+		return db.Order("log_index")
+	})
+	if q.PoolAddress != "" {
+		db = db.Where("pool_address = ?", q.PoolAddress)
+	}
+	if q.Attacker != "" {
+		db = db.Where("attacker = ?", q.Attacker)
+	}
+	if q.FromBlock > 0 {
+		db = db.Where("block_num >= ?", q.FromBlock)
+	}
+	if q.ToBlock > 0 {
+		db = db.Where("block_num <= ?", q.ToBlock)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	var sandwiches []*Sandwich
+	err := db.Order("block_num, front_log_index").Find(&sandwiches).Error
+	return sandwiches, err
+}
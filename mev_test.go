@@ -0,0 +1,127 @@
+package uniswap_v3_simulator
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAttacker = "0xa11ce00000000000000000000000000000000001"
+	testVictim   = "0xb0b0000000000000000000000000000000000002"
+)
+
+func newTestMEVPool(t *testing.T) *CorePool {
+	pool := newTestPool(t)
+	_, _, err := pool.Mint("0xc36442b4a4522e871399cd717abdd847ab11fe88", -60000, 60000, decimal.NewFromInt(1e18).Mul(decimal.NewFromInt(100)))
+	assert.NoError(t, err)
+	return pool
+}
+
+// 在shadow上依次执行swap并生成对应的log
+func testSwapLogs(t *testing.T, shadow *CorePool, block uint64, swaps ...func(shadow *CorePool) (string, bool, decimal.Decimal)) []types.Log {
+	var logs []types.Log
+	for i, swap := range swaps {
+		sender, zeroForOne, amount := swap(shadow)
+		logs = append(logs, testSwapLog(t, shadow, sender, zeroForOne, amount, block, uint(i)))
+		_, _, _, err := shadow.HandleSwap(zeroForOne, amount, nil, false)
+		assert.NoError(t, err)
+	}
+	return logs
+}
+
+func fixedSwap(sender string, zeroForOne bool, amount decimal.Decimal) func(*CorePool) (string, bool, decimal.Decimal) {
+	return func(*CorePool) (string, bool, decimal.Decimal) {
+		return sender, zeroForOne, amount
+	}
+}
+
+// 前置买入token0, 受害者买入token0, 攻击者卖出前置得到的全部token0
+func testSandwichLogs(t *testing.T, shadow *CorePool, block uint64) []types.Log {
+	var bought decimal.Decimal
+	return testSwapLogs(t, shadow, block,
+		func(shadow *CorePool) (string, bool, decimal.Decimal) {
+			amount0, _, _, err := shadow.Clone().HandleSwap(false, decimal.NewFromInt(1e17), nil, false)
+			assert.NoError(t, err)
+			bought = amount0.Neg()
+			return testAttacker, false, decimal.NewFromInt(1e17)
+		},
+		fixedSwap(testVictim, false, decimal.NewFromInt(1e18)),
+		func(*CorePool) (string, bool, decimal.Decimal) {
+			return testAttacker, true, bought
+		},
+	)
+}
+
+func TestMEVAnalyzer_AnalyzeLogs(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestMEVPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	expected, shadow := pool.Clone(), pool.Clone()
+
+	logs := testSandwichLogs(t, shadow, 20)
+	// 不同参与方的同向swap不是三明治
+	logs = append(logs, testSwapLogs(t, shadow, 21,
+		fixedSwap(testVictim, true, decimal.NewFromInt(1e16)),
+		fixedSwap(testAttacker, false, decimal.NewFromInt(1e16)),
+	)...)
+
+	analyzer := pm.NewMEVAnalyzer()
+	found, err := analyzer.AnalyzeLogs(NewSimulatorSnapshot(pm), logs)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	sandwich := found[0]
+	assert.Equal(t, uint64(20), sandwich.BlockNum)
+	assert.Equal(t, common.HexToAddress(testAttacker).String(), sandwich.Attacker)
+	assert.False(t, sandwich.ZeroForOne)
+	assert.True(t, sandwich.Replayed)
+	assert.True(t, sandwich.Profit0.IsZero())
+	assert.True(t, sandwich.Profit1.IsPositive())
+	assert.Len(t, sandwich.Victims, 1)
+	// 受害者少收了token0, 付出的token1相同
+	assert.True(t, sandwich.Victims[0].Loss0.IsPositive())
+	assert.True(t, sandwich.Victims[0].Loss1.IsZero())
+
+	saved, err := pm.QuerySandwiches(SandwichQuery{PoolAddress: addr.String()})
+	assert.NoError(t, err)
+	assert.Len(t, saved, 1)
+	assert.Len(t, saved[0].Victims, 1)
+	assert.True(t, saved[0].Victims[0].Loss0.Equal(sandwich.Victims[0].Loss0))
+	// 分析不改变Simulator
+	assert.True(t, DiffPools(expected, pool).Empty())
+}
+
+func TestMEVAnalyzer_DuringSync(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestMEVPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	logs := testSandwichLogs(t, pool.Clone(), 30)
+
+	analyzer := pm.NewMEVAnalyzer()
+	observer := NewChannelObserver(16)
+	observer.Blocking = true
+	fork, _, id, err := pm.ObserveFromSnapshot(observer)
+	assert.NoError(t, err)
+	analyzer.Seed(fork)
+	done := make(chan struct{})
+	go func() {
+		analyzer.Run(observer.C)
+		close(done)
+	}()
+	assert.NoError(t, pm.HandleLogs(logs))
+	pm.RemoveObserver(id)
+	close(observer.C)
+	<-done
+
+	saved, err := pm.QuerySandwiches(SandwichQuery{Attacker: common.HexToAddress(testAttacker).String()})
+	assert.NoError(t, err)
+	assert.Len(t, saved, 1)
+	assert.Equal(t, uint64(30), saved[0].BlockNum)
+	assert.True(t, saved[0].Replayed)
+	assert.True(t, saved[0].Victims[0].Loss0.IsPositive())
+}
@@ -0,0 +1,210 @@
+package uniswap_v3_simulator
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Simulator应用一个事件之后的通知
+type PoolEvent struct {
+	Pool      common.Address `json:"pool"`
+	Event     string         `json:"event"` // initialize/mint/burn/swap/collect/flash
+	TxHash    common.Hash    `json:"tx_hash"`
+	LogIndex  uint           `json:"log_index"`
+	BlockNum  uint64         `json:"block_num"`
+	Before    Slot0Export    `json:"before"` // initialize时为零值
+	After     Slot0Export    `json:"after"`
+	Liquidity ValueChange    `json:"liquidity"`
+	Record    *Record        `json:"record,omitempty"` // initialize时为nil
+	State     *CorePool      `json:"-"`                // 应用事件之后的pool快照(fork), 可以保留和读取
+}
+
+// before为应用事件之前的pool状态, initialize时为nil
+func newPoolEvent(event string, log *types.Log, before *Slot0Export, liquidityBefore decimal.Decimal, after *CorePool, record *Record) *PoolEvent {
+	e := &PoolEvent{
+		Pool:      log.Address,
+		Event:     event,
+		TxHash:    log.TxHash,
+		LogIndex:  log.Index,
+		BlockNum:  log.BlockNumber,
+		After:     Slot0Export{SqrtPriceX96: after.SqrtPriceX96, Tick: after.TickCurrent},
+		Liquidity: ValueChange{Before: liquidityBefore, After: after.Liquidity},
+		Record:    record,
+		State:     after,
+	}
+	if before != nil {
+		e.Before = *before
+	}
+	return e
+}
+
+// 事件前后所在的tick不同
+func (e *PoolEvent) TickCrossed() bool {
+	return e.Event != "initialize" && e.Before.Tick != e.After.Tick
+}
+
+// 回调在应用事件的goroutine上同步执行, 此时持有Simulator的锁,
+// 所以不能调用Simulator的方法, 耗时的处理应交给ChannelObserver
+type Observer interface {
+	OnPoolEvent(event *PoolEvent)
+}
+
+type ObserverFunc func(event *PoolEvent)
+
+func (f ObserverFunc) OnPoolEvent(event *PoolEvent) {
+	f(event)
+}
+
+// AddObserver返回的注册标识, 用于RemoveObserver
+type ObserverID uint64
+
+type registeredObserver struct {
+	id       ObserverID
+	observer Observer
+}
+
+// 注册之后应用的每个事件都会通知observer, 按日志顺序. 一批日志全部应用成功后才通知,
+// 失败的批次不通知; 之后flush失败重新加载时已经发出的通知不会撤回
+func (pm *Simulator) AddObserver(observer Observer) ObserverID {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.addObserver(observer)
+}
+
+// 调用方持有lock
+func (pm *Simulator) addObserver(observer Observer) ObserverID {
+	pm.nextObserverID++
+	pm.observers = append(pm.observers, registeredObserver{id: pm.nextObserverID, observer: observer})
+	return pm.nextObserverID
+}
+
+// 移除AddObserver/ObserveFromSnapshot注册的observer, 已经移除的id忽略
+func (pm *Simulator) RemoveObserver(id ObserverID) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	for i, o := range pm.observers {
+		if o.id == id {
+			pm.observers = append(pm.observers[:i:i], pm.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// 在同一次加锁中分叉pool并注册observer, 之后通知的事件都发生在fork的状态之后,
+// 可以用来维护副本. addrs为空时分叉所有pool
+func (pm *Simulator) ObserveFromSnapshot(observer Observer, addrs ...common.Address) (*SimulatorFork, uint64, ObserverID, error) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if len(addrs) == 0 {
+		for addr := range pm.Pools {
+			addrs = append(addrs, addr)
+		}
+	}
+	fork, block, err := pm.snapshot(addrs)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return fork, block, pm.addObserver(observer), nil
+}
+
+// 调用方持有lock
+func (pm *Simulator) notify(events []*PoolEvent) {
+	for _, event := range events {
+		for _, o := range pm.observers {
+			o.observer.OnPoolEvent(event)
+		}
+	}
+}
+
+func (pm *Simulator) observing() bool {
+	return len(pm.observers) > 0
+}
+
+// 保留事件时的状态: pool之后还会被修改, record在flush时会填充时间戳
+func snapshotEvent(event *PoolEvent) {
+	event.State = event.State.Fork()
+	if event.Record != nil {
+		record := *event.Record
+		event.Record = &record
+	}
+}
+
+// 按日志顺序排序, 并行应用时各分片的事件合并后使用
+func sortPoolEvents(events []*PoolEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].BlockNum != events[j].BlockNum {
+			return events[i].BlockNum < events[j].BlockNum
+		}
+		return events[i].LogIndex < events[j].LogIndex
+	})
+}
+
+// 把事件发送到channel. 默认不阻塞同步, channel满时丢弃并计数; Blocking为true时等待消费,
+// 此时消费方不能在处理事件时调用Simulator的方法, 否则会死锁
+type ChannelObserver struct {
+	C        chan *PoolEvent
+	Blocking bool
+	dropped  atomic.Uint64
+}
+
+func NewChannelObserver(size int) *ChannelObserver {
+	return &ChannelObserver{C: make(chan *PoolEvent, size)}
+}
+
+func (o *ChannelObserver) OnPoolEvent(event *PoolEvent) {
+	if o.Blocking {
+		o.C <- event
+		return
+	}
+	select {
+	case o.C <- event:
+	default:
+		o.dropped.Add(1)
+	}
+}
+
+// channel满时丢弃的事件数量
+func (o *ChannelObserver) Dropped() uint64 {
+	return o.dropped.Load()
+}
+
+// 每个事件写一行json
+type JSONLinesObserver struct {
+	lock sync.Mutex
+	w    io.Writer
+	err  error
+}
+
+func NewJSONLinesObserver(w io.Writer) *JSONLinesObserver {
+	return &JSONLinesObserver{w: w}
+}
+
+func (o *JSONLinesObserver) OnPoolEvent(event *PoolEvent) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	line, err := json.Marshal(event)
+	if err == nil {
+		_, err = o.w.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logrus.Errorf("failed write pool event %s_%d: %s", event.TxHash, event.LogIndex, err)
+		if o.err == nil {
+			o.err = err
+		}
+	}
+}
+
+// 第一次写入失败的错误
+func (o *JSONLinesObserver) Err() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.err
+}
@@ -0,0 +1,130 @@
+package uniswap_v3_simulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator_ObserverSequentialAndParallel(t *testing.T) {
+	initial, logs := testInterleavedLogs(t, 4, 100)
+	sequential := newTestSimulator(t, "")
+	parallel := newTestSimulator(t, "")
+	for addr, pool := range initial {
+		sequential.Pools[addr] = pool.Clone()
+		parallel.Pools[addr] = pool.Clone()
+	}
+	var sequentialEvents, parallelEvents []*PoolEvent
+	sequential.AddObserver(ObserverFunc(func(event *PoolEvent) {
+		sequentialEvents = append(sequentialEvents, event)
+	}))
+	parallel.AddObserver(ObserverFunc(func(event *PoolEvent) {
+		parallelEvents = append(parallelEvents, event)
+	}))
+	assert.NoError(t, sequential.HandleLogs(logs))
+	assert.NoError(t, parallel.ApplyLogsParallel(logs, 4))
+
+	assert.Len(t, sequentialEvents, len(logs))
+	assert.Len(t, parallelEvents, len(logs))
+	for i, event := range sequentialEvents {
+		assert.Equal(t, logs[i].BlockNumber, event.BlockNum)
+		assert.Equal(t, logs[i].Index, event.LogIndex)
+		assert.Equal(t, event.Event, parallelEvents[i].Event)
+		assert.True(t, event.After.SqrtPriceX96.Equal(parallelEvents[i].After.SqrtPriceX96))
+		assert.True(t, event.Liquidity.After.Equal(parallelEvents[i].Liquidity.After))
+		// 快照保留事件时的状态
+		assert.True(t, event.State.SqrtPriceX96.Equal(event.After.SqrtPriceX96))
+	}
+	// 同一个pool的事件首尾相接
+	last := map[common.Address]*PoolEvent{}
+	for _, event := range sequentialEvents {
+		if prev, ok := last[event.Pool]; ok {
+			assert.True(t, prev.After.SqrtPriceX96.Equal(event.Before.SqrtPriceX96))
+			assert.Equal(t, prev.After.Tick, event.Before.Tick)
+		}
+		last[event.Pool] = event
+	}
+}
+
+func TestSimulator_ObserverNotNotifiedOnFailedBatch(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	pm.Policy = DefaultPolicy{Quarantine: pm.Quarantine, Strict: true}
+	var events []*PoolEvent
+	pm.AddObserver(ObserverFunc(func(event *PoolEvent) {
+		events = append(events, event)
+	}))
+
+	owner := "0x1111111111111111111111111111111111111111"
+	// mint成功, 之后burn不存在的position失败, 整批都不通知
+	err := pm.HandleLogs([]types.Log{
+		testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0),
+		testBurnLog(addr, owner, -60, 60, decimal.NewFromInt(1e17), 101, 1),
+	})
+	assert.Error(t, err)
+	assert.Len(t, events, 0)
+
+	assert.NoError(t, pm.HandleLogs([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 102, 0)}))
+	assert.Len(t, events, 1)
+}
+
+func TestObserver_Sinks(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	var out bytes.Buffer
+	lines := NewJSONLinesObserver(&out)
+	ch := NewChannelObserver(1)
+	pm.AddObserver(lines)
+	pm.AddObserver(ch)
+
+	owner := "0x1111111111111111111111111111111111111111"
+	assert.NoError(t, pm.HandleLogs([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0)}))
+	assert.NoError(t, pm.HandleLogs([]types.Log{testSwapLog(t, pool, owner, true, decimal.NewFromInt(1e16), 101, 1)}))
+	assert.NoError(t, lines.Err())
+
+	// channel只能缓冲一个事件
+	event := <-ch.C
+	assert.Equal(t, "mint", event.Event)
+	assert.Equal(t, uint64(1), ch.Dropped())
+
+	scanner := bufio.NewScanner(&out)
+	var decoded []map[string]interface{}
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		decoded = append(decoded, line)
+	}
+	assert.Len(t, decoded, 2)
+	assert.Equal(t, "swap", decoded[1]["event"])
+	assert.Equal(t, addr.String(), common.HexToAddress(decoded[1]["pool"].(string)).String())
+	assert.NotEqual(t, decoded[1]["before"], decoded[1]["after"])
+}
+
+func TestSimulator_RemoveObserverFunc(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	var first, second int
+	id := pm.AddObserver(ObserverFunc(func(event *PoolEvent) { first++ }))
+	pm.AddObserver(ObserverFunc(func(event *PoolEvent) { second++ }))
+
+	owner := "0x1111111111111111111111111111111111111111"
+	assert.NoError(t, pm.HandleLogs([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0)}))
+	// 不可比较的ObserverFunc也能按id移除, 重复移除忽略
+	pm.RemoveObserver(id)
+	pm.RemoveObserver(id)
+	assert.NoError(t, pm.HandleLogs([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 102, 0)}))
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, second)
+}
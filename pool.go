@@ -9,7 +9,7 @@ import (
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-	"time"
+	"sync/atomic"
 )
 
 type FeeAmount int
@@ -57,6 +57,19 @@ type CorePool struct {
 	FeeGrowthGlobal1X128 decimal.Decimal
 	TickManager          *TickManager
 	PositionManager      *PositionManager
+	version              uint64       // 每次修改状态时更新, 用于检测fork提交冲突
+	journal              *poolJournal // Checkpoint之后的撤销日志, nil时不记录
+}
+
+var poolVersion atomic.Uint64
+
+// 标记pool状态被修改
+func (p *CorePool) touch() {
+	p.version = poolVersion.Add(1)
+}
+
+func (p *CorePool) Version() uint64 {
+	return p.version
 }
 
 func (p *CorePool) Clone() *CorePool {
@@ -79,6 +92,34 @@ func (p *CorePool) Clone() *CorePool {
 		FeeGrowthGlobal1X128: p.FeeGrowthGlobal1X128,
 		TickManager:          p.TickManager.Clone(),
 		PositionManager:      p.PositionManager.Clone(),
+		version:              p.version,
+	}
+	return newPool
+}
+
+// 和Clone得到相同的状态, 但ticks和positions与原pool结构共享, 之后双方都写时复制,
+// 代价只和之后修改的状态成正比
+func (p *CorePool) Fork() *CorePool {
+	newPool := &CorePool{
+		PoolAddress:          p.PoolAddress,
+		HasCreated:           p.HasCreated,
+		Token0:               p.Token0,
+		Token1:               p.Token1,
+		Fee:                  p.Fee,
+		TickSpacing:          p.TickSpacing,
+		MaxLiquidityPerTick:  p.MaxLiquidityPerTick,
+		CurrentBlockNum:      p.CurrentBlockNum,
+		DeployBlockNum:       p.DeployBlockNum,
+		Token0Balance:        p.Token0Balance,
+		Token1Balance:        p.Token1Balance,
+		SqrtPriceX96:         p.SqrtPriceX96,
+		Liquidity:            p.Liquidity,
+		TickCurrent:          p.TickCurrent,
+		FeeGrowthGlobal0X128: p.FeeGrowthGlobal0X128,
+		FeeGrowthGlobal1X128: p.FeeGrowthGlobal1X128,
+		TickManager:          p.TickManager.Fork(),
+		PositionManager:      p.PositionManager.Fork(),
+		version:              p.version,
 	}
 	return newPool
 }
@@ -107,6 +148,7 @@ func (p *CorePool) Initialize(sqrtPriceX96 decimal.Decimal) error {
 	if !p.SqrtPriceX96.IsZero() {
 		return errors.New("Already initialized!")
 	}
+	p.touch()
 	var err error
 	p.TickCurrent, err = GetTickAtSqrtRatio(sqrtPriceX96)
 	if err != nil {
@@ -157,9 +199,34 @@ func (p *CorePool) Collect(recipient string, tickLower, tickUpper int, amount0Re
 	if err != nil {
 		return ZERO, ZERO, err
 	}
+	p.touch()
+	return p.PositionManager.CollectPosition(recipient, tickLower, tickUpper, amount0Req, amount1Req)
+}
+
+// 和链上的collect一样不检查tick, position不存在时取回0
+func (p *CorePool) CollectOwed(recipient string, tickLower, tickUpper int, amount0Req, amount1Req decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	if position := p.PositionManager.GetPositionReadonly(recipient, tickLower, tickUpper); position.IsEmpty() {
+		return ZERO, ZERO, nil
+	}
+	p.touch()
 	return p.PositionManager.CollectPosition(recipient, tickLower, tickUpper, amount0Req, amount1Req)
 }
 
+// flash只通过paid0/paid1影响手续费增长, 与swap一致不计算协议手续费
+func (p *CorePool) Flash(paid0, paid1 decimal.Decimal) error {
+	if !p.Liquidity.IsPositive() {
+		return errors.New("L")
+	}
+	p.touch()
+	if paid0.IsPositive() {
+		p.FeeGrowthGlobal0X128 = p.FeeGrowthGlobal0X128.Add(paid0.Mul(Q128).Div(p.Liquidity).RoundDown(0))
+	}
+	if paid1.IsPositive() {
+		p.FeeGrowthGlobal1X128 = p.FeeGrowthGlobal1X128.Add(paid1.Mul(Q128).Div(p.Liquidity).RoundDown(0))
+	}
+	return nil
+}
+
 type swapState struct {
 	amountSpecifiedRemaining decimal.Decimal
 	amountCalculated         decimal.Decimal
@@ -280,14 +347,18 @@ func (p *CorePool) HandleSwap(zeroForOne bool, amountSpecified decimal.Decimal,
 		}
 		if state.sqrtPriceX96.Equal(step.sqrtPriceNextX96) {
 			if step.initialized {
-				nextTick, err := p.TickManager.GetTickAndInitIfAbsent(step.tickNext)
-				if err != nil {
-					return ZERO, ZERO, ZERO, err
-				}
 				var liquidityNet decimal.Decimal
 				if isStatic {
+					nextTick, err := p.TickManager.GetTickReadonly(step.tickNext)
+					if err != nil {
+						return ZERO, ZERO, ZERO, err
+					}
 					liquidityNet = nextTick.LiquidityNet
 				} else {
+					nextTick, err := p.TickManager.GetTickAndInitIfAbsent(step.tickNext)
+					if err != nil {
+						return ZERO, ZERO, ZERO, err
+					}
 					if zeroForOne {
 						liquidityNet = nextTick.Cross(state.feeGrowthGlobalX128, p.FeeGrowthGlobal1X128)
 					} else {
@@ -316,6 +387,7 @@ func (p *CorePool) HandleSwap(zeroForOne bool, amountSpecified decimal.Decimal,
 		}
 	}
 	if !isStatic {
+		p.touch()
 		p.SqrtPriceX96 = state.sqrtPriceX96
 		if state.tick != p.TickCurrent {
 			p.TickCurrent = state.tick
@@ -353,10 +425,9 @@ func (p *CorePool) tryToDryRun(param *UniV3SwapEvent, amountSpec decimal.Decimal
 		return false
 	}
 	result := amount0.Equal(param.Amount0) && amount1.Equal(param.Amount1) && priceX96.Equal(param.SqrtPriceX96)
-	if param.RawEvent.Address == common.HexToAddress("0xCba27C8e7115b4Eb50Aa14999BC0866674a96eCB") {
-		fmt.Println(amount0, param.Amount0)
-		fmt.Println(amount1, param.Amount1)
-		fmt.Println(sqrtPriceLimitX96, param.SqrtPriceX96)
+	if !result {
+		logrus.Debugf("dry run not match, pool: %s amount0: %s/%s amount1: %s/%s price: %s/%s",
+			p.PoolAddress, amount0, param.Amount0, amount1, param.Amount1, priceX96, param.SqrtPriceX96)
 	}
 	return result
 }
@@ -373,6 +444,12 @@ func incTowardsInfinity(d decimal.Decimal) decimal.Decimal {
 	}
 }
 func (p *CorePool) ResolveInputFromSwapResultEvent(param *UniV3SwapEvent) (decimal.Decimal, *decimal.Decimal, error) {
+	amountSpecified, sqrtPriceLimitX96, _, err := p.resolveSwapSolution(param)
+	return amountSpecified, sqrtPriceLimitX96, err
+}
+
+// 依次尝试可能的输入参数, 同时返回成功的solution在尝试顺序中的序号
+func (p *CorePool) resolveSwapSolution(param *UniV3SwapEvent) (decimal.Decimal, *decimal.Decimal, int, error) {
 
 	solution1 := SwapSolution{SqrtPriceLimitX96: &param.SqrtPriceX96}
 	//logrus.Infof(param.RawEvent.TxHash.String())
@@ -402,15 +479,15 @@ func (p *CorePool) ResolveInputFromSwapResultEvent(param *UniV3SwapEvent) (decim
 		solutionList = append(solutionList, solution1)
 		solutionList = append(solutionList, solution2)
 	}
-	for _, solution := range solutionList {
+	for i, solution := range solutionList {
 		if p.tryToDryRun(param, solution.AmountSpecified, solution.SqrtPriceLimitX96) {
-			return solution.AmountSpecified, solution.SqrtPriceLimitX96, nil
+			return solution.AmountSpecified, solution.SqrtPriceLimitX96, i, nil
 		}
 	}
 
 	err := fmt.Errorf("failed find swap solution %s %s", param.RawEvent.TxHash, param.RawEvent.Address)
 	logrus.Error(err)
-	return ZERO, nil, err
+	return ZERO, nil, -1, err
 }
 
 func (p *CorePool) checkTicks(tickLower, tickUpper int) error {
@@ -440,6 +517,7 @@ func (p *CorePool) modifyPosition(owner string, tickLower, tickUpper int, liquid
 			return nil, ZERO, ZERO, errors.New("Liquidity Underflow")
 		}
 	}
+	p.touch()
 	position, err := p.updatePosition(owner, tickLower, tickUpper, liquidityDelta)
 	if err != nil {
 		return nil, ZERO, ZERO, err
@@ -558,14 +636,3 @@ func (p *CorePool) Flush(db *gorm.DB) error {
 		return db.Create(p).Error
 	}
 }
-
-type ActionType string
-
-type Record struct {
-	Id         string
-	ActionType ActionType
-	Params     interface{}
-	Amount0    decimal.Decimal
-	Amount1    decimal.Decimal
-	Timestamp  time.Time
-}
@@ -81,33 +81,74 @@ func GetPositionKey(owner string, tickLower int, tickUpper int) string {
 	return fmt.Sprintf("%s_%d_%d", owner, tickLower, tickUpper)
 }
 
+// positions按key有序保存在cowMap中, Fork之后与原PositionManager共享未修改的position
 type PositionManager struct {
+	positions *cowMap[string, *Position]
+	journal   *poolJournal
+}
+
+type positionManagerJSON struct {
 	Positions map[string]*Position
 }
 
 func NewPositionManager() *PositionManager {
 	return &PositionManager{
-		Positions: map[string]*Position{},
+		positions: newCowMap[string, *Position]((*Position).Clone),
 	}
 }
 
+// 深拷贝所有position
 func (pm *PositionManager) Clone() *PositionManager {
 	newP := NewPositionManager()
-	ps := make(map[string]*Position, len(pm.Positions))
-	for s, position := range pm.Positions {
-		ps[s] = position.Clone()
-	}
-	newP.Positions = ps
+	pm.positions.Ascend(func(key string, position *Position) bool {
+		newP.positions.Set(key, position.Clone())
+		return true
+	})
 	return newP
 }
+
+// O(1)分叉, 两边之后的修改互不影响
+func (pm *PositionManager) Fork() *PositionManager {
+	return &PositionManager{positions: pm.positions.Fork()}
+}
+
+func (pm *PositionManager) Len() int {
+	return pm.positions.Len()
+}
+
+// 按key升序遍历, 调用方不能修改position
+func (pm *PositionManager) Ascend(fn func(key string, position *Position) bool) {
+	pm.positions.Ascend(fn)
+}
+
+// Deprecated: 原来的Positions字段, 现在返回position拷贝组成的map, 修改不影响pool. 使用Ascend/GetPositionReadonly
+func (pm *PositionManager) Positions() map[string]*Position {
+	result := make(map[string]*Position, pm.positions.Len())
+	pm.positions.Ascend(func(key string, position *Position) bool {
+		result[key] = position.Clone()
+		return true
+	})
+	return result
+}
+
+// 修改前记录到撤销日志
+func (pm *PositionManager) record(key string) {
+	if pm.journal != nil {
+		pm.journal.recordPosition(pm.positions, key)
+	}
+}
+
 func (pm *PositionManager) Set(key string, position *Position) {
-	pm.Positions[key] = position
+	pm.record(key)
+	pm.positions.Set(key, position)
 }
 func (pm *PositionManager) Clear(key string) {
-	delete(pm.Positions, key)
+	pm.record(key)
+	pm.positions.Delete(key)
 }
 func (pm *PositionManager) GetPositionAndInitIfAbsent(key string) *Position {
-	if v, ok := pm.Positions[key]; ok {
+	pm.record(key)
+	if v, ok := pm.positions.GetMut(key); ok {
 		return v
 	}
 	newP := NewPosition()
@@ -116,8 +157,7 @@ func (pm *PositionManager) GetPositionAndInitIfAbsent(key string) *Position {
 }
 func (pm *PositionManager) GetPositionReadonly(owner string, tickLower int, tickUpper int) *Position {
 	key := GetPositionKey(owner, tickLower, tickUpper)
-	if v, ok := pm.Positions[key]; ok {
-		// todo : clone? or not.
+	if v, ok := pm.positions.Get(key); ok {
 		return v.Clone()
 	}
 	return NewPosition()
@@ -127,7 +167,8 @@ func (pm *PositionManager) CollectPosition(owner string, tickLower int, tickUppe
 		return ZERO, ZERO, errors.New("amounts requested should be positive")
 	}
 	key := GetPositionKey(owner, tickLower, tickUpper)
-	if v, ok := pm.Positions[key]; ok {
+	pm.record(key)
+	if v, ok := pm.positions.GetMut(key); ok {
 		positionToCollect := v
 		var amount0 decimal.Decimal
 		if amount0Requested.GreaterThan(positionToCollect.TokensOwed0) {
@@ -169,6 +210,7 @@ func (j *PositionManager) Scan(value interface{}) error {
 			err = json.Unmarshal([]byte(v), j)
 		}
 	case nil:
+		*j = *NewPositionManager()
 		return nil
 	default:
 		err = errors.New(fmt.Sprint("Failed to unmarshal TickManager value:", value))
@@ -176,6 +218,28 @@ func (j *PositionManager) Scan(value interface{}) error {
 	return err
 }
 
+func (pm *PositionManager) MarshalJSON() ([]byte, error) {
+	positions := make(map[string]*Position, pm.positions.Len())
+	pm.positions.Ascend(func(key string, position *Position) bool {
+		positions[key] = position
+		return true
+	})
+	return json.Marshal(positionManagerJSON{Positions: positions})
+}
+
+func (pm *PositionManager) UnmarshalJSON(data []byte) error {
+	var v positionManagerJSON
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	pm.positions = newCowMap[string, *Position]((*Position).Clone)
+	for key, position := range v.Positions {
+		pm.positions.Set(key, position)
+	}
+	return nil
+}
+
 func (j *PositionManager) Value() (driver.Value, error) {
 	bs, err := json.Marshal(j)
 	if err != nil {
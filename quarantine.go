@@ -0,0 +1,327 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const quarantineKindLegacy = "legacy skipped pool"
+
+// 旧版本写死的跳过列表, 建表时写入隔离表
+var legacySkipAddress = []common.Address{
+	common.HexToAddress("0xAE085446Dd8e7545072dFf82429A866b75AD776d"),
+	common.HexToAddress("0xa87998484c19d68807debdc280e18424d55743a9"),
+	common.HexToAddress("0xcba27c8e7115b4eb50aa14999bc0866674a96ecb"),
+	common.HexToAddress("0x979f63b8279376ef8205fb536b16080cd1d45058"),
+}
+
+// 被隔离的pool, 记录第一次出错的事件
+type QuarantinedPool struct {
+	PoolAddress string    `gorm:"primarykey" json:"pool_address"`
+	Kind        string    `json:"kind"`
+	Reason      string    `json:"reason"`
+	TxHash      string    `json:"tx_hash"`
+	LogIndex    uint      `json:"log_index"`
+	BlockNum    uint64    `json:"block_num"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 某个pool的事件出错后隔离该pool, 之后不再处理它的事件, 其它pool继续同步.
+// 被隔离的pool状态停在出错的事件处(可能已部分修改), 不应再用于模拟.
+// db不为nil时隔离列表和pool一起在FlushPools的事务中写入数据库, 重启后仍然有效
+type QuarantinePolicy struct {
+	lock    sync.RWMutex
+	pools   map[common.Address]*QuarantinedPool
+	db      *gorm.DB
+	pending map[common.Address]*QuarantinedPool // 还未提交的隔离
+	cleared map[common.Address]*QuarantinedPool // 已经提交, 还未提交删除的解除隔离
+}
+
+func NewQuarantinePolicy() *QuarantinePolicy {
+	return &QuarantinePolicy{
+		pools:   map[common.Address]*QuarantinedPool{},
+		pending: map[common.Address]*QuarantinedPool{},
+		cleared: map[common.Address]*QuarantinedPool{},
+	}
+}
+
+// 只在内存中的副本, 用于fork上的模拟, 之后的隔离不影响原列表
+func (q *QuarantinePolicy) Copy() *QuarantinePolicy {
+	c := NewQuarantinePolicy()
+	if q == nil {
+		return c
+	}
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	for addr, pool := range q.pools {
+		c.pools[addr] = pool
+	}
+	return c
+}
+
+// 在同步游标的事务中写入未提交的隔离和解除隔离
+func (q *QuarantinePolicy) flush(tx *gorm.DB) error {
+	if q == nil {
+		return nil
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.db == nil || (len(q.pending) == 0 && len(q.cleared) == 0) {
+		return nil
+	}
+	// 先删除, 解除后又被隔离的pool接着写入新的记录
+	for addr := range q.cleared {
+		err := tx.Delete(&QuarantinedPool{}, "pool_address = ?", addr.String()).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(q.pending) > 0 {
+		pools := make([]*QuarantinedPool, 0, len(q.pending))
+		for _, pool := range q.pending {
+			pools = append(pools, pool)
+		}
+		err := tx.Save(pools).Error
+		if err != nil {
+			return err
+		}
+	}
+	q.pending = map[common.Address]*QuarantinedPool{}
+	q.cleared = map[common.Address]*QuarantinedPool{}
+	return nil
+}
+
+// 丢弃未提交的隔离和解除隔离, 它们来自被回滚的事件
+func (q *QuarantinePolicy) discard() {
+	if q == nil {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for addr := range q.pending {
+		delete(q.pools, addr)
+	}
+	for addr, pool := range q.cleared {
+		q.pools[addr] = pool
+	}
+	q.pending = map[common.Address]*QuarantinedPool{}
+	q.cleared = map[common.Address]*QuarantinedPool{}
+}
+
+// 只读加载隔离列表, 还没有建表时为legacySkipAddress
+func readQuarantinePolicy(db *gorm.DB) (*QuarantinePolicy, error) {
+	q := NewQuarantinePolicy()
+	if !db.Migrator().HasTable(&QuarantinedPool{}) {
+		for _, addr := range legacySkipAddress {
+			q.pools[addr] = &QuarantinedPool{PoolAddress: addr.String(), Kind: quarantineKindLegacy, Reason: quarantineKindLegacy}
+		}
+		return q, nil
+	}
+	var pools []*QuarantinedPool
+	err := db.Find(&pools).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		q.pools[common.HexToAddress(pool.PoolAddress)] = pool
+	}
+	return q, nil
+}
+
+// 从数据库加载隔离列表, 首次建表时写入legacySkipAddress
+func loadQuarantinePolicy(db *gorm.DB) (*QuarantinePolicy, error) {
+	seed := !db.Migrator().HasTable(&QuarantinedPool{})
+	err := db.AutoMigrate(&QuarantinedPool{})
+	if err != nil {
+		return nil, err
+	}
+	if seed {
+		legacy := make([]*QuarantinedPool, 0, len(legacySkipAddress))
+		for _, addr := range legacySkipAddress {
+			legacy = append(legacy, &QuarantinedPool{PoolAddress: addr.String(), Kind: quarantineKindLegacy, Reason: quarantineKindLegacy})
+		}
+		err = db.Create(legacy).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	var pools []*QuarantinedPool
+	err = db.Find(&pools).Error
+	if err != nil {
+		return nil, err
+	}
+	q := NewQuarantinePolicy()
+	q.db = db
+	for _, pool := range pools {
+		q.pools[common.HexToAddress(pool.PoolAddress)] = pool
+	}
+	return q, nil
+}
+
+func (q *QuarantinePolicy) Skipped(addr common.Address) bool {
+	return q.Quarantined(addr)
+}
+
+func (q *QuarantinePolicy) Quarantined(addr common.Address) bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	_, ok := q.pools[addr]
+	return ok
+}
+
+func (q *QuarantinePolicy) Get(addr common.Address) (QuarantinedPool, bool) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	pool, ok := q.pools[addr]
+	if !ok {
+		return QuarantinedPool{}, false
+	}
+	return *pool, true
+}
+
+// 隔离err所属的pool, 已经隔离的pool保留第一次的错误
+func (q *QuarantinePolicy) Quarantine(err *EventError) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, ok := q.pools[err.Pool]; ok {
+		return nil
+	}
+	logrus.Errorf("quarantine pool %s: %s", err.Pool, err)
+	pool := &QuarantinedPool{
+		PoolAddress: err.Pool.String(),
+		Kind:        err.Kind.Error(),
+		Reason:      err.Error(),
+		TxHash:      err.TxHash.String(),
+		LogIndex:    err.LogIndex,
+		BlockNum:    err.BlockNum,
+		CreatedAt:   time.Now(),
+	}
+	if q.db != nil {
+		q.pending[err.Pool] = pool
+	}
+	q.pools[err.Pool] = pool
+	return nil
+}
+
+// 解除隔离, 之后的事件继续应用在当前状态上. db不为nil时删除和pool一起在FlushPools的事务中提交
+func (q *QuarantinePolicy) Clear(addr common.Address) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	pool, ok := q.pools[addr]
+	if !ok {
+		return nil
+	}
+	_, pending := q.pending[addr]
+	if q.db != nil && !pending {
+		q.cleared[addr] = pool
+	}
+	delete(q.pools, addr)
+	delete(q.pending, addr)
+	return nil
+}
+
+func (q *QuarantinePolicy) OnUnknownPool(log *types.Log, err *EventError) error {
+	return nil
+}
+
+func (q *QuarantinePolicy) OnParseFailure(log *types.Log, err *EventError) error {
+	return q.Quarantine(err)
+}
+
+func (q *QuarantinePolicy) OnInitializeFailure(log *types.Log, err *EventError) error {
+	// reverted 就是不规范合约， 忽略
+	if strings.Contains(err.Err.Error(), "reverted") {
+		return nil
+	}
+	return q.Quarantine(err)
+}
+
+func (q *QuarantinePolicy) OnUnresolvedSwap(log *types.Log, err *EventError) error {
+	return q.Quarantine(err)
+}
+
+func (q *QuarantinePolicy) OnApplyFailure(log *types.Log, err *EventError) error {
+	return q.Quarantine(err)
+}
+
+// 按pool地址排序的隔离列表
+func (q *QuarantinePolicy) Report() []QuarantinedPool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	report := make([]QuarantinedPool, 0, len(q.pools))
+	for _, pool := range q.pools {
+		report = append(report, *pool)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return bytes.Compare(common.HexToAddress(report[i].PoolAddress).Bytes(), common.HexToAddress(report[j].PoolAddress).Bytes()) < 0
+	})
+	return report
+}
+
+// 当前隔离的pool
+func (pm *Simulator) QuarantinedPools() []QuarantinedPool {
+	return pm.Quarantine.Report()
+}
+
+// 解除隔离但不重建, 只适用于确认pool状态没有被错误事件修改的情况. 和同步游标一起提交
+func (pm *Simulator) ClearQuarantine(addr common.Address) error {
+	pm.syncLock.Lock()
+	defer pm.syncLock.Unlock()
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	err := pm.Quarantine.Clear(addr)
+	if err != nil {
+		return err
+	}
+	return pm.flushPools()
+}
+
+// 解除隔离并从部署区块重放该pool到当前同步高度, 用于修复导致隔离的问题之后.
+// 重放在独立的pool上进行, 不持有lock, 成功后才替换当前pool并解除隔离.
+// 重放中再次出错时保持原来的隔离并返回错误
+func (pm *Simulator) RetryQuarantined(addr common.Address, step uint64) error {
+	pm.syncLock.Lock()
+	defer pm.syncLock.Unlock()
+	entry, ok := pm.Quarantine.Get(addr)
+	if !ok {
+		return fmt.Errorf("pool %s is not quarantined", addr)
+	}
+	pm.lock.RLock()
+	from := entry.BlockNum
+	if pool, exist := pm.Pools[addr]; exist {
+		from = pool.DeployBlockNum
+	}
+	to := pm.currentBlock
+	pm.lock.RUnlock()
+	if from == 0 {
+		// 旧版本写入的跳过列表没有区块
+		from = pm.startBlock
+	}
+	logrus.Infof("retry quarantined pool %s from block %d to %d", addr, from, to)
+	// 重放使用自己的隔离列表, 不跳过该pool, 出错也不影响同步的隔离列表
+	quarantine := NewQuarantinePolicy()
+	replayed, err := pm.replayPool(addr, from, to, step, DefaultPolicy{Quarantine: quarantine})
+	if err != nil {
+		return err
+	}
+	if again, ok := quarantine.Get(addr); ok {
+		return fmt.Errorf("pool %s quarantined again: %s", addr, again.Reason)
+	}
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	err = pm.Quarantine.Clear(addr)
+	if err != nil {
+		return err
+	}
+	pm.installPool(replayed)
+	return pm.flushPools()
+}
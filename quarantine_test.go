@@ -0,0 +1,102 @@
+package uniswap_v3_simulator
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator_QuarantinePersisted(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	pm := newTestSimulator(t, dbFile)
+	assert.Len(t, pm.QuarantinedPools(), len(legacySkipAddress))
+	assert.True(t, pm.Quarantine.Quarantined(legacySkipAddress[0]))
+
+	addr := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	log := &types.Log{Address: addr, BlockNumber: 15, TxHash: common.HexToHash("0x01"), Index: 2}
+	err := DefaultPolicy{Quarantine: pm.Quarantine}.OnUnresolvedSwap(log, newEventError(ErrSwapUnresolved, "swap", log, errors.New("no solution")))
+	assert.NoError(t, err)
+	// 隔离和同步游标一起提交
+	var saved int64
+	assert.NoError(t, pm.db.Model(&QuarantinedPool{}).Where("pool_address = ?", addr.String()).Count(&saved).Error)
+	assert.Equal(t, int64(0), saved)
+	// 解除隔离也在同一个事务中提交
+	assert.NoError(t, pm.ClearQuarantine(legacySkipAddress[0]))
+	assert.NoError(t, pm.db.Model(&QuarantinedPool{}).Where("pool_address = ?", addr.String()).Count(&saved).Error)
+	assert.Equal(t, int64(1), saved)
+
+	reopened := newTestSimulator(t, dbFile)
+	report := reopened.QuarantinedPools()
+	assert.Len(t, report, len(legacySkipAddress))
+	assert.False(t, reopened.Quarantine.Quarantined(legacySkipAddress[0]))
+	entry, ok := reopened.Quarantine.Get(addr)
+	assert.True(t, ok)
+	assert.Equal(t, ErrSwapUnresolved.Error(), entry.Kind)
+	assert.Equal(t, uint64(15), entry.BlockNum)
+	assert.Equal(t, uint(2), entry.LogIndex)
+
+	// rpc不可用, 重放失败后仍然保持隔离
+	assert.Error(t, reopened.RetryQuarantined(addr, 1000))
+	assert.True(t, reopened.Quarantine.Quarantined(addr))
+	assert.Error(t, reopened.RetryQuarantined(common.HexToAddress("0x01"), 1000))
+}
+
+func TestSimulator_QuarantineDiscardedWithBatch(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	pm := newTestSimulator(t, dbFile)
+	addr := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	log := &types.Log{Address: addr, BlockNumber: 15}
+	err := DefaultPolicy{Quarantine: pm.Quarantine}.OnUnresolvedSwap(log, newEventError(ErrSwapUnresolved, "swap", log, errors.New("no solution")))
+	assert.NoError(t, err)
+	assert.True(t, pm.Quarantine.Quarantined(addr))
+
+	// 批次回滚时隔离也被丢弃
+	pm.lock.Lock()
+	assert.NoError(t, pm.reloadCommittedState())
+	pm.lock.Unlock()
+	assert.False(t, pm.Quarantine.Quarantined(addr))
+	assert.NoError(t, pm.FlushPools())
+	assert.False(t, newTestSimulator(t, dbFile).Quarantine.Quarantined(addr))
+}
+
+func TestSimulatorFork_QuarantineInMemory(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	addr := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	log := &types.Log{Address: addr, BlockNumber: 15}
+	fork := NewSimulatorSnapshot(pm)
+	policy := fork.policy()
+	assert.True(t, policy.Skipped(legacySkipAddress[0]))
+	err := policy.OnUnresolvedSwap(log, newEventError(ErrSwapUnresolved, "swap", log, errors.New("no solution")))
+	assert.NoError(t, err)
+	assert.True(t, policy.Skipped(addr))
+	assert.True(t, fork.Fork().policy().Skipped(addr))
+	// 不影响Simulator的隔离列表
+	assert.False(t, pm.Quarantine.Quarantined(addr))
+	assert.NoError(t, pm.FlushPools())
+	var saved int64
+	assert.NoError(t, pm.db.Model(&QuarantinedPool{}).Where("pool_address = ?", addr.String()).Count(&saved).Error)
+	assert.Equal(t, int64(0), saved)
+}
+
+func TestQuarantinePolicy_ClearDiscarded(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	pm := newTestSimulator(t, dbFile)
+	assert.NoError(t, pm.Quarantine.Clear(legacySkipAddress[0]))
+	assert.False(t, pm.Quarantine.Quarantined(legacySkipAddress[0]))
+	var saved int64
+	assert.NoError(t, pm.db.Model(&QuarantinedPool{}).Where("pool_address = ?", legacySkipAddress[0].String()).Count(&saved).Error)
+	assert.Equal(t, int64(1), saved)
+
+	// 未提交的解除隔离随批次回滚
+	pm.lock.Lock()
+	assert.NoError(t, pm.reloadCommittedState())
+	pm.lock.Unlock()
+	assert.True(t, pm.Quarantine.Quarantined(legacySkipAddress[0]))
+	assert.NoError(t, pm.Quarantine.Clear(legacySkipAddress[0]))
+	assert.NoError(t, pm.FlushPools())
+	assert.False(t, newTestSimulator(t, dbFile).Quarantine.Quarantined(legacySkipAddress[0]))
+}
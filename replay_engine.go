@@ -0,0 +1,173 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 一个pool的所有事件, 保持日志顺序
+type logShard struct {
+	address common.Address
+	logs    []types.Log
+}
+
+// 按pool地址分片, 分片按地址排序, 保证合并结果和顺序无关
+func shardLogs(logs []types.Log) []*logShard {
+	index := map[common.Address]*logShard{}
+	var shards []*logShard
+	for _, log := range logs {
+		shard, ok := index[log.Address]
+		if !ok {
+			shard = &logShard{address: log.Address}
+			index[log.Address] = shard
+			shards = append(shards, shard)
+		}
+		shard.logs = append(shard.logs, log)
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return bytes.Compare(shards[i].address.Bytes(), shards[j].address.Bytes()) < 0
+	})
+	return shards
+}
+
+// 分片内的PoolStore, 只读Simulator.Pools, 新建的pool/变更/事件历史先留在分片内, 全部完成后合并
+type shardStore struct {
+	pm      *Simulator
+	created map[common.Address]*CorePool
+	dirty   []*CorePool
+	records []*Record
+	events  []*PoolEvent
+}
+
+func (s *shardStore) Pool(addr common.Address) (*CorePool, bool) {
+	if pool, ok := s.created[addr]; ok {
+		return pool, true
+	}
+	pool, ok := s.pm.Pools[addr]
+	return pool, ok
+}
+
+func (s *shardStore) AddPool(addr common.Address, pool *CorePool) {
+	s.created[addr] = pool
+}
+
+func (s *shardStore) PoolChanged(pool *CorePool, record *Record) {
+	s.dirty = append(s.dirty, pool)
+	if record != nil {
+		s.records = append(s.records, record)
+	}
+}
+
+// 分片并行执行时还不能通知observer, 先保存快照, 合并后按日志顺序通知
+func (s *shardStore) EventApplied(event *PoolEvent) {
+	if s.pm.observing() {
+		snapshotEvent(event)
+		s.events = append(s.events, event)
+	}
+}
+
+type shardResult struct {
+	store *shardStore
+	err   error
+	// 出错的日志位置, 多个分片出错时返回最早的错误, 和顺序执行一致
+	errBlock uint64
+	errIndex uint
+}
+
+// 把一批日志按pool分片, 在workers个goroutine上并行应用, 每个pool内部保持日志顺序.
+// 不同pool之间没有依赖, 结果和HandleLogs顺序执行相同. Policy和CallSource需要支持并发调用.
+// 出错时返回日志位置最早的错误, 此时其它分片可能已经应用了更晚的事件, 调用方应丢弃内存状态
+func (pm *Simulator) ApplyLogsParallel(logs []types.Log, workers int) error {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.applyLogsParallel(logs, workers)
+}
+
+func (pm *Simulator) applyLogsParallel(logs []types.Log, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	shards := shardLogs(logs)
+	results := make([]shardResult, len(shards))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(shards); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = pm.applyShard(shards[i])
+			}
+		}()
+	}
+	for i := range shards {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var first *shardResult
+	for i := range results {
+		result := &results[i]
+		if result.err == nil {
+			continue
+		}
+		if first == nil || result.errBlock < first.errBlock || (result.errBlock == first.errBlock && result.errIndex < first.errIndex) {
+			first = result
+		}
+	}
+	if first != nil {
+		return first.err
+	}
+	var records []*Record
+	var events []*PoolEvent
+	for _, result := range results {
+		for addr, pool := range result.store.created {
+			pm.Pools[addr] = pool
+		}
+		for _, pool := range result.store.dirty {
+			pm.dirtyPools[pool.PoolAddress] = pool
+		}
+		records = append(records, result.store.records...)
+		events = append(events, result.store.events...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].BlockNum != records[j].BlockNum {
+			return records[i].BlockNum < records[j].BlockNum
+		}
+		return records[i].LogIndex < records[j].LogIndex
+	})
+	for _, record := range records {
+		pm.addRecord(record)
+	}
+	sortPoolEvents(events)
+	pm.notify(events)
+	return nil
+}
+
+func (pm *Simulator) applyShard(shard *logShard) shardResult {
+	store := &shardStore{pm: pm, created: map[common.Address]*CorePool{}}
+	applier := NewEventApplier(pm, store, pm.Policy)
+	for i := range shard.logs {
+		log := &shard.logs[i]
+		err := applier.ApplyLog(log)
+		if err != nil {
+			return shardResult{store: store, err: err, errBlock: log.BlockNumber, errIndex: log.Index}
+		}
+	}
+	return shardResult{store: store}
+}
+
+// SyncBlocks中应用一批日志, ReplayWorkers大于1时按pool并行. 调用方持有lock
+func (pm *Simulator) applyLogs(logs []types.Log) error {
+	pm.metrics.logsReceived(len(logs))
+	if pm.ReplayWorkers > 1 {
+		return pm.applyLogsParallel(logs, pm.ReplayWorkers)
+	}
+	return pm.handleLogs(logs)
+}
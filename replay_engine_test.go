@@ -0,0 +1,98 @@
+package uniswap_v3_simulator
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// 多个pool交错的mint/swap日志, 日志由一份独立的pool状态逐条生成
+func testInterleavedLogs(t *testing.T, pools int, events int) (map[common.Address]*CorePool, []types.Log) {
+	initial := map[common.Address]*CorePool{}
+	generators := map[common.Address]*CorePool{}
+	var addresses []common.Address
+	for i := 0; i < pools; i++ {
+		pool := newTestPool(t)
+		addr := common.BigToAddress(new(big.Int).Lsh(big.NewInt(1), uint(100+i)))
+		pool.PoolAddress = addr.String()
+		initial[addr] = pool.Clone()
+		generators[addr] = pool
+		addresses = append(addresses, addr)
+	}
+	r := rand.New(rand.NewSource(1))
+	var logs []types.Log
+	for i := 0; i < events; i++ {
+		addr := addresses[r.Intn(len(addresses))]
+		pool := generators[addr]
+		block := uint64(100 + i/4)
+		index := uint(i % 4)
+		owner := fmt.Sprintf("0x%040x", r.Intn(3)+1)
+		if r.Intn(3) == 0 {
+			lower := (r.Intn(20) - 10) * pool.TickSpacing
+			upper := lower + (r.Intn(5)+1)*pool.TickSpacing
+			amount := decimal.NewFromInt(r.Int63n(1e17) + 1e15)
+			_, _, err := pool.Mint(owner, lower, upper, amount)
+			assert.NoError(t, err)
+			logs = append(logs, testMintLog(addr, owner, lower, upper, amount, block, index))
+		} else {
+			zeroForOne := r.Intn(2) == 0
+			amountIn := decimal.NewFromInt(r.Int63n(1e15) + 1e12)
+			log := testSwapLog(t, pool, owner, zeroForOne, amountIn, block, index)
+			_, _, _, err := pool.HandleSwap(zeroForOne, amountIn, nil, false)
+			assert.NoError(t, err)
+			logs = append(logs, log)
+		}
+	}
+	return initial, logs
+}
+
+func TestSimulator_ApplyLogsParallelDeterministic(t *testing.T) {
+	initial, logs := testInterleavedLogs(t, 8, 400)
+
+	sequential := newTestSimulator(t, "")
+	parallel := newTestSimulator(t, "")
+	for addr, pool := range initial {
+		sequential.Pools[addr] = pool.Clone()
+		parallel.Pools[addr] = pool.Clone()
+	}
+	assert.NoError(t, sequential.HandleLogs(logs))
+	assert.NoError(t, parallel.ApplyLogsParallel(logs, 4))
+
+	for addr, pool := range sequential.Pools {
+		diff := DiffPools(pool, parallel.Pools[addr])
+		assert.True(t, diff.Empty(), "pool %s differs", addr)
+	}
+	assert.Equal(t, len(sequential.dirtyPools), len(parallel.dirtyPools))
+	assert.Equal(t, len(sequential.pendingRecords), len(parallel.pendingRecords))
+	for i := range sequential.pendingRecords {
+		assert.Equal(t, sequential.pendingRecords[i].Id, parallel.pendingRecords[i].Id)
+		assert.Equal(t, sequential.pendingRecords[i].Amount0, parallel.pendingRecords[i].Amount0)
+	}
+}
+
+func TestSimulator_ApplyLogsParallelFirstError(t *testing.T) {
+	initial, logs := testInterleavedLogs(t, 2, 20)
+	pm := newTestSimulator(t, "")
+	var addresses []common.Address
+	for addr, pool := range initial {
+		pm.Pools[addr] = pool.Clone()
+		addresses = append(addresses, addr)
+	}
+	owner := "0x1111111111111111111111111111111111111111"
+	// 两个pool都有失败的burn, 返回日志位置更早的那个
+	logs = append(logs,
+		testBurnLog(addresses[0], owner, -60, 60, decimal.NewFromInt(1e17), 200, 1),
+		testBurnLog(addresses[1], owner, -60, 60, decimal.NewFromInt(1e17), 200, 0),
+	)
+	pm.Policy = DefaultPolicy{Quarantine: pm.Quarantine, Strict: true}
+	err := pm.ApplyLogsParallel(logs, 2)
+	var eventErr *EventError
+	assert.ErrorAs(t, err, &eventErr)
+	assert.Equal(t, addresses[1], eventErr.Pool)
+}
@@ -0,0 +1,189 @@
+package uniswap_v3_simulator
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+// 搜索的相对精度, 区间缩小到最大前置数量的1e-9时停止
+var sandwichSearchPrecision = decimal.New(1, -9)
+
+// 待打包的exact input swap
+type PendingSwap struct {
+	Pool         common.Address  `json:"pool"`
+	ZeroForOne   bool            `json:"zero_for_one"`
+	AmountIn     decimal.Decimal `json:"amount_in"`
+	MinAmountOut decimal.Decimal `json:"min_amount_out"`
+}
+
+// 数量都为正数. 前置和受害者输入同一种token, 后置卖出前置得到的全部token, 利润以输入token计
+type SandwichOpportunity struct {
+	FrontRunAmountIn     decimal.Decimal `json:"front_run_amount_in"`
+	FrontRunAmountOut    decimal.Decimal `json:"front_run_amount_out"`
+	BackRunAmountOut     decimal.Decimal `json:"back_run_amount_out"`
+	VictimAmountOut      decimal.Decimal `json:"victim_amount_out"`
+	VictimAmountOutAlone decimal.Decimal `json:"victim_amount_out_alone"` // 没有前置时受害者得到的数量
+	Profit               decimal.Decimal `json:"profit"`                  // 不含gas, 没有盈利的机会时为0
+	Evaluations          int             `json:"evaluations"`
+}
+
+type sandwichSearch struct {
+	pool        *CorePool
+	checkpoint  Checkpoint
+	swap        PendingSwap
+	evaluations int
+}
+
+// 在pool上依次执行前置/受害者/后置, 再撤销. 受害者得不到MinAmountOut时返回false
+func (s *sandwichSearch) eval(frontRun decimal.Decimal) (*SandwichOpportunity, bool, error) {
+	s.evaluations++
+	defer s.pool.RevertTo(s.checkpoint)
+	result := &SandwichOpportunity{FrontRunAmountIn: ZERO, FrontRunAmountOut: ZERO, BackRunAmountOut: ZERO, Profit: ZERO}
+	zeroForOne := s.swap.ZeroForOne
+	if frontRun.IsPositive() {
+		amountIn, amountOut, err := swapAmounts(s.pool, zeroForOne, frontRun, false)
+		if err != nil {
+			return nil, false, err
+		}
+		result.FrontRunAmountIn, result.FrontRunAmountOut = amountIn, amountOut
+	}
+	_, victimOut, err := swapAmounts(s.pool, zeroForOne, s.swap.AmountIn, false)
+	if err != nil {
+		return nil, false, err
+	}
+	result.VictimAmountOut = victimOut
+	if victimOut.LessThan(s.swap.MinAmountOut) {
+		return result, false, nil
+	}
+	if result.FrontRunAmountOut.IsPositive() {
+		// 最后一笔不需要修改状态
+		_, backOut, err := swapAmounts(s.pool, !zeroForOne, result.FrontRunAmountOut, true)
+		if err != nil {
+			return nil, false, err
+		}
+		result.BackRunAmountOut = backOut
+		result.Profit = backOut.Sub(result.FrontRunAmountIn)
+	}
+	return result, true, nil
+}
+
+// exact input swap实际的输入和输出数量
+func swapAmounts(pool *CorePool, zeroForOne bool, amountIn decimal.Decimal, isStatic bool) (decimal.Decimal, decimal.Decimal, error) {
+	amount0, amount1, _, err := pool.HandleSwap(zeroForOne, amountIn, nil, isStatic)
+	if err != nil {
+		return ZERO, ZERO, err
+	}
+	if zeroForOne {
+		return amount0, amount1.Neg(), nil
+	}
+	return amount1, amount0.Neg(), nil
+}
+
+// 对待打包的swap搜索利润最大的前置数量, 受害者的输出不能低于MinAmountOut.
+// 先倍增找到受害者仍能成交的区间, 二分得到最大的前置数量, 再在区间内三分搜索利润.
+// 在fork中pool的分叉上用撤销日志反复执行, 不修改fork
+func (s *SimulatorFork) SearchSandwich(swap PendingSwap) (*SandwichOpportunity, error) {
+	if !swap.AmountIn.IsPositive() || swap.MinAmountOut.IsNegative() {
+		return nil, fmt.Errorf("%w: amount_in must be positive and min_amount_out not negative", ErrInvalidRequest)
+	}
+	pool, err := s.GetPool(swap.Pool)
+	if err != nil {
+		return nil, err
+	}
+	search := &sandwichSearch{pool: pool.Fork(), swap: swap}
+	search.checkpoint = search.pool.Checkpoint()
+
+	best, ok, err := search.eval(ZERO)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	alone := best.VictimAmountOut
+	if !ok {
+		return nil, fmt.Errorf("%w: swap gets %s below min_amount_out without front run", ErrInvalidRequest, alone)
+	}
+
+	// 倍增直到受害者无法成交或利润下降
+	lo, hi := ZERO, swap.AmountIn
+	feasible := true
+	for hi.LessThan(MaxUint128) {
+		result, ok, err := search.eval(hi)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			feasible = false
+			break
+		}
+		if result.Profit.LessThan(best.Profit) {
+			break
+		}
+		best = result
+		lo, hi = hi, hi.Mul(decimal.NewFromInt(2))
+	}
+	hi = decimal.Min(hi, MaxUint128)
+	precision := decimal.Max(ONE, hi.Mul(sandwichSearchPrecision).RoundDown(0))
+	if !feasible {
+		// 二分受害者刚好能成交的最大前置数量
+		for hi.Sub(lo).GreaterThan(precision) {
+			mid := lo.Add(hi).Div(decimal.NewFromInt(2)).RoundDown(0)
+			_, ok, err := search.eval(mid)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		hi = lo
+		lo = ZERO
+	} else {
+		lo = ZERO
+	}
+
+	// 三分搜索[lo, hi]中利润的最大值, 区间小于3时三分点不再移动
+	for hi.Sub(lo).GreaterThan(decimal.Max(precision, decimal.NewFromInt(2))) {
+		third := hi.Sub(lo).Div(decimal.NewFromInt(3)).RoundDown(0)
+		m1, m2 := lo.Add(third), hi.Sub(third)
+		r1, ok1, err := search.eval(m1)
+		if err != nil {
+			return nil, err
+		}
+		r2, ok2, err := search.eval(m2)
+		if err != nil {
+			return nil, err
+		}
+		if ok1 && r1.Profit.GreaterThan(best.Profit) {
+			best = r1
+		}
+		if ok2 && r2.Profit.GreaterThan(best.Profit) {
+			best = r2
+		}
+		if !ok2 || r1.Profit.GreaterThan(r2.Profit) {
+			hi = m2
+		} else {
+			lo = m1
+		}
+	}
+	for _, candidate := range []decimal.Decimal{lo, hi} {
+		result, ok, err := search.eval(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if ok && result.Profit.GreaterThan(best.Profit) {
+			best = result
+		}
+	}
+	if !best.Profit.IsPositive() {
+		best, _, err = search.eval(ZERO)
+		if err != nil {
+			return nil, err
+		}
+	}
+	best.VictimAmountOutAlone = alone
+	best.Evaluations = search.evaluations
+	return best, nil
+}
@@ -0,0 +1,59 @@
+package uniswap_v3_simulator
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFork_SearchSandwich(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestMEVPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+	fork := NewSimulatorSnapshot(pm)
+
+	amountIn := decimal.NewFromInt(1e18)
+	_, alone, err := swapAmounts(pool.Clone(), false, amountIn, false)
+	assert.NoError(t, err)
+	// 1%滑点
+	minOut := alone.Mul(decimal.NewFromFloat(0.99)).RoundDown(0)
+	swap := PendingSwap{Pool: addr, ZeroForOne: false, AmountIn: amountIn, MinAmountOut: minOut}
+	result, err := fork.SearchSandwich(swap)
+	assert.NoError(t, err)
+	assert.True(t, result.Profit.IsPositive())
+	assert.True(t, result.VictimAmountOutAlone.Equal(alone))
+	assert.True(t, result.VictimAmountOut.GreaterThanOrEqual(minOut))
+	// 利润随前置数量增加, 最优解在滑点限制处
+	assert.True(t, result.VictimAmountOut.Sub(minOut).LessThan(minOut.Mul(decimal.New(1, -6))))
+	assert.True(t, result.Profit.Equal(result.BackRunAmountOut.Sub(result.FrontRunAmountIn)))
+
+	// 更小的前置利润更低
+	search := &sandwichSearch{pool: pool.Fork(), swap: swap}
+	search.checkpoint = search.pool.Checkpoint()
+	smaller, ok, err := search.eval(result.FrontRunAmountIn.Mul(decimal.NewFromFloat(0.9)).RoundDown(0))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, smaller.Profit.LessThan(result.Profit))
+	_, ok, err = search.eval(result.FrontRunAmountIn.Mul(decimal.NewFromFloat(1.1)).RoundDown(0))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 搜索不修改fork
+	forked, err := fork.GetPool(addr)
+	assert.NoError(t, err)
+	assert.True(t, DiffPools(pool, forked).Empty())
+
+	// 没有滑点空间时没有机会
+	swap.MinAmountOut = alone
+	result, err = fork.SearchSandwich(swap)
+	assert.NoError(t, err)
+	assert.True(t, result.Profit.IsZero())
+	assert.True(t, result.FrontRunAmountIn.IsZero())
+
+	swap.MinAmountOut = alone.Add(ONE)
+	_, err = fork.SearchSandwich(swap)
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
@@ -1,9 +1,9 @@
 package uniswap_v3_simulator
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -14,8 +14,8 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"log"
-	"math/big"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -27,33 +27,106 @@ var (
 	TOPIC_BURN       = common.HexToHash("0x0c396cd989a39f4459b5fa1aed6a9a8dcdbc45908acfd67e028cd568da98982c")
 	TOPIC_SWAP       = common.HexToHash("0xc42079f94a6350d7e6235f29174924f928cc2ac818eb64fed8004e115fbcca67")
 	TOPIC_MINT       = common.HexToHash("0x7a53080ba414158be7ec69b987b5fb7d07dee101fe85488f0853ae16239d0bde")
-)
-
-var (
-	skipAddress = []common.Address{common.HexToAddress("0xAE085446Dd8e7545072dFf82429A866b75AD776d"), common.HexToAddress("0xa87998484c19d68807debdc280e18424d55743a9"), common.HexToAddress("0xcba27c8e7115b4eb50aa14999bc0866674a96ecb"), common.HexToAddress("0x979f63b8279376ef8205fb536b16080cd1d45058")}
+	TOPIC_COLLECT    = common.HexToHash("0x70935338e69775456a85ddef226c395fb668b63fa0115f5f20610b388e6ca9c0")
+	TOPIC_FLASH      = common.HexToHash("0xbdbdb71d7860376ba52b25a5028beea23581364a40522f6bcfb86bb1f2dca633")
 )
 
 type Simulator struct {
-	lock         sync.Mutex
-	startBlock   uint64 // 起始区块
-	currentBlock uint64 // 当前同步到
-	Pools        map[common.Address]*CorePool
-	dirtyPools   map[string]*CorePool
-	Abi          abi.ABI
-	InitializeID common.Hash
-	MintID       common.Hash
-	BurnID       common.Hash
-	SwapID       common.Hash
-	rpc          *ethclient.Client
-	db           *gorm.DB
-	dbfile       string
-	ctx          context.Context
+	lock             sync.RWMutex // 保护Pools/dirtyPools/pendingRecords/currentBlock/checkpoints
+	syncLock         sync.Mutex   // 同一时间只有一个同步任务(SyncBlocks/Run/Recover/RetryQuarantined)
+	startBlock       uint64       // 起始区块
+	currentBlock     uint64       // 当前同步到
+	Pools            map[common.Address]*CorePool
+	dirtyPools       map[string]*CorePool
+	pendingRecords   []*Record            // 未落地的事件历史
+	blockTimes       map[uint64]time.Time // RecordBlockTime开启时同步中预取的区块时间
+	RecordBlockTime  bool                 // 写入事件历史时查询区块时间, 每个区块一次rpc调用
+	Policy           ApplyPolicy          // 异常事件的处理策略, NewPoolManager默认隔离出错的pool, nil时使用DefaultPolicy
+	Quarantine       *QuarantinePolicy    // 持久化的隔离列表, DefaultPolicy跳过其中的pool
+	SwapResolveMode  SwapResolveMode      // swap输入参数的解析方式
+	CallSource       CallSource           // SwapResolveCalldata模式下获取交易调用数据
+	ReplayWorkers    int                  // 大于1时SyncBlocks按pool并行应用事件
+	FetchConcurrency int                  // SyncBlocks同时预取的区块范围数量, 0时使用默认值
+	FlushInterval    time.Duration        // Run模式下定时flush的间隔, 0时使用默认值
+	PollInterval     time.Duration        // Run模式下不支持订阅时轮询新区块的间隔, 0时使用默认值
+	Confirmations    uint64               // Run模式下只落地距离最新区块超过这个数量的区块, 更近的区块reorg时在内存中回滚
+	confirmedBlock   uint64               // Run模式下已确认的区块, flush不超过它, 0表示不限制
+	checkpoints      []*blockCheckpoint
+	observers        []registeredObserver
+	nextObserverID   ObserverID
+	metrics          *Metrics
+	Abi              abi.ABI
+	InitializeID     common.Hash
+	MintID           common.Hash
+	BurnID           common.Hash
+	SwapID           common.Hash
+	CollectID        common.Hash
+	FlashID          common.Hash
+	rpc              *ethclient.Client
+	db               *gorm.DB
+	dbfile           string
+	ctx              context.Context
 }
 
 func NewPoolManager(dbFile string, rpcUrl string, startBlock uint64) *Simulator {
-	db, err := gorm.Open(sqlite.Open(dbFile), &gorm.Config{
+	db, err := openDB(dbFile)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	pm := newSimulator(db, dbFile, rpcUrl, startBlock)
+
+	err = db.AutoMigrate(&CorePool{}, &SyncCursor{}, &Record{}, &Sandwich{}, &SandwichVictim{}, &JITLiquidity{})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	pm.Quarantine, err = loadQuarantinePolicy(db)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	// 默认隔离出错的pool, 其它pool继续同步
+	pm.Policy = DefaultPolicy{Quarantine: pm.Quarantine}
+	pm.Pools, err = loadPools(db)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	pm.currentBlock, err = migrateSyncCursor(db)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return pm
+}
+
+// 以只读方式打开已有的数据库, 不建表也不迁移同步游标, 用于查询. 不能用来同步
+func OpenReadOnly(dbFile string, rpcUrl string) (*Simulator, error) {
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, err
+	}
+	db, err := openDB("file:" + dbFile + "?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	pm := newSimulator(db, dbFile, rpcUrl, 0)
+	pm.Quarantine, err = readQuarantinePolicy(db)
+	if err != nil {
+		return nil, err
+	}
+	pm.Policy = DefaultPolicy{Quarantine: pm.Quarantine}
+	pm.Pools, err = loadPools(db)
+	if err != nil {
+		return nil, err
+	}
+	pm.currentBlock, err = readSyncCursor(db)
+	if err != nil {
+		return nil, err
+	}
+	return pm, nil
+}
+
+func openDB(dsn string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(dsn), &gorm.Config{
 		Logger: logger.New(
-			log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
+			log.New(os.Stderr, "\r\n", log.LstdFlags), // 和logrus一样输出到stderr, 命令行的stdout只有json
 			logger.Config{
 				SlowThreshold:             100 * time.Second, // Slow SQL threshold
 				LogLevel:                  logger.Error,      // Log level
@@ -62,18 +135,23 @@ func NewPoolManager(dbFile string, rpcUrl string, startBlock uint64) *Simulator
 			},
 		),
 	})
+}
+
+func newSimulator(db *gorm.DB, dbFile string, rpcUrl string, startBlock uint64) *Simulator {
 	rpc, err := ethclient.Dial(rpcUrl)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 	pm := &Simulator{
-		startBlock: startBlock,
-		Pools:      map[common.Address]*CorePool{},
-		dirtyPools: map[string]*CorePool{},
-		rpc:        rpc,
-		db:         db,
-		dbfile:     dbFile,
-		ctx:        context.Background(),
+		startBlock:    startBlock,
+		Pools:         map[common.Address]*CorePool{},
+		dirtyPools:    map[string]*CorePool{},
+		Confirmations: defaultConfirmations,
+		rpc:           rpc,
+		db:            db,
+		dbfile:        dbFile,
+		ctx:           context.Background(),
+		metrics:       NewMetrics(),
 	}
 	a, err := abi.JSON(strings.NewReader(ABI))
 	if err != nil {
@@ -84,27 +162,45 @@ func NewPoolManager(dbFile string, rpcUrl string, startBlock uint64) *Simulator
 	pm.MintID = a.Events["Mint"].ID
 	pm.BurnID = a.Events["Burn"].ID
 	pm.SwapID = a.Events["Swap"].ID
+	pm.CollectID = a.Events["Collect"].ID
+	pm.FlashID = a.Events["Flash"].ID
+	return pm
+}
 
-	err = db.AutoMigrate(&CorePool{})
-	if err != nil {
-		logrus.Fatal(err)
-	}
-
+func loadPools(db *gorm.DB) (map[common.Address]*CorePool, error) {
 	var currentPool []*CorePool
-	err = db.Find(&currentPool).Error
+	err := db.Find(&currentPool).Error
 	if err != nil {
-		logrus.Fatal(err)
+		return nil, err
 	}
+	pools := map[common.Address]*CorePool{}
 	for _, pool := range currentPool {
-		pm.Pools[common.HexToAddress(pool.PoolAddress)] = pool
+		pools[common.HexToAddress(pool.PoolAddress)] = pool
 	}
-	return pm
+	return pools, nil
 }
 
 func (pm *Simulator) CurrentBlock() uint64 {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
 	return pm.currentBlock
 }
 
+// 节点的最新区块
+func (pm *Simulator) HeadBlock(ctx context.Context) (uint64, error) {
+	latest, err := pm.rpc.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pm.metrics.observeHead(latest)
+	return latest, nil
+}
+
+// 同步时订阅的事件
+func (pm *Simulator) eventTopics() [][]common.Hash {
+	return [][]common.Hash{{pm.InitializeID, pm.MintID, pm.BurnID, pm.SwapID, pm.CollectID, pm.FlashID}}
+}
+
 func (pm *Simulator) NewPool(log *types.Log) (*CorePool, error) {
 	initialze, err := parseUniv3InitializeEvent(log)
 	if err != nil {
@@ -148,156 +244,122 @@ func (pm *Simulator) NewPool(log *types.Log) (*CorePool, error) {
 }
 
 func (pm *Simulator) HandleLogs(logs []types.Log) error {
-	// 有变更的pool
-	for _, log := range logs {
-		skip := false
-		for _, address := range skipAddress {
-			if log.Address == address {
-				skip = true
-			}
-		}
-
-		if skip {
-			continue
-		}
-
-		if len(log.Topics) == 0 {
-			return nil
-		}
-		topic0 := log.Topics[0]
-		if topic0 == pm.InitializeID {
-			if _, exist := pm.Pools[log.Address]; exist {
-				return fmt.Errorf("pool exists %s", log.Address)
-			}
-			pool, err := pm.NewPool(&log)
-			if err != nil {
-				logrus.Warnf("failed initialize pool: %s", err)
-				// reverted 就是不规范合约， 忽略
-				if strings.Contains(err.Error(), "reverted") {
-					continue
-				} else {
-					logrus.Fatal(err)
-				}
-			}
-			pool.DeployBlockNum = log.BlockNumber
-			pool.CurrentBlockNum = log.BlockNumber
-			pm.dirtyPools[pool.PoolAddress] = pool
-			pm.Pools[log.Address] = pool
-		} else if topic0 == pm.MintID {
-			if pool, ok := pm.Pools[log.Address]; !ok {
-				//logrus.Warnf("mint before initialize, tx: %s, pool: %s", log.TxHash, log.Address)
-				continue
-			} else {
-				mint, err := parseUniv3MintEvent(&log)
-				if err != nil {
-					logrus.Warnf("failed parse mint event, tx: %s  pool: %s", log.TxHash, log.Address)
-					continue
-				}
-				//s, _ := json.Marshal(mint)
-				//logrus.Infof("mint: %s %s %s", log.Address, log.TxHash, string(s))
-				_, _, err = pool.Mint(mint.Owner, mint.TickLower, mint.TickUpper, mint.Amount)
-				if err != nil {
-					logrus.Errorf("failed execute mint event, %s tx: %s  pool: %s", err, log.TxHash, log.Address)
-					return err
-				}
-				pool.CurrentBlockNum = log.BlockNumber
-				pm.dirtyPools[pool.PoolAddress] = pool
-			}
-		} else if topic0 == pm.BurnID {
-			if pool, ok := pm.Pools[log.Address]; !ok {
-				//logrus.Warnf("burn before initialize, tx: %s, pool: %s", log.TxHash, log.Address)
-				continue
-			} else {
-				burn, err := parseUniv3BurnEvent(&log)
-				if err != nil {
-					logrus.Warnf("failed parse burn event, tx: %s  pool: %s err: %s", log.TxHash, log.Address, err)
-					continue
-				}
-				//s, _ := json.Marshal(burn)
-				//logrus.Infof("burn: %s %s %s", log.Address, log.TxHash, string(s))
-				_, _, err = pool.Burn(burn.Owner, burn.TickLower, burn.TickUpper, burn.Amount)
-				if err != nil {
-					logrus.Errorf("failed execute burn event, %s tx: %s  pool: %s", err, log.TxHash, log.Address)
-					return err
-				}
-				pool.CurrentBlockNum = log.BlockNumber
-				pm.dirtyPools[pool.PoolAddress] = pool
-			}
-		} else if topic0 == pm.SwapID {
-			if pool, ok := pm.Pools[log.Address]; !ok {
-				//logrus.Warnf("swap before initialize, tx: %s, pool: %s", log.TxHash, log.Address)
-				continue
-			} else {
-				swap, err := parseUniv3SwapEvent(&log)
-				if err != nil {
-					logrus.Warnf("failed parse swap event, tx: %s  pool: %s", log.TxHash, log.Address)
-					continue
-				}
-				//s, _ := json.Marshal(swap)
-				//logrus.Infof("swap: %s %s %s", log.Address, log.TxHash, string(s))
-				amountSpecified, sqrtPriceX96, err := pool.ResolveInputFromSwapResultEvent(swap)
-				if err != nil {
-					skipAddress = append(skipAddress, log.Address)
-					logrus.Errorf("failed resolve swap param from event, tx: %s  pool: %s, %s", log.TxHash, log.Address, err)
-					logrus.Infof("new skipped pool: %s, current skipped pools: %s", log.Address, skipAddress)
-					continue
-				}
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.handleLogs(logs)
+}
 
-				_, _, _, err = pool.HandleSwap(swap.Amount0.IsPositive(), amountSpecified, sqrtPriceX96, false)
-				if err != nil {
-					logrus.Fatalf("failed execute swap event, %s tx: %s  pool: %s", err, log.TxHash, log.Address)
-				}
-				pool.CurrentBlockNum = log.BlockNumber
-				pm.dirtyPools[pool.PoolAddress] = pool
-			}
-		}
+func (pm *Simulator) handleLogs(logs []types.Log) error {
+	store := &simulatorStore{pm: pm}
+	err := NewEventApplier(pm, store, pm.Policy).Apply(logs)
+	if err != nil {
+		return err
 	}
+	pm.notify(store.events)
 	return nil
 }
 
+// 已处理到的区块, 包含内存中尚未flush的部分
 func (pm *Simulator) MaxSyncedBlockNum() (uint64, error) {
-	var lastBlock *uint64
-	err := pm.db.Model(&CorePool{}).Select("max(current_block_num) as last_block").Scan(&lastBlock).Error
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return pm.maxSyncedBlockNum()
+}
+
+func (pm *Simulator) maxSyncedBlockNum() (uint64, error) {
+	committed, err := pm.CommittedBlockNum()
 	if err != nil {
 		return 0, err
 	}
-	if lastBlock == nil {
-		return 0, nil
-	}
-	if *lastBlock > pm.currentBlock {
-		return *lastBlock, nil
+	if committed > pm.currentBlock {
+		return committed, nil
 	} else {
 		return pm.currentBlock, nil
 	}
 }
 
 func (pm *Simulator) FlushPools() error {
-	// pool变更落地
-	err := pm.db.Transaction(func(tx *gorm.DB) error {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.flushPools()
+}
+
+// 没有未确认的区块时落地内存中的全部变更. Run模式下只落地到已确认的区块,
+// 之后的区块中变更过的pool写入区块之前的状态, 并且保持dirty
+func (pm *Simulator) flushPools() error {
+	start := time.Now()
+	block := pm.currentBlock
+	if pm.confirmedBlock > 0 && pm.confirmedBlock < block {
+		block = pm.confirmedBlock
+	}
+	pm.pruneCheckpoints(block)
+	unconfirmed := pm.unconfirmedStates()
+	var records, pendingRecords []*Record
+	for _, record := range pm.pendingRecords {
+		if pm.confirmedBlock == 0 || record.BlockNum <= block {
+			records = append(records, record)
+		} else {
+			pendingRecords = append(pendingRecords, record)
+		}
+	}
+	err := pm.fillRecordTimestamps(records)
+	if err != nil {
+		logrus.Errorf("failed get record timestamps %s", err)
+		return err
+	}
+	// pool变更和同步游标在同一事务落地
+	err = pm.db.Transaction(func(tx *gorm.DB) error {
 		for _, pool := range pm.dirtyPools {
-			err := pool.Flush(tx)
+			err := flushPoolAt(tx, pool, unconfirmed)
 			if err != nil {
 				logrus.Errorf("failed flush pool %s", err)
 				return err
 			}
 			logrus.Infof("flush pool: %s", pool.PoolAddress)
 		}
-		return nil
+		err := pm.flushRecords(tx, records)
+		if err != nil {
+			logrus.Errorf("failed flush records %s", err)
+			return err
+		}
+		err = pm.Quarantine.flush(tx)
+		if err != nil {
+			logrus.Errorf("failed flush quarantined pools %s", err)
+			return err
+		}
+		return saveSyncCursor(tx, block)
 	})
+	pm.metrics.flushed(time.Since(start), err)
 	if err != nil {
 		logrus.Warnf("failed save snapshot %s", err)
 		return err
 	} else {
-		pm.dirtyPools = map[string]*CorePool{}
+		dirtyPools := map[string]*CorePool{}
+		for key, pool := range pm.dirtyPools {
+			if _, ok := unconfirmed[common.HexToAddress(pool.PoolAddress)]; ok {
+				dirtyPools[key] = pool
+			}
+		}
+		pm.dirtyPools = dirtyPools
+		pm.pendingRecords = pendingRecords
+		for _, record := range records {
+			delete(pm.blockTimes, record.BlockNum)
+		}
 		return nil
 	}
 }
 
 // end is inclusive
 func (pm *Simulator) SyncBlocks(to uint64, step uint64) (uint64, error) {
+	pm.syncLock.Lock()
+	defer pm.syncLock.Unlock()
+	return pm.syncBlocks(pm.ctx, to, step)
+}
+
+// 调用方持有syncLock. 获取日志时不持有lock, 只在应用每一批日志和flush时持有,
+// 同步期间其它goroutine可以在批次之间fork和读取一致的状态
+func (pm *Simulator) syncBlocks(ctx context.Context, to uint64, step uint64) (uint64, error) {
 	// 从数据库获取start, max(currentBlock)
-	pm.lock.Lock()
-	defer pm.lock.Unlock()
 	lastBlock, err := pm.MaxSyncedBlockNum()
 	if err != nil {
 		return 0, err
@@ -309,7 +371,7 @@ func (pm *Simulator) SyncBlocks(to uint64, step uint64) (uint64, error) {
 	start := lastBlock + 1
 	var end uint64
 	if to == 0 {
-		latest, err := pm.rpc.BlockNumber(pm.ctx)
+		latest, err := pm.HeadBlock(ctx)
 		if err != nil {
 			return 0, err
 		}
@@ -318,53 +380,61 @@ func (pm *Simulator) SyncBlocks(to uint64, step uint64) (uint64, error) {
 		end = to
 	}
 
+	if start > end {
+		return end, nil
+	}
 	// 每step个区块持久化一次
 	flushStep := 0
-
-	for {
-		if start > end {
-			return end, nil
-		}
-		flushStep += 1
-		var minEnd uint64
-		if start+step > end {
-			minEnd = end
-		} else {
-			minEnd = start + step
-		}
-		logrus.Infof("sync blocks: %d - %d", start, minEnd)
-		logs, err := pm.rpc.FilterLogs(pm.ctx, ethereum.FilterQuery{
-			FromBlock: big.NewInt(int64(start)),
-			ToBlock:   big.NewInt(int64(minEnd)),
-			Topics:    [][]common.Hash{{pm.InitializeID, pm.MintID, pm.BurnID, pm.SwapID}},
-			//Addresses: []common.Address{common.HexToAddress("0xCba27C8e7115b4Eb50Aa14999BC0866674a96eCB")},
-		})
+	err = pm.newLogFetcher(step).Run(ctx, start, end, func(batch LogBatch) error {
+		times, err := pm.fetchBlockTimes(ctx, batch.Logs)
 		if err != nil {
-			return 0, err
+			return err
 		}
-		err = pm.HandleLogs(logs)
+		pm.lock.Lock()
+		defer pm.lock.Unlock()
+		pm.addBlockTimes(times)
+		// 指定了to时不查询最新区块, 已经取到日志的区块一定在链上
+		pm.metrics.observeHead(batch.To)
+		flushStep += 1
+		logrus.Infof("sync blocks: %d - %d", batch.From, batch.To)
+		err = pm.applyLogs(batch.Logs)
 		if err != nil {
-			return 0, err
+			// 这一批事件只应用了一部分, 丢弃内存状态, 保证之后flush的数据库仍停在同一高度
+			if reloadErr := pm.reloadCommittedState(); reloadErr != nil {
+				logrus.Errorf("failed reload committed state %s", reloadErr)
+			}
+			return err
 		}
+		pm.currentBlock = batch.To
 		// 每10w block flush一次
 		if flushStep%10 == 0 {
-			err = pm.FlushPools()
+			err = pm.flushPools()
 			if err != nil {
-				return 0, err
+				return err
 			}
 			bytesRead, err := os.ReadFile(pm.dbfile)
 			if err != nil {
 				logrus.Errorf("failed read db file %s", err)
 			}
-			err = os.WriteFile(fmt.Sprintf("%s.snapshot-%d", pm.dbfile, minEnd), bytesRead, 0755)
+			err = os.WriteFile(dbSnapshotPath(pm.dbfile, batch.To), bytesRead, 0755)
 			if err != nil {
 				logrus.Errorf("failed write snapshot file %s", err)
 			}
 		}
-		start = minEnd + 1
-		pm.currentBlock = minEnd
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return end, nil
+}
 
+func (pm *Simulator) newLogFetcher(step uint64) *LogFetcher {
+	fetcher := NewLogFetcher(pm.rpc, pm.eventTopics(), step)
+	if pm.FetchConcurrency > 0 {
+		fetcher.Concurrency = pm.FetchConcurrency
+	}
+	return fetcher
 }
 
 func (pm *Simulator) SyncTo(blockNum uint64, step uint64) (uint64, error) {
@@ -384,15 +454,43 @@ func (pm *Simulator) Init(step uint64) error {
 	return nil
 }
 
+// Fork是O(1)的且不修改原pool, 只需要读锁, 同步应用批次时等待
 func (pm *Simulator) ForkPool(poolAddress common.Address) (*CorePool, error) {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
 	if pool, ok := pm.Pools[poolAddress]; !ok {
-		return nil, fmt.Errorf("pool not exists %s", poolAddress)
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, poolAddress)
 	} else {
 		//currentBlockNum := pm.CurrentBlock()
 		//if currentBlockNum != blockNum {
 		//	return nil, fmt.Errorf("fork pool at %d , but current synced block is %d", blockNum, currentBlockNum)
 		//}
-		fork := pool.Clone()
+		fork := pool.Fork()
 		return fork, nil
 	}
 }
+
+// 所有pool的地址, 按地址排序
+func (pm *Simulator) PoolAddresses() []common.Address {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	addresses := make([]common.Address, 0, len(pm.Pools))
+	for addr := range pm.Pools {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	return addresses
+}
+
+// 用fork提交的pool替换当前状态, 沿用数据库中的记录. 调用方持有lock
+func (pm *Simulator) replacePool(pool *CorePool) {
+	addr := common.HexToAddress(pool.PoolAddress)
+	if old, ok := pm.Pools[addr]; ok {
+		pool.Model = old.Model
+		pool.HasCreated = old.HasCreated
+	}
+	pm.Pools[addr] = pool
+	pm.dirtyPools[pool.PoolAddress] = pool
+}
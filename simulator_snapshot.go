@@ -1,118 +1,140 @@
 package uniswap_v3_simulator
 
 import (
-	"encoding/json"
+	"fmt"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/sirupsen/logrus"
 )
 
-// 分叉而不影响原数据
+// 分叉而不影响原数据, parent为nil时从Simulator分叉, 否则从parent读取
 type SimulatorFork struct {
-	Pools     map[common.Address]*CorePool
-	simulator *Simulator
+	Pools        map[common.Address]*CorePool
+	simulator    *Simulator
+	parent       *SimulatorFork
+	baseVersions map[common.Address]uint64 // 分叉时parent中pool的版本
+	Policy       ApplyPolicy               // nil时沿用Simulator的策略, 隔离只记录在fork自己的列表中
+	quarantine   *QuarantinePolicy         // Simulator隔离列表的内存副本, 第一次HandleLogs时创建
+	Observer     Observer                  // HandleLogs应用的事件, nil时不通知
 }
 
 func NewSimulatorSnapshot(s *Simulator) *SimulatorFork {
 	return &SimulatorFork{
-		Pools:     map[common.Address]*CorePool{},
-		simulator: s,
+		Pools:        map[common.Address]*CorePool{},
+		simulator:    s,
+		baseVersions: map[common.Address]uint64{},
 	}
 }
 
+// 在当前fork之上再分叉, 子fork的修改不影响当前fork, 直到Commit
+func (s *SimulatorFork) Fork() *SimulatorFork {
+	return &SimulatorFork{
+		Pools:        map[common.Address]*CorePool{},
+		simulator:    s.simulator,
+		parent:       s,
+		baseVersions: map[common.Address]uint64{},
+	}
+}
+
+func (s *SimulatorFork) Parent() *SimulatorFork {
+	return s.parent
+}
+
 func (s *SimulatorFork) GetPool(addr common.Address) (*CorePool, error) {
 	if _, ok := s.Pools[addr]; !ok {
 		// fork
-		forkedPool, err := s.simulator.ForkPool(addr)
+		forkedPool, err := s.forkFromParent(addr)
 		if err != nil {
 			return nil, err
 		}
 		s.Pools[addr] = forkedPool
+		s.baseVersions[addr] = forkedPool.Version()
 	}
 	return s.Pools[addr], nil
 }
 
-func (s *SimulatorFork) HandleLogs(logs []types.Log) error {
-	for _, log := range logs {
-		if log.Address == skipAddress[0] || log.Address == skipAddress[1] || log.Address == skipAddress[2] {
-			continue
+func (s *SimulatorFork) forkFromParent(addr common.Address) (*CorePool, error) {
+	if s.parent == nil {
+		return s.simulator.ForkPool(addr)
+	}
+	pool, err := s.parent.GetPool(addr)
+	if err != nil {
+		return nil, err
+	}
+	return pool.Fork(), nil
+}
+
+// parent中当前的pool, 不存在时返回nil. 调用方持有Simulator的lock
+func (s *SimulatorFork) parentPool(addr common.Address) *CorePool {
+	if s.parent == nil {
+		return s.simulator.Pools[addr]
+	}
+	if pool, ok := s.parent.Pools[addr]; ok {
+		return pool
+	}
+	return s.parent.parentPool(addr)
+}
+
+// what-if模拟不能写入Simulator持久化的隔离列表, 否则同步会永久跳过该pool
+func (s *SimulatorFork) policy() ApplyPolicy {
+	if s.Policy != nil {
+		return s.Policy
+	}
+	if s.quarantine == nil {
+		s.quarantine = s.policyQuarantine().Copy()
+	}
+	switch policy := s.simulator.Policy.(type) {
+	case nil:
+		return DefaultPolicy{Quarantine: s.quarantine}
+	case *QuarantinePolicy:
+		if policy == s.simulator.Quarantine {
+			return DefaultPolicy{Quarantine: s.quarantine}
 		}
-		if len(log.Topics) == 0 {
-			return nil
+	case DefaultPolicy:
+		if policy.Quarantine == s.simulator.Quarantine {
+			return DefaultPolicy{Quarantine: s.quarantine, Strict: policy.Strict}
 		}
-		topic0 := log.Topics[0]
-		if topic0 == s.simulator.InitializeID {
-			pool, err := s.simulator.NewPool(&log)
-			if err != nil {
-				logrus.Error(err)
-				if err.Error() == "execution reverted" {
-					continue
-				} else {
-					logrus.Fatal(err)
-				}
-			}
-			pool.DeployBlockNum = log.BlockNumber
-			pool.CurrentBlockNum = log.BlockNumber
-			s.Pools[common.HexToAddress(pool.PoolAddress)] = pool
-		} else {
-			var pool *CorePool
-			var err error
-			if topic0 == s.simulator.MintID || topic0 == s.simulator.BurnID || topic0 == s.simulator.SwapID {
-				pool, err = s.GetPool(log.Address)
-				if err != nil {
-					return err
-				}
-			} else {
-				continue
-			}
+	}
+	return s.simulator.Policy
+}
+
+// fork当前的隔离列表, 还没有创建时为parent的
+func (s *SimulatorFork) policyQuarantine() *QuarantinePolicy {
+	if s.quarantine != nil {
+		return s.quarantine
+	}
+	if s.parent != nil {
+		return s.parent.policyQuarantine()
+	}
+	return s.simulator.Quarantine
+}
 
-			if topic0 == s.simulator.MintID {
-				mint, err := parseUniv3MintEvent(&log)
-				if err != nil {
-					logrus.Warnf("failed parse mint event, tx: %s  pool: %s", log.TxHash, log.Address)
-					continue
-				}
-				_, _, err = pool.Mint(mint.Owner, mint.TickLower, mint.TickUpper, mint.Amount)
-				if err != nil {
-					logrus.Errorf("failed execute mint event, %s tx: %s  pool: %s", err, log.TxHash, log.Address)
-					return err
-				}
-				pool.CurrentBlockNum = log.BlockNumber
-			} else if topic0 == s.simulator.BurnID {
-				burn, err := parseUniv3BurnEvent(&log)
-				if err != nil {
-					logrus.Warnf("failed parse burn event, tx: %s  pool: %s err: %s", log.TxHash, log.Address, err)
-					continue
-				}
-				//s, _ := json.Marshal(burn)
-				//logrus.Infof("burn: %s %s %s", log.Address, log.TxHash, string(s))
-				_, _, err = pool.Burn(burn.Owner, burn.TickLower, burn.TickUpper, burn.Amount)
-				if err != nil {
-					logrus.Errorf("failed execute burn event, %s tx: %s  pool: %s", err, log.TxHash, log.Address)
-					return err
-				}
-				pool.CurrentBlockNum = log.BlockNumber
-			} else if topic0 == s.simulator.SwapID {
-				swap, err := parseUniv3SwapEvent(&log)
-				if err != nil {
-					logrus.Warnf("failed parse swap event, tx: %s  pool: %s", log.TxHash, log.Address)
-					continue
-				}
-				amountSpecified, sqrtPriceX96, err := pool.ResolveInputFromSwapResultEvent(swap)
-				if err != nil {
-					s, _ := json.Marshal(swap)
-					logrus.Infof("swap: %s %s %s", log.Address, log.TxHash, string(s))
-					return err
-				}
+// 和Simulator使用同一套事件处理逻辑, 只是读写fork中的pool且不记录历史
+func (s *SimulatorFork) HandleLogs(logs []types.Log) error {
+	applier := NewEventApplier(s.simulator, forkStore{fork: s}, s.policy())
+	// fork上的模拟不计入同步指标
+	applier.metrics = nil
+	return applier.Apply(logs)
+}
+
+// 持有一次锁分叉addrs中的pool, 返回fork和这些pool所在的同步高度. 其它pool仍在首次访问时分叉
+func (pm *Simulator) Snapshot(addrs ...common.Address) (*SimulatorFork, uint64, error) {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return pm.snapshot(addrs)
+}
 
-				_, _, _, err = pool.HandleSwap(swap.Amount0.IsPositive(), amountSpecified, sqrtPriceX96, false)
-				if err != nil {
-					logrus.Errorf("failed execute swap event, %s tx: %s  pool: %s", err, log.TxHash, log.Address)
-					return err
-				}
-				pool.CurrentBlockNum = log.BlockNumber
-			}
+// 调用方持有lock或读锁
+func (pm *Simulator) snapshot(addrs []common.Address) (*SimulatorFork, uint64, error) {
+	fork := NewSimulatorSnapshot(pm)
+	for _, addr := range addrs {
+		pool, ok := pm.Pools[addr]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %s", ErrPoolNotFound, addr)
 		}
+		forked := pool.Fork()
+		fork.Pools[addr] = forked
+		fork.baseVersions[addr] = forked.Version()
 	}
-	return nil
+	return fork, pm.currentBlock, nil
 }
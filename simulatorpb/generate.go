@@ -0,0 +1,4 @@
+// Package simulatorpb是simulator.proto生成的消息和gRPC客户端/服务端代码
+package simulatorpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative simulator.proto
@@ -0,0 +1,1676 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: simulator.proto
+
+package simulatorpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ActionType int32
+
+const (
+	ActionType_ACTION_TYPE_UNSPECIFIED ActionType = 0
+	ActionType_ACTION_TYPE_SWAP        ActionType = 1
+	ActionType_ACTION_TYPE_MINT        ActionType = 2
+	ActionType_ACTION_TYPE_BURN        ActionType = 3
+	ActionType_ACTION_TYPE_COLLECT     ActionType = 4
+	ActionType_ACTION_TYPE_FLASH       ActionType = 5
+)
+
+// Enum value maps for ActionType.
+var (
+	ActionType_name = map[int32]string{
+		0: "ACTION_TYPE_UNSPECIFIED",
+		1: "ACTION_TYPE_SWAP",
+		2: "ACTION_TYPE_MINT",
+		3: "ACTION_TYPE_BURN",
+		4: "ACTION_TYPE_COLLECT",
+		5: "ACTION_TYPE_FLASH",
+	}
+	ActionType_value = map[string]int32{
+		"ACTION_TYPE_UNSPECIFIED": 0,
+		"ACTION_TYPE_SWAP":        1,
+		"ACTION_TYPE_MINT":        2,
+		"ACTION_TYPE_BURN":        3,
+		"ACTION_TYPE_COLLECT":     4,
+		"ACTION_TYPE_FLASH":       5,
+	}
+)
+
+func (x ActionType) Enum() *ActionType {
+	p := new(ActionType)
+	*p = x
+	return p
+}
+
+func (x ActionType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ActionType) Descriptor() protoreflect.EnumDescriptor {
+	return file_simulator_proto_enumTypes[0].Descriptor()
+}
+
+func (ActionType) Type() protoreflect.EnumType {
+	return &file_simulator_proto_enumTypes[0]
+}
+
+func (x ActionType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ActionType.Descriptor instead.
+func (ActionType) EnumDescriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{0}
+}
+
+type Slot0 struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SqrtPriceX96  string                 `protobuf:"bytes,1,opt,name=sqrt_price_x96,json=sqrtPriceX96,proto3" json:"sqrt_price_x96,omitempty"`
+	Tick          int32                  `protobuf:"varint,2,opt,name=tick,proto3" json:"tick,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Slot0) Reset() {
+	*x = Slot0{}
+	mi := &file_simulator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Slot0) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Slot0) ProtoMessage() {}
+
+func (x *Slot0) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Slot0.ProtoReflect.Descriptor instead.
+func (*Slot0) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Slot0) GetSqrtPriceX96() string {
+	if x != nil {
+		return x.SqrtPriceX96
+	}
+	return ""
+}
+
+func (x *Slot0) GetTick() int32 {
+	if x != nil {
+		return x.Tick
+	}
+	return 0
+}
+
+type PoolState struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	PoolAddress          string                 `protobuf:"bytes,1,opt,name=pool_address,json=poolAddress,proto3" json:"pool_address,omitempty"`
+	Block                uint64                 `protobuf:"varint,2,opt,name=block,proto3" json:"block,omitempty"`
+	Token0               string                 `protobuf:"bytes,3,opt,name=token0,proto3" json:"token0,omitempty"`
+	Token1               string                 `protobuf:"bytes,4,opt,name=token1,proto3" json:"token1,omitempty"`
+	Fee                  uint32                 `protobuf:"varint,5,opt,name=fee,proto3" json:"fee,omitempty"`
+	TickSpacing          int32                  `protobuf:"varint,6,opt,name=tick_spacing,json=tickSpacing,proto3" json:"tick_spacing,omitempty"`
+	Slot0                *Slot0                 `protobuf:"bytes,7,opt,name=slot0,proto3" json:"slot0,omitempty"`
+	Liquidity            string                 `protobuf:"bytes,8,opt,name=liquidity,proto3" json:"liquidity,omitempty"`
+	FeeGrowthGlobal0X128 string                 `protobuf:"bytes,9,opt,name=fee_growth_global0_x128,json=feeGrowthGlobal0X128,proto3" json:"fee_growth_global0_x128,omitempty"`
+	FeeGrowthGlobal1X128 string                 `protobuf:"bytes,10,opt,name=fee_growth_global1_x128,json=feeGrowthGlobal1X128,proto3" json:"fee_growth_global1_x128,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *PoolState) Reset() {
+	*x = PoolState{}
+	mi := &file_simulator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PoolState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PoolState) ProtoMessage() {}
+
+func (x *PoolState) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PoolState.ProtoReflect.Descriptor instead.
+func (*PoolState) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PoolState) GetPoolAddress() string {
+	if x != nil {
+		return x.PoolAddress
+	}
+	return ""
+}
+
+func (x *PoolState) GetBlock() uint64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *PoolState) GetToken0() string {
+	if x != nil {
+		return x.Token0
+	}
+	return ""
+}
+
+func (x *PoolState) GetToken1() string {
+	if x != nil {
+		return x.Token1
+	}
+	return ""
+}
+
+func (x *PoolState) GetFee() uint32 {
+	if x != nil {
+		return x.Fee
+	}
+	return 0
+}
+
+func (x *PoolState) GetTickSpacing() int32 {
+	if x != nil {
+		return x.TickSpacing
+	}
+	return 0
+}
+
+func (x *PoolState) GetSlot0() *Slot0 {
+	if x != nil {
+		return x.Slot0
+	}
+	return nil
+}
+
+func (x *PoolState) GetLiquidity() string {
+	if x != nil {
+		return x.Liquidity
+	}
+	return ""
+}
+
+func (x *PoolState) GetFeeGrowthGlobal0X128() string {
+	if x != nil {
+		return x.FeeGrowthGlobal0X128
+	}
+	return ""
+}
+
+func (x *PoolState) GetFeeGrowthGlobal1X128() string {
+	if x != nil {
+		return x.FeeGrowthGlobal1X128
+	}
+	return ""
+}
+
+type Tick struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	TickIndex             int32                  `protobuf:"varint,1,opt,name=tick_index,json=tickIndex,proto3" json:"tick_index,omitempty"`
+	LiquidityGross        string                 `protobuf:"bytes,2,opt,name=liquidity_gross,json=liquidityGross,proto3" json:"liquidity_gross,omitempty"`
+	LiquidityNet          string                 `protobuf:"bytes,3,opt,name=liquidity_net,json=liquidityNet,proto3" json:"liquidity_net,omitempty"`
+	FeeGrowthOutside0X128 string                 `protobuf:"bytes,4,opt,name=fee_growth_outside0_x128,json=feeGrowthOutside0X128,proto3" json:"fee_growth_outside0_x128,omitempty"`
+	FeeGrowthOutside1X128 string                 `protobuf:"bytes,5,opt,name=fee_growth_outside1_x128,json=feeGrowthOutside1X128,proto3" json:"fee_growth_outside1_x128,omitempty"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *Tick) Reset() {
+	*x = Tick{}
+	mi := &file_simulator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tick) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tick) ProtoMessage() {}
+
+func (x *Tick) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tick.ProtoReflect.Descriptor instead.
+func (*Tick) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Tick) GetTickIndex() int32 {
+	if x != nil {
+		return x.TickIndex
+	}
+	return 0
+}
+
+func (x *Tick) GetLiquidityGross() string {
+	if x != nil {
+		return x.LiquidityGross
+	}
+	return ""
+}
+
+func (x *Tick) GetLiquidityNet() string {
+	if x != nil {
+		return x.LiquidityNet
+	}
+	return ""
+}
+
+func (x *Tick) GetFeeGrowthOutside0X128() string {
+	if x != nil {
+		return x.FeeGrowthOutside0X128
+	}
+	return ""
+}
+
+func (x *Tick) GetFeeGrowthOutside1X128() string {
+	if x != nil {
+		return x.FeeGrowthOutside1X128
+	}
+	return ""
+}
+
+type Position struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	Owner                    string                 `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	TickLower                int32                  `protobuf:"varint,2,opt,name=tick_lower,json=tickLower,proto3" json:"tick_lower,omitempty"`
+	TickUpper                int32                  `protobuf:"varint,3,opt,name=tick_upper,json=tickUpper,proto3" json:"tick_upper,omitempty"`
+	Liquidity                string                 `protobuf:"bytes,4,opt,name=liquidity,proto3" json:"liquidity,omitempty"`
+	FeeGrowthInside0LastX128 string                 `protobuf:"bytes,5,opt,name=fee_growth_inside0_last_x128,json=feeGrowthInside0LastX128,proto3" json:"fee_growth_inside0_last_x128,omitempty"`
+	FeeGrowthInside1LastX128 string                 `protobuf:"bytes,6,opt,name=fee_growth_inside1_last_x128,json=feeGrowthInside1LastX128,proto3" json:"fee_growth_inside1_last_x128,omitempty"`
+	TokensOwed0              string                 `protobuf:"bytes,7,opt,name=tokens_owed0,json=tokensOwed0,proto3" json:"tokens_owed0,omitempty"`
+	TokensOwed1              string                 `protobuf:"bytes,8,opt,name=tokens_owed1,json=tokensOwed1,proto3" json:"tokens_owed1,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *Position) Reset() {
+	*x = Position{}
+	mi := &file_simulator_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Position) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Position) ProtoMessage() {}
+
+func (x *Position) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Position.ProtoReflect.Descriptor instead.
+func (*Position) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Position) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Position) GetTickLower() int32 {
+	if x != nil {
+		return x.TickLower
+	}
+	return 0
+}
+
+func (x *Position) GetTickUpper() int32 {
+	if x != nil {
+		return x.TickUpper
+	}
+	return 0
+}
+
+func (x *Position) GetLiquidity() string {
+	if x != nil {
+		return x.Liquidity
+	}
+	return ""
+}
+
+func (x *Position) GetFeeGrowthInside0LastX128() string {
+	if x != nil {
+		return x.FeeGrowthInside0LastX128
+	}
+	return ""
+}
+
+func (x *Position) GetFeeGrowthInside1LastX128() string {
+	if x != nil {
+		return x.FeeGrowthInside1LastX128
+	}
+	return ""
+}
+
+func (x *Position) GetTokensOwed0() string {
+	if x != nil {
+		return x.TokensOwed0
+	}
+	return ""
+}
+
+func (x *Position) GetTokensOwed1() string {
+	if x != nil {
+		return x.TokensOwed1
+	}
+	return ""
+}
+
+type GetPoolRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Pool             string                 `protobuf:"bytes,1,opt,name=pool,proto3" json:"pool,omitempty"`
+	IncludeTicks     bool                   `protobuf:"varint,2,opt,name=include_ticks,json=includeTicks,proto3" json:"include_ticks,omitempty"`
+	IncludePositions bool                   `protobuf:"varint,3,opt,name=include_positions,json=includePositions,proto3" json:"include_positions,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *GetPoolRequest) Reset() {
+	*x = GetPoolRequest{}
+	mi := &file_simulator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPoolRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPoolRequest) ProtoMessage() {}
+
+func (x *GetPoolRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPoolRequest.ProtoReflect.Descriptor instead.
+func (*GetPoolRequest) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetPoolRequest) GetPool() string {
+	if x != nil {
+		return x.Pool
+	}
+	return ""
+}
+
+func (x *GetPoolRequest) GetIncludeTicks() bool {
+	if x != nil {
+		return x.IncludeTicks
+	}
+	return false
+}
+
+func (x *GetPoolRequest) GetIncludePositions() bool {
+	if x != nil {
+		return x.IncludePositions
+	}
+	return false
+}
+
+type GetPoolResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         *PoolState             `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	Ticks         []*Tick                `protobuf:"bytes,2,rep,name=ticks,proto3" json:"ticks,omitempty"`
+	Positions     []*Position            `protobuf:"bytes,3,rep,name=positions,proto3" json:"positions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPoolResponse) Reset() {
+	*x = GetPoolResponse{}
+	mi := &file_simulator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPoolResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPoolResponse) ProtoMessage() {}
+
+func (x *GetPoolResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPoolResponse.ProtoReflect.Descriptor instead.
+func (*GetPoolResponse) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetPoolResponse) GetState() *PoolState {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+func (x *GetPoolResponse) GetTicks() []*Tick {
+	if x != nil {
+		return x.Ticks
+	}
+	return nil
+}
+
+func (x *GetPoolResponse) GetPositions() []*Position {
+	if x != nil {
+		return x.Positions
+	}
+	return nil
+}
+
+type QuoteRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Pool       string                 `protobuf:"bytes,1,opt,name=pool,proto3" json:"pool,omitempty"`
+	ZeroForOne bool                   `protobuf:"varint,2,opt,name=zero_for_one,json=zeroForOne,proto3" json:"zero_for_one,omitempty"`
+	// false时amount为输入数量, true时为输出数量
+	ExactOutput bool   `protobuf:"varint,3,opt,name=exact_output,json=exactOutput,proto3" json:"exact_output,omitempty"`
+	Amount      string `protobuf:"bytes,4,opt,name=amount,proto3" json:"amount,omitempty"`
+	// 为空时不限制价格
+	SqrtPriceLimitX96 string `protobuf:"bytes,5,opt,name=sqrt_price_limit_x96,json=sqrtPriceLimitX96,proto3" json:"sqrt_price_limit_x96,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *QuoteRequest) Reset() {
+	*x = QuoteRequest{}
+	mi := &file_simulator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuoteRequest) ProtoMessage() {}
+
+func (x *QuoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuoteRequest.ProtoReflect.Descriptor instead.
+func (*QuoteRequest) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *QuoteRequest) GetPool() string {
+	if x != nil {
+		return x.Pool
+	}
+	return ""
+}
+
+func (x *QuoteRequest) GetZeroForOne() bool {
+	if x != nil {
+		return x.ZeroForOne
+	}
+	return false
+}
+
+func (x *QuoteRequest) GetExactOutput() bool {
+	if x != nil {
+		return x.ExactOutput
+	}
+	return false
+}
+
+func (x *QuoteRequest) GetAmount() string {
+	if x != nil {
+		return x.Amount
+	}
+	return ""
+}
+
+func (x *QuoteRequest) GetSqrtPriceLimitX96() string {
+	if x != nil {
+		return x.SqrtPriceLimitX96
+	}
+	return ""
+}
+
+type QuoteResponse struct {
+	state                   protoimpl.MessageState `protogen:"open.v1"`
+	Block                   uint64                 `protobuf:"varint,1,opt,name=block,proto3" json:"block,omitempty"`
+	AmountIn                string                 `protobuf:"bytes,2,opt,name=amount_in,json=amountIn,proto3" json:"amount_in,omitempty"`
+	AmountOut               string                 `protobuf:"bytes,3,opt,name=amount_out,json=amountOut,proto3" json:"amount_out,omitempty"`
+	Amount0                 string                 `protobuf:"bytes,4,opt,name=amount0,proto3" json:"amount0,omitempty"`
+	Amount1                 string                 `protobuf:"bytes,5,opt,name=amount1,proto3" json:"amount1,omitempty"`
+	SqrtPriceX96After       string                 `protobuf:"bytes,6,opt,name=sqrt_price_x96_after,json=sqrtPriceX96After,proto3" json:"sqrt_price_x96_after,omitempty"`
+	TickAfter               int32                  `protobuf:"varint,7,opt,name=tick_after,json=tickAfter,proto3" json:"tick_after,omitempty"`
+	LiquidityAfter          string                 `protobuf:"bytes,8,opt,name=liquidity_after,json=liquidityAfter,proto3" json:"liquidity_after,omitempty"`
+	InitializedTicksCrossed uint32                 `protobuf:"varint,9,opt,name=initialized_ticks_crossed,json=initializedTicksCrossed,proto3" json:"initialized_ticks_crossed,omitempty"`
+	unknownFields           protoimpl.UnknownFields
+	sizeCache               protoimpl.SizeCache
+}
+
+func (x *QuoteResponse) Reset() {
+	*x = QuoteResponse{}
+	mi := &file_simulator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuoteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuoteResponse) ProtoMessage() {}
+
+func (x *QuoteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuoteResponse.ProtoReflect.Descriptor instead.
+func (*QuoteResponse) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *QuoteResponse) GetBlock() uint64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *QuoteResponse) GetAmountIn() string {
+	if x != nil {
+		return x.AmountIn
+	}
+	return ""
+}
+
+func (x *QuoteResponse) GetAmountOut() string {
+	if x != nil {
+		return x.AmountOut
+	}
+	return ""
+}
+
+func (x *QuoteResponse) GetAmount0() string {
+	if x != nil {
+		return x.Amount0
+	}
+	return ""
+}
+
+func (x *QuoteResponse) GetAmount1() string {
+	if x != nil {
+		return x.Amount1
+	}
+	return ""
+}
+
+func (x *QuoteResponse) GetSqrtPriceX96After() string {
+	if x != nil {
+		return x.SqrtPriceX96After
+	}
+	return ""
+}
+
+func (x *QuoteResponse) GetTickAfter() int32 {
+	if x != nil {
+		return x.TickAfter
+	}
+	return 0
+}
+
+func (x *QuoteResponse) GetLiquidityAfter() string {
+	if x != nil {
+		return x.LiquidityAfter
+	}
+	return ""
+}
+
+func (x *QuoteResponse) GetInitializedTicksCrossed() uint32 {
+	if x != nil {
+		return x.InitializedTicksCrossed
+	}
+	return 0
+}
+
+// swap使用zero_for_one/exact_output/amount/sqrt_price_limit_x96,
+// mint/burn使用owner/tick_lower/tick_upper和amount(流动性), collect的请求数量为空时取出全部,
+// flash借出amount0_requested/amount1_requested, 归还paid0/paid1(为空时为最低手续费)
+type Action struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Type              ActionType             `protobuf:"varint,1,opt,name=type,proto3,enum=univ3sim.v1.ActionType" json:"type,omitempty"`
+	Pool              string                 `protobuf:"bytes,2,opt,name=pool,proto3" json:"pool,omitempty"`
+	ZeroForOne        bool                   `protobuf:"varint,3,opt,name=zero_for_one,json=zeroForOne,proto3" json:"zero_for_one,omitempty"`
+	ExactOutput       bool                   `protobuf:"varint,4,opt,name=exact_output,json=exactOutput,proto3" json:"exact_output,omitempty"`
+	Amount            string                 `protobuf:"bytes,5,opt,name=amount,proto3" json:"amount,omitempty"`
+	SqrtPriceLimitX96 string                 `protobuf:"bytes,6,opt,name=sqrt_price_limit_x96,json=sqrtPriceLimitX96,proto3" json:"sqrt_price_limit_x96,omitempty"`
+	Owner             string                 `protobuf:"bytes,7,opt,name=owner,proto3" json:"owner,omitempty"`
+	TickLower         int32                  `protobuf:"varint,8,opt,name=tick_lower,json=tickLower,proto3" json:"tick_lower,omitempty"`
+	TickUpper         int32                  `protobuf:"varint,9,opt,name=tick_upper,json=tickUpper,proto3" json:"tick_upper,omitempty"`
+	Amount0Requested  string                 `protobuf:"bytes,10,opt,name=amount0_requested,json=amount0Requested,proto3" json:"amount0_requested,omitempty"`
+	Amount1Requested  string                 `protobuf:"bytes,11,opt,name=amount1_requested,json=amount1Requested,proto3" json:"amount1_requested,omitempty"`
+	Paid0             string                 `protobuf:"bytes,12,opt,name=paid0,proto3" json:"paid0,omitempty"`
+	Paid1             string                 `protobuf:"bytes,13,opt,name=paid1,proto3" json:"paid1,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Action) Reset() {
+	*x = Action{}
+	mi := &file_simulator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Action) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Action) ProtoMessage() {}
+
+func (x *Action) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Action.ProtoReflect.Descriptor instead.
+func (*Action) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Action) GetType() ActionType {
+	if x != nil {
+		return x.Type
+	}
+	return ActionType_ACTION_TYPE_UNSPECIFIED
+}
+
+func (x *Action) GetPool() string {
+	if x != nil {
+		return x.Pool
+	}
+	return ""
+}
+
+func (x *Action) GetZeroForOne() bool {
+	if x != nil {
+		return x.ZeroForOne
+	}
+	return false
+}
+
+func (x *Action) GetExactOutput() bool {
+	if x != nil {
+		return x.ExactOutput
+	}
+	return false
+}
+
+func (x *Action) GetAmount() string {
+	if x != nil {
+		return x.Amount
+	}
+	return ""
+}
+
+func (x *Action) GetSqrtPriceLimitX96() string {
+	if x != nil {
+		return x.SqrtPriceLimitX96
+	}
+	return ""
+}
+
+func (x *Action) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Action) GetTickLower() int32 {
+	if x != nil {
+		return x.TickLower
+	}
+	return 0
+}
+
+func (x *Action) GetTickUpper() int32 {
+	if x != nil {
+		return x.TickUpper
+	}
+	return 0
+}
+
+func (x *Action) GetAmount0Requested() string {
+	if x != nil {
+		return x.Amount0Requested
+	}
+	return ""
+}
+
+func (x *Action) GetAmount1Requested() string {
+	if x != nil {
+		return x.Amount1Requested
+	}
+	return ""
+}
+
+func (x *Action) GetPaid0() string {
+	if x != nil {
+		return x.Paid0
+	}
+	return ""
+}
+
+func (x *Action) GetPaid1() string {
+	if x != nil {
+		return x.Paid1
+	}
+	return ""
+}
+
+type SimulateBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Actions       []*Action              `protobuf:"bytes,1,rep,name=actions,proto3" json:"actions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SimulateBatchRequest) Reset() {
+	*x = SimulateBatchRequest{}
+	mi := &file_simulator_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SimulateBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimulateBatchRequest) ProtoMessage() {}
+
+func (x *SimulateBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimulateBatchRequest.ProtoReflect.Descriptor instead.
+func (*SimulateBatchRequest) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SimulateBatchRequest) GetActions() []*Action {
+	if x != nil {
+		return x.Actions
+	}
+	return nil
+}
+
+type ActionResult struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Amount0  string                 `protobuf:"bytes,1,opt,name=amount0,proto3" json:"amount0,omitempty"`
+	Amount1  string                 `protobuf:"bytes,2,opt,name=amount1,proto3" json:"amount1,omitempty"`
+	Reverted bool                   `protobuf:"varint,3,opt,name=reverted,proto3" json:"reverted,omitempty"`
+	// 合约的revert字符串, 部分require没有字符串
+	Revert        string `protobuf:"bytes,4,opt,name=revert,proto3" json:"revert,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ActionResult) Reset() {
+	*x = ActionResult{}
+	mi := &file_simulator_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ActionResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActionResult) ProtoMessage() {}
+
+func (x *ActionResult) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActionResult.ProtoReflect.Descriptor instead.
+func (*ActionResult) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ActionResult) GetAmount0() string {
+	if x != nil {
+		return x.Amount0
+	}
+	return ""
+}
+
+func (x *ActionResult) GetAmount1() string {
+	if x != nil {
+		return x.Amount1
+	}
+	return ""
+}
+
+func (x *ActionResult) GetReverted() bool {
+	if x != nil {
+		return x.Reverted
+	}
+	return false
+}
+
+func (x *ActionResult) GetRevert() string {
+	if x != nil {
+		return x.Revert
+	}
+	return ""
+}
+
+type SimulateBatchResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Block uint64                 `protobuf:"varint,1,opt,name=block,proto3" json:"block,omitempty"`
+	// 执行到revert的操作为止
+	Results []*ActionResult `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	// 涉及的pool在bundle之后的状态, revert时为分叉时的状态
+	Pools         []*PoolState `protobuf:"bytes,3,rep,name=pools,proto3" json:"pools,omitempty"`
+	Reverted      bool         `protobuf:"varint,4,opt,name=reverted,proto3" json:"reverted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SimulateBatchResponse) Reset() {
+	*x = SimulateBatchResponse{}
+	mi := &file_simulator_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SimulateBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimulateBatchResponse) ProtoMessage() {}
+
+func (x *SimulateBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimulateBatchResponse.ProtoReflect.Descriptor instead.
+func (*SimulateBatchResponse) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SimulateBatchResponse) GetBlock() uint64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *SimulateBatchResponse) GetResults() []*ActionResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *SimulateBatchResponse) GetPools() []*PoolState {
+	if x != nil {
+		return x.Pools
+	}
+	return nil
+}
+
+func (x *SimulateBatchResponse) GetReverted() bool {
+	if x != nil {
+		return x.Reverted
+	}
+	return false
+}
+
+type StreamPoolUpdatesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 为空时订阅所有pool
+	Pools         []string `protobuf:"bytes,1,rep,name=pools,proto3" json:"pools,omitempty"`
+	Snapshot      bool     `protobuf:"varint,2,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamPoolUpdatesRequest) Reset() {
+	*x = StreamPoolUpdatesRequest{}
+	mi := &file_simulator_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamPoolUpdatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamPoolUpdatesRequest) ProtoMessage() {}
+
+func (x *StreamPoolUpdatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamPoolUpdatesRequest.ProtoReflect.Descriptor instead.
+func (*StreamPoolUpdatesRequest) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StreamPoolUpdatesRequest) GetPools() []string {
+	if x != nil {
+		return x.Pools
+	}
+	return nil
+}
+
+func (x *StreamPoolUpdatesRequest) GetSnapshot() bool {
+	if x != nil {
+		return x.Snapshot
+	}
+	return false
+}
+
+type TickChange struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	TickIndex int32                  `protobuf:"varint,1,opt,name=tick_index,json=tickIndex,proto3" json:"tick_index,omitempty"`
+	// 删除时为空
+	After         *Tick `protobuf:"bytes,2,opt,name=after,proto3" json:"after,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TickChange) Reset() {
+	*x = TickChange{}
+	mi := &file_simulator_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TickChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TickChange) ProtoMessage() {}
+
+func (x *TickChange) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TickChange.ProtoReflect.Descriptor instead.
+func (*TickChange) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *TickChange) GetTickIndex() int32 {
+	if x != nil {
+		return x.TickIndex
+	}
+	return 0
+}
+
+func (x *TickChange) GetAfter() *Tick {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+type PositionChange struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Owner     string                 `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	TickLower int32                  `protobuf:"varint,2,opt,name=tick_lower,json=tickLower,proto3" json:"tick_lower,omitempty"`
+	TickUpper int32                  `protobuf:"varint,3,opt,name=tick_upper,json=tickUpper,proto3" json:"tick_upper,omitempty"`
+	// 删除时为空
+	After         *Position `protobuf:"bytes,4,opt,name=after,proto3" json:"after,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PositionChange) Reset() {
+	*x = PositionChange{}
+	mi := &file_simulator_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PositionChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PositionChange) ProtoMessage() {}
+
+func (x *PositionChange) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PositionChange.ProtoReflect.Descriptor instead.
+func (*PositionChange) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PositionChange) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *PositionChange) GetTickLower() int32 {
+	if x != nil {
+		return x.TickLower
+	}
+	return 0
+}
+
+func (x *PositionChange) GetTickUpper() int32 {
+	if x != nil {
+		return x.TickUpper
+	}
+	return 0
+}
+
+func (x *PositionChange) GetAfter() *Position {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+type PoolEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// initialize/mint/burn/swap/collect/flash
+	Event           string `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	TxHash          string `protobuf:"bytes,2,opt,name=tx_hash,json=txHash,proto3" json:"tx_hash,omitempty"`
+	LogIndex        uint64 `protobuf:"varint,3,opt,name=log_index,json=logIndex,proto3" json:"log_index,omitempty"`
+	Block           uint64 `protobuf:"varint,4,opt,name=block,proto3" json:"block,omitempty"`
+	Before          *Slot0 `protobuf:"bytes,5,opt,name=before,proto3" json:"before,omitempty"`
+	LiquidityBefore string `protobuf:"bytes,6,opt,name=liquidity_before,json=liquidityBefore,proto3" json:"liquidity_before,omitempty"`
+	// 事件参数, initialize时为空
+	Owner         string            `protobuf:"bytes,7,opt,name=owner,proto3" json:"owner,omitempty"`
+	Params        map[string]string `protobuf:"bytes,8,rep,name=params,proto3" json:"params,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Amount0       string            `protobuf:"bytes,9,opt,name=amount0,proto3" json:"amount0,omitempty"`
+	Amount1       string            `protobuf:"bytes,10,opt,name=amount1,proto3" json:"amount1,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PoolEvent) Reset() {
+	*x = PoolEvent{}
+	mi := &file_simulator_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PoolEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PoolEvent) ProtoMessage() {}
+
+func (x *PoolEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PoolEvent.ProtoReflect.Descriptor instead.
+func (*PoolEvent) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *PoolEvent) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+func (x *PoolEvent) GetTxHash() string {
+	if x != nil {
+		return x.TxHash
+	}
+	return ""
+}
+
+func (x *PoolEvent) GetLogIndex() uint64 {
+	if x != nil {
+		return x.LogIndex
+	}
+	return 0
+}
+
+func (x *PoolEvent) GetBlock() uint64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *PoolEvent) GetBefore() *Slot0 {
+	if x != nil {
+		return x.Before
+	}
+	return nil
+}
+
+func (x *PoolEvent) GetLiquidityBefore() string {
+	if x != nil {
+		return x.LiquidityBefore
+	}
+	return ""
+}
+
+func (x *PoolEvent) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *PoolEvent) GetParams() map[string]string {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+func (x *PoolEvent) GetAmount0() string {
+	if x != nil {
+		return x.Amount0
+	}
+	return ""
+}
+
+func (x *PoolEvent) GetAmount1() string {
+	if x != nil {
+		return x.Amount1
+	}
+	return ""
+}
+
+type PoolUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Pool  string                 `protobuf:"bytes,1,opt,name=pool,proto3" json:"pool,omitempty"`
+	// 订阅时的完整状态, 与event二选一
+	Snapshot *GetPoolResponse `protobuf:"bytes,2,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	Event    *PoolEvent       `protobuf:"bytes,3,opt,name=event,proto3" json:"event,omitempty"`
+	// 事件之后的状态
+	State *PoolState `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	// 仅在snapshot订阅时填充, 相对上一次更新的变化
+	Ticks         []*TickChange     `protobuf:"bytes,5,rep,name=ticks,proto3" json:"ticks,omitempty"`
+	Positions     []*PositionChange `protobuf:"bytes,6,rep,name=positions,proto3" json:"positions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PoolUpdate) Reset() {
+	*x = PoolUpdate{}
+	mi := &file_simulator_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PoolUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PoolUpdate) ProtoMessage() {}
+
+func (x *PoolUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_simulator_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PoolUpdate.ProtoReflect.Descriptor instead.
+func (*PoolUpdate) Descriptor() ([]byte, []int) {
+	return file_simulator_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PoolUpdate) GetPool() string {
+	if x != nil {
+		return x.Pool
+	}
+	return ""
+}
+
+func (x *PoolUpdate) GetSnapshot() *GetPoolResponse {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (x *PoolUpdate) GetEvent() *PoolEvent {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *PoolUpdate) GetState() *PoolState {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+func (x *PoolUpdate) GetTicks() []*TickChange {
+	if x != nil {
+		return x.Ticks
+	}
+	return nil
+}
+
+func (x *PoolUpdate) GetPositions() []*PositionChange {
+	if x != nil {
+		return x.Positions
+	}
+	return nil
+}
+
+var File_simulator_proto protoreflect.FileDescriptor
+
+const file_simulator_proto_rawDesc = "" +
+	"\n" +
+	"\x0fsimulator.proto\x12\vuniv3sim.v1\"A\n" +
+	"\x05Slot0\x12$\n" +
+	"\x0esqrt_price_x96\x18\x01 \x01(\tR\fsqrtPriceX96\x12\x12\n" +
+	"\x04tick\x18\x02 \x01(\x05R\x04tick\"\xdf\x02\n" +
+	"\tPoolState\x12!\n" +
+	"\fpool_address\x18\x01 \x01(\tR\vpoolAddress\x12\x14\n" +
+	"\x05block\x18\x02 \x01(\x04R\x05block\x12\x16\n" +
+	"\x06token0\x18\x03 \x01(\tR\x06token0\x12\x16\n" +
+	"\x06token1\x18\x04 \x01(\tR\x06token1\x12\x10\n" +
+	"\x03fee\x18\x05 \x01(\rR\x03fee\x12!\n" +
+	"\ftick_spacing\x18\x06 \x01(\x05R\vtickSpacing\x12(\n" +
+	"\x05slot0\x18\a \x01(\v2\x12.univ3sim.v1.Slot0R\x05slot0\x12\x1c\n" +
+	"\tliquidity\x18\b \x01(\tR\tliquidity\x125\n" +
+	"\x17fee_growth_global0_x128\x18\t \x01(\tR\x14feeGrowthGlobal0X128\x125\n" +
+	"\x17fee_growth_global1_x128\x18\n" +
+	" \x01(\tR\x14feeGrowthGlobal1X128\"\xe5\x01\n" +
+	"\x04Tick\x12\x1d\n" +
+	"\n" +
+	"tick_index\x18\x01 \x01(\x05R\ttickIndex\x12'\n" +
+	"\x0fliquidity_gross\x18\x02 \x01(\tR\x0eliquidityGross\x12#\n" +
+	"\rliquidity_net\x18\x03 \x01(\tR\fliquidityNet\x127\n" +
+	"\x18fee_growth_outside0_x128\x18\x04 \x01(\tR\x15feeGrowthOutside0X128\x127\n" +
+	"\x18fee_growth_outside1_x128\x18\x05 \x01(\tR\x15feeGrowthOutside1X128\"\xc2\x02\n" +
+	"\bPosition\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\x12\x1d\n" +
+	"\n" +
+	"tick_lower\x18\x02 \x01(\x05R\ttickLower\x12\x1d\n" +
+	"\n" +
+	"tick_upper\x18\x03 \x01(\x05R\ttickUpper\x12\x1c\n" +
+	"\tliquidity\x18\x04 \x01(\tR\tliquidity\x12>\n" +
+	"\x1cfee_growth_inside0_last_x128\x18\x05 \x01(\tR\x18feeGrowthInside0LastX128\x12>\n" +
+	"\x1cfee_growth_inside1_last_x128\x18\x06 \x01(\tR\x18feeGrowthInside1LastX128\x12!\n" +
+	"\ftokens_owed0\x18\a \x01(\tR\vtokensOwed0\x12!\n" +
+	"\ftokens_owed1\x18\b \x01(\tR\vtokensOwed1\"v\n" +
+	"\x0eGetPoolRequest\x12\x12\n" +
+	"\x04pool\x18\x01 \x01(\tR\x04pool\x12#\n" +
+	"\rinclude_ticks\x18\x02 \x01(\bR\fincludeTicks\x12+\n" +
+	"\x11include_positions\x18\x03 \x01(\bR\x10includePositions\"\x9d\x01\n" +
+	"\x0fGetPoolResponse\x12,\n" +
+	"\x05state\x18\x01 \x01(\v2\x16.univ3sim.v1.PoolStateR\x05state\x12'\n" +
+	"\x05ticks\x18\x02 \x03(\v2\x11.univ3sim.v1.TickR\x05ticks\x123\n" +
+	"\tpositions\x18\x03 \x03(\v2\x15.univ3sim.v1.PositionR\tpositions\"\xb0\x01\n" +
+	"\fQuoteRequest\x12\x12\n" +
+	"\x04pool\x18\x01 \x01(\tR\x04pool\x12 \n" +
+	"\fzero_for_one\x18\x02 \x01(\bR\n" +
+	"zeroForOne\x12!\n" +
+	"\fexact_output\x18\x03 \x01(\bR\vexactOutput\x12\x16\n" +
+	"\x06amount\x18\x04 \x01(\tR\x06amount\x12/\n" +
+	"\x14sqrt_price_limit_x96\x18\x05 \x01(\tR\x11sqrtPriceLimitX96\"\xca\x02\n" +
+	"\rQuoteResponse\x12\x14\n" +
+	"\x05block\x18\x01 \x01(\x04R\x05block\x12\x1b\n" +
+	"\tamount_in\x18\x02 \x01(\tR\bamountIn\x12\x1d\n" +
+	"\n" +
+	"amount_out\x18\x03 \x01(\tR\tamountOut\x12\x18\n" +
+	"\aamount0\x18\x04 \x01(\tR\aamount0\x12\x18\n" +
+	"\aamount1\x18\x05 \x01(\tR\aamount1\x12/\n" +
+	"\x14sqrt_price_x96_after\x18\x06 \x01(\tR\x11sqrtPriceX96After\x12\x1d\n" +
+	"\n" +
+	"tick_after\x18\a \x01(\x05R\ttickAfter\x12'\n" +
+	"\x0fliquidity_after\x18\b \x01(\tR\x0eliquidityAfter\x12:\n" +
+	"\x19initialized_ticks_crossed\x18\t \x01(\rR\x17initializedTicksCrossed\"\xb1\x03\n" +
+	"\x06Action\x12+\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x17.univ3sim.v1.ActionTypeR\x04type\x12\x12\n" +
+	"\x04pool\x18\x02 \x01(\tR\x04pool\x12 \n" +
+	"\fzero_for_one\x18\x03 \x01(\bR\n" +
+	"zeroForOne\x12!\n" +
+	"\fexact_output\x18\x04 \x01(\bR\vexactOutput\x12\x16\n" +
+	"\x06amount\x18\x05 \x01(\tR\x06amount\x12/\n" +
+	"\x14sqrt_price_limit_x96\x18\x06 \x01(\tR\x11sqrtPriceLimitX96\x12\x14\n" +
+	"\x05owner\x18\a \x01(\tR\x05owner\x12\x1d\n" +
+	"\n" +
+	"tick_lower\x18\b \x01(\x05R\ttickLower\x12\x1d\n" +
+	"\n" +
+	"tick_upper\x18\t \x01(\x05R\ttickUpper\x12+\n" +
+	"\x11amount0_requested\x18\n" +
+	" \x01(\tR\x10amount0Requested\x12+\n" +
+	"\x11amount1_requested\x18\v \x01(\tR\x10amount1Requested\x12\x14\n" +
+	"\x05paid0\x18\f \x01(\tR\x05paid0\x12\x14\n" +
+	"\x05paid1\x18\r \x01(\tR\x05paid1\"E\n" +
+	"\x14SimulateBatchRequest\x12-\n" +
+	"\aactions\x18\x01 \x03(\v2\x13.univ3sim.v1.ActionR\aactions\"v\n" +
+	"\fActionResult\x12\x18\n" +
+	"\aamount0\x18\x01 \x01(\tR\aamount0\x12\x18\n" +
+	"\aamount1\x18\x02 \x01(\tR\aamount1\x12\x1a\n" +
+	"\breverted\x18\x03 \x01(\bR\breverted\x12\x16\n" +
+	"\x06revert\x18\x04 \x01(\tR\x06revert\"\xac\x01\n" +
+	"\x15SimulateBatchResponse\x12\x14\n" +
+	"\x05block\x18\x01 \x01(\x04R\x05block\x123\n" +
+	"\aresults\x18\x02 \x03(\v2\x19.univ3sim.v1.ActionResultR\aresults\x12,\n" +
+	"\x05pools\x18\x03 \x03(\v2\x16.univ3sim.v1.PoolStateR\x05pools\x12\x1a\n" +
+	"\breverted\x18\x04 \x01(\bR\breverted\"L\n" +
+	"\x18StreamPoolUpdatesRequest\x12\x14\n" +
+	"\x05pools\x18\x01 \x03(\tR\x05pools\x12\x1a\n" +
+	"\bsnapshot\x18\x02 \x01(\bR\bsnapshot\"T\n" +
+	"\n" +
+	"TickChange\x12\x1d\n" +
+	"\n" +
+	"tick_index\x18\x01 \x01(\x05R\ttickIndex\x12'\n" +
+	"\x05after\x18\x02 \x01(\v2\x11.univ3sim.v1.TickR\x05after\"\x91\x01\n" +
+	"\x0ePositionChange\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\x12\x1d\n" +
+	"\n" +
+	"tick_lower\x18\x02 \x01(\x05R\ttickLower\x12\x1d\n" +
+	"\n" +
+	"tick_upper\x18\x03 \x01(\x05R\ttickUpper\x12+\n" +
+	"\x05after\x18\x04 \x01(\v2\x15.univ3sim.v1.PositionR\x05after\"\x85\x03\n" +
+	"\tPoolEvent\x12\x14\n" +
+	"\x05event\x18\x01 \x01(\tR\x05event\x12\x17\n" +
+	"\atx_hash\x18\x02 \x01(\tR\x06txHash\x12\x1b\n" +
+	"\tlog_index\x18\x03 \x01(\x04R\blogIndex\x12\x14\n" +
+	"\x05block\x18\x04 \x01(\x04R\x05block\x12*\n" +
+	"\x06before\x18\x05 \x01(\v2\x12.univ3sim.v1.Slot0R\x06before\x12)\n" +
+	"\x10liquidity_before\x18\x06 \x01(\tR\x0fliquidityBefore\x12\x14\n" +
+	"\x05owner\x18\a \x01(\tR\x05owner\x12:\n" +
+	"\x06params\x18\b \x03(\v2\".univ3sim.v1.PoolEvent.ParamsEntryR\x06params\x12\x18\n" +
+	"\aamount0\x18\t \x01(\tR\aamount0\x12\x18\n" +
+	"\aamount1\x18\n" +
+	" \x01(\tR\aamount1\x1a9\n" +
+	"\vParamsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa0\x02\n" +
+	"\n" +
+	"PoolUpdate\x12\x12\n" +
+	"\x04pool\x18\x01 \x01(\tR\x04pool\x128\n" +
+	"\bsnapshot\x18\x02 \x01(\v2\x1c.univ3sim.v1.GetPoolResponseR\bsnapshot\x12,\n" +
+	"\x05event\x18\x03 \x01(\v2\x16.univ3sim.v1.PoolEventR\x05event\x12,\n" +
+	"\x05state\x18\x04 \x01(\v2\x16.univ3sim.v1.PoolStateR\x05state\x12-\n" +
+	"\x05ticks\x18\x05 \x03(\v2\x17.univ3sim.v1.TickChangeR\x05ticks\x129\n" +
+	"\tpositions\x18\x06 \x03(\v2\x1b.univ3sim.v1.PositionChangeR\tpositions*\x9b\x01\n" +
+	"\n" +
+	"ActionType\x12\x1b\n" +
+	"\x17ACTION_TYPE_UNSPECIFIED\x10\x00\x12\x14\n" +
+	"\x10ACTION_TYPE_SWAP\x10\x01\x12\x14\n" +
+	"\x10ACTION_TYPE_MINT\x10\x02\x12\x14\n" +
+	"\x10ACTION_TYPE_BURN\x10\x03\x12\x17\n" +
+	"\x13ACTION_TYPE_COLLECT\x10\x04\x12\x15\n" +
+	"\x11ACTION_TYPE_FLASH\x10\x052\xc0\x02\n" +
+	"\tSimulator\x12D\n" +
+	"\aGetPool\x12\x1b.univ3sim.v1.GetPoolRequest\x1a\x1c.univ3sim.v1.GetPoolResponse\x12>\n" +
+	"\x05Quote\x12\x19.univ3sim.v1.QuoteRequest\x1a\x1a.univ3sim.v1.QuoteResponse\x12V\n" +
+	"\rSimulateBatch\x12!.univ3sim.v1.SimulateBatchRequest\x1a\".univ3sim.v1.SimulateBatchResponse\x12U\n" +
+	"\x11StreamPoolUpdates\x12%.univ3sim.v1.StreamPoolUpdatesRequest\x1a\x17.univ3sim.v1.PoolUpdate0\x01B8Z6github.com/CoinSummer/uniswap-v3-simulator/simulatorpbb\x06proto3"
+
+var (
+	file_simulator_proto_rawDescOnce sync.Once
+	file_simulator_proto_rawDescData []byte
+)
+
+func file_simulator_proto_rawDescGZIP() []byte {
+	file_simulator_proto_rawDescOnce.Do(func() {
+		file_simulator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_simulator_proto_rawDesc), len(file_simulator_proto_rawDesc)))
+	})
+	return file_simulator_proto_rawDescData
+}
+
+var file_simulator_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_simulator_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_simulator_proto_goTypes = []any{
+	(ActionType)(0),                  // 0: univ3sim.v1.ActionType
+	(*Slot0)(nil),                    // 1: univ3sim.v1.Slot0
+	(*PoolState)(nil),                // 2: univ3sim.v1.PoolState
+	(*Tick)(nil),                     // 3: univ3sim.v1.Tick
+	(*Position)(nil),                 // 4: univ3sim.v1.Position
+	(*GetPoolRequest)(nil),           // 5: univ3sim.v1.GetPoolRequest
+	(*GetPoolResponse)(nil),          // 6: univ3sim.v1.GetPoolResponse
+	(*QuoteRequest)(nil),             // 7: univ3sim.v1.QuoteRequest
+	(*QuoteResponse)(nil),            // 8: univ3sim.v1.QuoteResponse
+	(*Action)(nil),                   // 9: univ3sim.v1.Action
+	(*SimulateBatchRequest)(nil),     // 10: univ3sim.v1.SimulateBatchRequest
+	(*ActionResult)(nil),             // 11: univ3sim.v1.ActionResult
+	(*SimulateBatchResponse)(nil),    // 12: univ3sim.v1.SimulateBatchResponse
+	(*StreamPoolUpdatesRequest)(nil), // 13: univ3sim.v1.StreamPoolUpdatesRequest
+	(*TickChange)(nil),               // 14: univ3sim.v1.TickChange
+	(*PositionChange)(nil),           // 15: univ3sim.v1.PositionChange
+	(*PoolEvent)(nil),                // 16: univ3sim.v1.PoolEvent
+	(*PoolUpdate)(nil),               // 17: univ3sim.v1.PoolUpdate
+	nil,                              // 18: univ3sim.v1.PoolEvent.ParamsEntry
+}
+var file_simulator_proto_depIdxs = []int32{
+	1,  // 0: univ3sim.v1.PoolState.slot0:type_name -> univ3sim.v1.Slot0
+	2,  // 1: univ3sim.v1.GetPoolResponse.state:type_name -> univ3sim.v1.PoolState
+	3,  // 2: univ3sim.v1.GetPoolResponse.ticks:type_name -> univ3sim.v1.Tick
+	4,  // 3: univ3sim.v1.GetPoolResponse.positions:type_name -> univ3sim.v1.Position
+	0,  // 4: univ3sim.v1.Action.type:type_name -> univ3sim.v1.ActionType
+	9,  // 5: univ3sim.v1.SimulateBatchRequest.actions:type_name -> univ3sim.v1.Action
+	11, // 6: univ3sim.v1.SimulateBatchResponse.results:type_name -> univ3sim.v1.ActionResult
+	2,  // 7: univ3sim.v1.SimulateBatchResponse.pools:type_name -> univ3sim.v1.PoolState
+	3,  // 8: univ3sim.v1.TickChange.after:type_name -> univ3sim.v1.Tick
+	4,  // 9: univ3sim.v1.PositionChange.after:type_name -> univ3sim.v1.Position
+	1,  // 10: univ3sim.v1.PoolEvent.before:type_name -> univ3sim.v1.Slot0
+	18, // 11: univ3sim.v1.PoolEvent.params:type_name -> univ3sim.v1.PoolEvent.ParamsEntry
+	6,  // 12: univ3sim.v1.PoolUpdate.snapshot:type_name -> univ3sim.v1.GetPoolResponse
+	16, // 13: univ3sim.v1.PoolUpdate.event:type_name -> univ3sim.v1.PoolEvent
+	2,  // 14: univ3sim.v1.PoolUpdate.state:type_name -> univ3sim.v1.PoolState
+	14, // 15: univ3sim.v1.PoolUpdate.ticks:type_name -> univ3sim.v1.TickChange
+	15, // 16: univ3sim.v1.PoolUpdate.positions:type_name -> univ3sim.v1.PositionChange
+	5,  // 17: univ3sim.v1.Simulator.GetPool:input_type -> univ3sim.v1.GetPoolRequest
+	7,  // 18: univ3sim.v1.Simulator.Quote:input_type -> univ3sim.v1.QuoteRequest
+	10, // 19: univ3sim.v1.Simulator.SimulateBatch:input_type -> univ3sim.v1.SimulateBatchRequest
+	13, // 20: univ3sim.v1.Simulator.StreamPoolUpdates:input_type -> univ3sim.v1.StreamPoolUpdatesRequest
+	6,  // 21: univ3sim.v1.Simulator.GetPool:output_type -> univ3sim.v1.GetPoolResponse
+	8,  // 22: univ3sim.v1.Simulator.Quote:output_type -> univ3sim.v1.QuoteResponse
+	12, // 23: univ3sim.v1.Simulator.SimulateBatch:output_type -> univ3sim.v1.SimulateBatchResponse
+	17, // 24: univ3sim.v1.Simulator.StreamPoolUpdates:output_type -> univ3sim.v1.PoolUpdate
+	21, // [21:25] is the sub-list for method output_type
+	17, // [17:21] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
+}
+
+func init() { file_simulator_proto_init() }
+func file_simulator_proto_init() {
+	if File_simulator_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_simulator_proto_rawDesc), len(file_simulator_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_simulator_proto_goTypes,
+		DependencyIndexes: file_simulator_proto_depIdxs,
+		EnumInfos:         file_simulator_proto_enumTypes,
+		MessageInfos:      file_simulator_proto_msgTypes,
+	}.Build()
+	File_simulator_proto = out.File
+	file_simulator_proto_goTypes = nil
+	file_simulator_proto_depIdxs = nil
+}
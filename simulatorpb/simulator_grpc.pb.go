@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: simulator.proto
+
+package simulatorpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Simulator_GetPool_FullMethodName           = "/univ3sim.v1.Simulator/GetPool"
+	Simulator_Quote_FullMethodName             = "/univ3sim.v1.Simulator/Quote"
+	Simulator_SimulateBatch_FullMethodName     = "/univ3sim.v1.Simulator/SimulateBatch"
+	Simulator_StreamPoolUpdates_FullMethodName = "/univ3sim.v1.Simulator/StreamPoolUpdates"
+)
+
+// SimulatorClient is the client API for Simulator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// 与HTTP接口相同的能力, 供内部低延迟调用.
+// 地址为0x开头的hex字符串, uint256/int256数值为十进制字符串
+type SimulatorClient interface {
+	GetPool(ctx context.Context, in *GetPoolRequest, opts ...grpc.CallOption) (*GetPoolResponse, error)
+	Quote(ctx context.Context, in *QuoteRequest, opts ...grpc.CallOption) (*QuoteResponse, error)
+	// 在临时fork上原子地执行一组操作, 不影响同步的状态. 有操作revert时整个bundle回滚
+	SimulateBatch(ctx context.Context, in *SimulateBatchRequest, opts ...grpc.CallOption) (*SimulateBatchResponse, error)
+	// 同步应用的每个事件. snapshot为true时先发送pool的完整状态, 之后的更新带tick/position变化,
+	// 可以在客户端维护一份副本. 消费过慢时以RESOURCE_EXHAUSTED结束, 客户端需要重新订阅
+	StreamPoolUpdates(ctx context.Context, in *StreamPoolUpdatesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PoolUpdate], error)
+}
+
+type simulatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSimulatorClient(cc grpc.ClientConnInterface) SimulatorClient {
+	return &simulatorClient{cc}
+}
+
+func (c *simulatorClient) GetPool(ctx context.Context, in *GetPoolRequest, opts ...grpc.CallOption) (*GetPoolResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetPoolResponse)
+	err := c.cc.Invoke(ctx, Simulator_GetPool_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simulatorClient) Quote(ctx context.Context, in *QuoteRequest, opts ...grpc.CallOption) (*QuoteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QuoteResponse)
+	err := c.cc.Invoke(ctx, Simulator_Quote_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simulatorClient) SimulateBatch(ctx context.Context, in *SimulateBatchRequest, opts ...grpc.CallOption) (*SimulateBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SimulateBatchResponse)
+	err := c.cc.Invoke(ctx, Simulator_SimulateBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simulatorClient) StreamPoolUpdates(ctx context.Context, in *StreamPoolUpdatesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PoolUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Simulator_ServiceDesc.Streams[0], Simulator_StreamPoolUpdates_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamPoolUpdatesRequest, PoolUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Simulator_StreamPoolUpdatesClient = grpc.ServerStreamingClient[PoolUpdate]
+
+// SimulatorServer is the server API for Simulator service.
+// All implementations must embed UnimplementedSimulatorServer
+// for forward compatibility.
+//
+// 与HTTP接口相同的能力, 供内部低延迟调用.
+// 地址为0x开头的hex字符串, uint256/int256数值为十进制字符串
+type SimulatorServer interface {
+	GetPool(context.Context, *GetPoolRequest) (*GetPoolResponse, error)
+	Quote(context.Context, *QuoteRequest) (*QuoteResponse, error)
+	// 在临时fork上原子地执行一组操作, 不影响同步的状态. 有操作revert时整个bundle回滚
+	SimulateBatch(context.Context, *SimulateBatchRequest) (*SimulateBatchResponse, error)
+	// 同步应用的每个事件. snapshot为true时先发送pool的完整状态, 之后的更新带tick/position变化,
+	// 可以在客户端维护一份副本. 消费过慢时以RESOURCE_EXHAUSTED结束, 客户端需要重新订阅
+	StreamPoolUpdates(*StreamPoolUpdatesRequest, grpc.ServerStreamingServer[PoolUpdate]) error
+	mustEmbedUnimplementedSimulatorServer()
+}
+
+// UnimplementedSimulatorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSimulatorServer struct{}
+
+func (UnimplementedSimulatorServer) GetPool(context.Context, *GetPoolRequest) (*GetPoolResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPool not implemented")
+}
+func (UnimplementedSimulatorServer) Quote(context.Context, *QuoteRequest) (*QuoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Quote not implemented")
+}
+func (UnimplementedSimulatorServer) SimulateBatch(context.Context, *SimulateBatchRequest) (*SimulateBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SimulateBatch not implemented")
+}
+func (UnimplementedSimulatorServer) StreamPoolUpdates(*StreamPoolUpdatesRequest, grpc.ServerStreamingServer[PoolUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPoolUpdates not implemented")
+}
+func (UnimplementedSimulatorServer) mustEmbedUnimplementedSimulatorServer() {}
+func (UnimplementedSimulatorServer) testEmbeddedByValue()                   {}
+
+// UnsafeSimulatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SimulatorServer will
+// result in compilation errors.
+type UnsafeSimulatorServer interface {
+	mustEmbedUnimplementedSimulatorServer()
+}
+
+func RegisterSimulatorServer(s grpc.ServiceRegistrar, srv SimulatorServer) {
+	// If the following call pancis, it indicates UnimplementedSimulatorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Simulator_ServiceDesc, srv)
+}
+
+func _Simulator_GetPool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPoolRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimulatorServer).GetPool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Simulator_GetPool_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimulatorServer).GetPool(ctx, req.(*GetPoolRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Simulator_Quote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimulatorServer).Quote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Simulator_Quote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimulatorServer).Quote(ctx, req.(*QuoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Simulator_SimulateBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SimulateBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimulatorServer).SimulateBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Simulator_SimulateBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimulatorServer).SimulateBatch(ctx, req.(*SimulateBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Simulator_StreamPoolUpdates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamPoolUpdatesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SimulatorServer).StreamPoolUpdates(m, &grpc.GenericServerStream[StreamPoolUpdatesRequest, PoolUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Simulator_StreamPoolUpdatesServer = grpc.ServerStreamingServer[PoolUpdate]
+
+// Simulator_ServiceDesc is the grpc.ServiceDesc for Simulator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Simulator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "univ3sim.v1.Simulator",
+	HandlerType: (*SimulatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPool",
+			Handler:    _Simulator_GetPool_Handler,
+		},
+		{
+			MethodName: "Quote",
+			Handler:    _Simulator_Quote_Handler,
+		},
+		{
+			MethodName: "SimulateBatch",
+			Handler:    _Simulator_SimulateBatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPoolUpdates",
+			Handler:       _Simulator_StreamPoolUpdates_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "simulator.proto",
+}
@@ -3,6 +3,7 @@ package uniswap_v3_simulator
 import (
 	"fmt"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 	"math/big"
 	"strconv"
 )
@@ -128,8 +129,7 @@ func HumanPrice2SqrtRatioX96(price float64, decimals0, decimals1 int) (*big.Int,
 	valueBigFloat.Mul(valueBigFloat, new(big.Float).SetInt(twoToDecimals1))
 	valueBigFloat.Int(result)
 
-	fmt.Printf("%v\n", valueBigFloat.String())
-	fmt.Printf("%v\n", result.String())
+	logrus.Debugf("price %s, scaled %s", valueBigFloat.String(), result.String())
 
 	numerator := new(big.Int).Mul(result, twoTo192)
 	denominator := new(big.Int).Mul(twoToDecimals0, big.NewInt(1))
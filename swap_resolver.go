@@ -0,0 +1,262 @@
+package uniswap_v3_simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// swap事件输入参数的解析方式
+type SwapResolveMode int
+
+const (
+	// 用事件结果尝试候选输入参数, 全部失败时交给ApplyPolicy.OnUnresolvedSwap
+	SwapResolveDryRun SwapResolveMode = iota
+	// 先从CallSource解码产生事件的pool.swap调用, 再尝试候选输入参数,
+	// 都失败时直接把事件中的价格/流动性/tick写入pool, 不会放弃任何pool
+	SwapResolveCalldata
+)
+
+// 记录中swap的解析方式
+const (
+	swapResolvedByCalldata    = "calldata"
+	swapResolvedByDryRun      = "dry_run"
+	swapResolvedByState       = "state"
+	swapResolvedByStateApprox = "state_approximate" // 没能计算手续费增长和tick穿越, pool只是近似的
+	swapUnresolved            = "unresolved"        // 只用于指标
+)
+
+var ErrSwapCallNotFound = errors.New("swap call not found in transaction")
+
+// 交易中的一次合约调用
+type TxCall struct {
+	To    common.Address `json:"to"`
+	Input hexutil.Bytes  `json:"input"`
+}
+
+// 按执行顺序返回交易中所有成功的调用(包含内部调用)
+type CallSource interface {
+	TxCalls(ctx context.Context, txHash common.Hash) ([]TxCall, error)
+}
+
+// pool.swap的调用参数
+type SwapInput struct {
+	ZeroForOne        bool
+	AmountSpecified   decimal.Decimal
+	SqrtPriceLimitX96 decimal.Decimal
+}
+
+var swapMethod = func() abi.Method {
+	a, err := abi.JSON(strings.NewReader(ABI))
+	if err != nil {
+		panic(err)
+	}
+	return a.Methods["swap"]
+}()
+
+func decodeSwapCall(input []byte) (*SwapInput, error) {
+	if len(input) < 4 || !bytes.Equal(input[:4], swapMethod.ID) {
+		return nil, fmt.Errorf("not a swap call")
+	}
+	args, err := swapMethod.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, err
+	}
+	zeroForOne, ok := args[1].(bool)
+	if !ok {
+		return nil, fmt.Errorf("decode swap call err zeroForOne not a bool")
+	}
+	amountSpecified, ok := args[2].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("decode swap call err amountSpecified not a int")
+	}
+	sqrtPriceLimitX96, ok := args[3].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("decode swap call err sqrtPriceLimitX96 not a int")
+	}
+	return &SwapInput{
+		ZeroForOne:        zeroForOne,
+		AmountSpecified:   decimal.NewFromBigInt(amountSpecified, 0),
+		SqrtPriceLimitX96: decimal.NewFromBigInt(sqrtPriceLimitX96, 0),
+	}, nil
+}
+
+// 交易中对pool的第ordinal次swap调用, 和pool在该交易中的第ordinal个Swap事件对应
+func ResolveSwapInput(ctx context.Context, source CallSource, log *types.Log, ordinal int) (*SwapInput, error) {
+	calls, err := source.TxCalls(ctx, log.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, call := range calls {
+		if call.To != log.Address || len(call.Input) < 4 || !bytes.Equal(call.Input[:4], swapMethod.ID) {
+			continue
+		}
+		if n == ordinal {
+			return decodeSwapCall(call.Input)
+		}
+		n++
+	}
+	return nil, fmt.Errorf("%w: tx %s pool %s #%d", ErrSwapCallNotFound, log.TxHash, log.Address, ordinal)
+}
+
+type callFrame struct {
+	To    common.Address `json:"to"`
+	Input hexutil.Bytes  `json:"input"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// 出错的调用及其内部调用都被回滚, 不会产生事件
+func flattenCallFrame(frame *callFrame, calls []TxCall) []TxCall {
+	if frame.Error != "" {
+		return calls
+	}
+	calls = append(calls, TxCall{To: frame.To, Input: frame.Input})
+	for i := range frame.Calls {
+		calls = flattenCallFrame(&frame.Calls[i], calls)
+	}
+	return calls
+}
+
+// 通过debug_traceTransaction(callTracer)获取内部调用, 需要节点开启debug接口.
+// 同一个交易中通常有多个swap, 缓存最近一次的结果
+type TraceCallSource struct {
+	client *rpc.Client
+	lock   sync.Mutex
+	txHash common.Hash
+	calls  []TxCall
+}
+
+func NewTraceCallSource(client *rpc.Client) *TraceCallSource {
+	return &TraceCallSource{client: client}
+}
+
+func (s *TraceCallSource) TxCalls(ctx context.Context, txHash common.Hash) ([]TxCall, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.calls != nil && s.txHash == txHash {
+		return s.calls, nil
+	}
+	var frame callFrame
+	err := s.client.CallContext(ctx, &frame, "debug_traceTransaction", txHash, map[string]interface{}{"tracer": "callTracer"})
+	if err != nil {
+		return nil, err
+	}
+	s.txHash = txHash
+	s.calls = flattenCallFrame(&frame, nil)
+	return s.calls, nil
+}
+
+// 本地的调用数据, 用于测试和没有debug接口的节点
+type FixtureCallSource struct {
+	Calls map[common.Hash][]TxCall `json:"calls"`
+}
+
+func NewFixtureCallSource() *FixtureCallSource {
+	return &FixtureCallSource{Calls: map[common.Hash][]TxCall{}}
+}
+
+// 从json文件加载, 格式为 {"calls": {"<tx hash>": [{"to": "...", "input": "0x..."}]}}
+func LoadFixtureCallSource(path string) (*FixtureCallSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	source := NewFixtureCallSource()
+	err = json.Unmarshal(data, source)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (s *FixtureCallSource) Add(txHash common.Hash, calls ...TxCall) {
+	s.Calls[txHash] = append(s.Calls[txHash], calls...)
+}
+
+func (s *FixtureCallSource) TxCalls(ctx context.Context, txHash common.Hash) ([]TxCall, error) {
+	calls, ok := s.Calls[txHash]
+	if !ok {
+		return nil, fmt.Errorf("%w: no fixture for tx %s", ErrSwapCallNotFound, txHash)
+	}
+	return calls, nil
+}
+
+// 使用Simulator的rpc节点的TraceCallSource
+func (pm *Simulator) TraceCallSource() *TraceCallSource {
+	return NewTraceCallSource(pm.rpc.Client())
+}
+
+// 检查输入参数是否能得到和事件一致的结果
+func (p *CorePool) matchSwapResult(swap *UniV3SwapEvent, zeroForOne bool, amountSpecified decimal.Decimal, sqrtPriceLimitX96 *decimal.Decimal) bool {
+	amount0, amount1, sqrtPriceX96, err := p.HandleSwap(zeroForOne, amountSpecified, sqrtPriceLimitX96, true)
+	return err == nil && amount0.Equal(swap.Amount0) && amount1.Equal(swap.Amount1) && sqrtPriceX96.Equal(swap.SqrtPriceX96)
+}
+
+// 无法得到swap输入参数时, 直接把事件中swap之后的价格/流动性/tick写入pool.
+// 先以事件价格为限价、输入数量为amountSpecified在分叉上执行swap, 计算穿过tick时的
+// feeGrowthOutside和feeGrowthGlobal; 失败或结果和事件的价格/tick/流动性不一致时
+// 只写入价格/流动性/tick, 手续费增长丢失, 返回false
+func (p *CorePool) ApplySwapResult(swap *UniV3SwapEvent) (bool, error) {
+	tick := 0
+	if swap.Tick != nil {
+		tick = *swap.Tick
+	} else {
+		var err error
+		tick, err = GetTickAtSqrtRatio(swap.SqrtPriceX96)
+		if err != nil {
+			return false, err
+		}
+	}
+	zeroForOne := swap.Amount0.IsPositive()
+	amountIn := swap.Amount1
+	if zeroForOne {
+		amountIn = swap.Amount0
+	}
+	exact := true
+	if amountIn.IsPositive() && !swap.SqrtPriceX96.Equal(p.SqrtPriceX96) {
+		// 试算在带撤销日志的fork上执行, 日志中的tick即为被修改的tick
+		trial := p.Fork()
+		trial.Checkpoint()
+		_, _, _, err := trial.HandleSwap(zeroForOne, amountIn, &swap.SqrtPriceX96, false)
+		if err == nil && !(trial.SqrtPriceX96.Equal(swap.SqrtPriceX96) && trial.TickCurrent == tick && trial.Liquidity.Equal(swap.Liquidity)) {
+			err = fmt.Errorf("trial swap reached price %s tick %d liquidity %s, event has %s %d %s",
+				trial.SqrtPriceX96, trial.TickCurrent, trial.Liquidity, swap.SqrtPriceX96, tick, swap.Liquidity)
+		}
+		if err == nil {
+			// 通过Set/Clear写回修改的tick, 保留p自己的撤销日志
+			for _, index := range trial.journal.tickIndexes() {
+				if t, ok := trial.TickManager.getTick(index); ok {
+					p.TickManager.Set(t.Clone())
+				} else {
+					p.TickManager.Clear(index)
+				}
+			}
+			p.FeeGrowthGlobal0X128 = trial.FeeGrowthGlobal0X128
+			p.FeeGrowthGlobal1X128 = trial.FeeGrowthGlobal1X128
+		} else {
+			logrus.Warnf("failed trial swap for pool %s, fee growth and tick crossings are lost: %s", p.PoolAddress, err)
+			exact = false
+		}
+	}
+	p.touch()
+	p.SqrtPriceX96 = swap.SqrtPriceX96
+	p.Liquidity = swap.Liquidity
+	p.TickCurrent = tick
+	return exact, nil
+}
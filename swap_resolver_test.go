@@ -0,0 +1,142 @@
+package uniswap_v3_simulator
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSwapCall(t *testing.T, pool common.Address, zeroForOne bool, amountSpecified, sqrtPriceLimitX96 decimal.Decimal) TxCall {
+	args, err := swapMethod.Inputs.Pack(common.HexToAddress("0x1111111111111111111111111111111111111111"), zeroForOne, amountSpecified.BigInt(), sqrtPriceLimitX96.BigInt(), []byte{})
+	assert.NoError(t, err)
+	return TxCall{To: pool, Input: append(append([]byte{}, swapMethod.ID...), args...)}
+}
+
+func TestEventApplier_ResolveSwapFromCalldata(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+
+	owner := "0x1111111111111111111111111111111111111111"
+	amountIn := decimal.NewFromInt(1e15)
+	swap := testSwapLog(t, pool, owner, true, amountIn, 11, 0)
+	source := NewFixtureCallSource()
+	limit := MIN_SQRT_RATIO.Add(ONE)
+	router := common.HexToAddress("0xE592427A0AEce92De3Edee1F18E0157C05861564")
+	// 第一个调用是router, 第二个是其它pool的swap
+	source.Add(swap.TxHash,
+		TxCall{To: router, Input: []byte{1, 2, 3, 4}},
+		testSwapCall(t, common.HexToAddress("0x2222222222222222222222222222222222222222"), false, amountIn, limit),
+		testSwapCall(t, addr, true, amountIn, limit),
+	)
+	fixture := filepath.Join(t.TempDir(), "calls.json")
+	assert.NoError(t, writeFile(fixture, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(source)
+	}))
+	loaded, err := LoadFixtureCallSource(fixture)
+	assert.NoError(t, err)
+
+	pm.SwapResolveMode = SwapResolveCalldata
+	pm.CallSource = loaded
+	assert.NoError(t, pm.HandleLogs([]types.Log{swap}))
+	assert.Len(t, pm.pendingRecords, 1)
+	assert.Equal(t, swapResolvedByCalldata, pm.pendingRecords[0].Params["resolved_by"])
+	assert.Equal(t, amountIn.String(), pm.pendingRecords[0].Params["amount_specified"])
+}
+
+func TestEventApplier_ApplySwapResultFallback(t *testing.T) {
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	owner := "0x1111111111111111111111111111111111111111"
+	// 事件来自流动性不同的pool, 任何候选输入参数都无法得到相同的结果
+	deeper := pool.Clone()
+	_, _, err := deeper.Mint(owner, -600, 600, decimal.NewFromInt(3e18))
+	assert.NoError(t, err)
+	swap := testSwapLog(t, deeper, owner, true, decimal.NewFromInt(1e16), 11, 0)
+	parsed, err := parseUniv3SwapEvent(&swap)
+	assert.NoError(t, err)
+	assert.NotNil(t, parsed.Tick)
+	assert.Negative(t, *parsed.Tick)
+
+	pm := newTestSimulator(t, "")
+	pm.Pools[addr] = pool.Clone()
+	assert.NoError(t, pm.HandleLogs([]types.Log{swap}))
+	assert.True(t, pm.Quarantine.Quarantined(addr))
+
+	pm = newTestSimulator(t, "")
+	pm.Pools[addr] = pool.Clone()
+	pm.SwapResolveMode = SwapResolveCalldata
+	assert.NoError(t, pm.HandleLogs([]types.Log{swap}))
+	assert.False(t, pm.Quarantine.Quarantined(addr))
+	applied := pm.Pools[addr]
+	assert.True(t, applied.SqrtPriceX96.Equal(parsed.SqrtPriceX96))
+	assert.True(t, applied.Liquidity.Equal(parsed.Liquidity))
+	assert.Equal(t, *parsed.Tick, applied.TickCurrent)
+	// 试算swap的流动性和事件不一致, 手续费增长不可信
+	assert.True(t, applied.FeeGrowthGlobal0X128.Equal(pool.FeeGrowthGlobal0X128))
+	assert.Equal(t, swapResolvedByStateApprox, pm.pendingRecords[0].Params["resolved_by"])
+}
+
+func TestEventApplier_ApplySwapResultExact(t *testing.T) {
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	owner := "0x1111111111111111111111111111111111111111"
+	// 输入比实际多1, 候选参数都得不到相同的数量, 但以事件价格为限价的试算和事件一致
+	swap := testSwapLog(t, pool, owner, true, decimal.NewFromInt(1e16), 11, 0)
+	parsed, err := parseUniv3SwapEvent(&swap)
+	assert.NoError(t, err)
+	copy(swap.Data[:32], word(parsed.Amount0.Add(ONE)))
+
+	pm := newTestSimulator(t, "")
+	pm.Pools[addr] = pool.Clone()
+	pm.SwapResolveMode = SwapResolveCalldata
+	assert.NoError(t, pm.HandleLogs([]types.Log{swap}))
+	applied := pm.Pools[addr]
+	assert.True(t, applied.SqrtPriceX96.Equal(parsed.SqrtPriceX96))
+	assert.True(t, applied.FeeGrowthGlobal0X128.GreaterThan(pool.FeeGrowthGlobal0X128))
+	assert.Equal(t, swapResolvedByState, pm.pendingRecords[0].Params["resolved_by"])
+}
+
+func TestCorePool_ApplySwapResultApproximate(t *testing.T) {
+	pool := newTestPool(t)
+	before := pool.Clone()
+	// token0输入但价格上升, 试算swap的限价不合法
+	higher := pool.SqrtPriceX96.Mul(decimal.NewFromFloat(1.01)).RoundDown(0)
+	swap := &UniV3SwapEvent{Amount0: decimal.NewFromInt(1e16), Amount1: decimal.NewFromInt(-1e16), SqrtPriceX96: higher, Liquidity: pool.Liquidity}
+	exact, err := pool.ApplySwapResult(swap)
+	assert.NoError(t, err)
+	assert.False(t, exact)
+	assert.True(t, pool.SqrtPriceX96.Equal(higher))
+	assert.True(t, pool.FeeGrowthGlobal0X128.Equal(before.FeeGrowthGlobal0X128))
+}
+
+func TestEventApplier_SwapOrdinalAfterParseFailure(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	pm.Pools[addr] = pool
+
+	owner := "0x1111111111111111111111111111111111111111"
+	amountIn := decimal.NewFromInt(1e15)
+	swap := testSwapLog(t, pool, owner, true, amountIn, 11, 1)
+	// 同一交易中前一个swap事件解析失败, 仍然对应第一个swap调用
+	broken := types.Log{Address: addr, Topics: swap.Topics, Data: []byte{1}, BlockNumber: 11, TxHash: swap.TxHash, Index: 0}
+	limit := MIN_SQRT_RATIO.Add(ONE)
+	source := NewFixtureCallSource()
+	source.Add(swap.TxHash,
+		testSwapCall(t, addr, true, amountIn.Mul(decimal.NewFromInt(2)), limit),
+		testSwapCall(t, addr, true, amountIn, limit),
+	)
+	pm.SwapResolveMode = SwapResolveCalldata
+	pm.CallSource = source
+	assert.NoError(t, pm.HandleLogs([]types.Log{broken, swap}))
+	assert.Len(t, pm.pendingRecords, 1)
+	assert.Equal(t, swapResolvedByCalldata, pm.pendingRecords[0].Params["resolved_by"])
+}
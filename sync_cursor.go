@@ -0,0 +1,241 @@
+package uniswap_v3_simulator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const syncCursorID = 1
+
+var ErrInconsistentState = errors.New("db state is not consistent with sync cursor")
+
+// 同步游标, 和pool在同一个事务里提交, 表示数据库完整反映了BlockNum(含)之前的所有事件
+type SyncCursor struct {
+	ID        uint `gorm:"primarykey"`
+	BlockNum  uint64
+	UpdatedAt time.Time
+}
+
+type RecoveryMode int
+
+const (
+	// 只检查, 存在超前于游标的pool时返回ErrInconsistentState
+	RecoveryVerify RecoveryMode = iota
+	// 从部署区块重放超前于游标的pool, 使整个数据库停在游标高度
+	RecoveryRebuild
+)
+
+func loadSyncCursor(db *gorm.DB) (*SyncCursor, error) {
+	var cursor SyncCursor
+	err := db.Where("id = ?", syncCursorID).Limit(1).Find(&cursor).Error
+	if err != nil {
+		return nil, err
+	}
+	if cursor.ID == 0 {
+		return nil, nil
+	}
+	return &cursor, nil
+}
+
+func saveSyncCursor(tx *gorm.DB, blockNum uint64) error {
+	return tx.Save(&SyncCursor{ID: syncCursorID, BlockNum: blockNum}).Error
+}
+
+// 旧版本数据库没有游标表, 每次FlushPools都是完整事务, 所以max(current_block_num)到
+// 最后一次flush之间没有任何事件, 以它作为游标是安全的
+func migrateSyncCursor(db *gorm.DB) (uint64, error) {
+	cursor, err := loadSyncCursor(db)
+	if err != nil {
+		return 0, err
+	}
+	if cursor != nil {
+		return cursor.BlockNum, nil
+	}
+	lastBlock, ok, err := lastPoolBlock(db)
+	if err != nil || !ok {
+		return 0, err
+	}
+	logrus.Infof("migrate sync cursor from pools: %d", lastBlock)
+	err = saveSyncCursor(db, lastBlock)
+	if err != nil {
+		return 0, err
+	}
+	return lastBlock, nil
+}
+
+// 只读打开时不写入游标, 旧数据库使用pool中最大的区块
+func readSyncCursor(db *gorm.DB) (uint64, error) {
+	if db.Migrator().HasTable(&SyncCursor{}) {
+		cursor, err := loadSyncCursor(db)
+		if err != nil {
+			return 0, err
+		}
+		if cursor != nil {
+			return cursor.BlockNum, nil
+		}
+	}
+	lastBlock, _, err := lastPoolBlock(db)
+	return lastBlock, err
+}
+
+// pool中最大的区块, 没有pool时ok为false
+func lastPoolBlock(db *gorm.DB) (uint64, bool, error) {
+	var lastBlock *uint64
+	err := db.Model(&CorePool{}).Select("max(current_block_num) as last_block").Scan(&lastBlock).Error
+	if err != nil {
+		return 0, false, err
+	}
+	if lastBlock == nil {
+		return 0, false, nil
+	}
+	return *lastBlock, true, nil
+}
+
+// 数据库中已提交的同步高度
+func (pm *Simulator) CommittedBlockNum() (uint64, error) {
+	cursor, err := loadSyncCursor(pm.db)
+	if err != nil {
+		return 0, err
+	}
+	if cursor == nil {
+		return 0, nil
+	}
+	return cursor.BlockNum, nil
+}
+
+// 丢弃内存中未提交的变更, 回到数据库中游标对应的状态. 调用方持有lock
+func (pm *Simulator) reloadCommittedState() error {
+	committed, err := pm.CommittedBlockNum()
+	if err != nil {
+		return err
+	}
+	pools, err := loadPools(pm.db)
+	if err != nil {
+		return err
+	}
+	pm.Pools = pools
+	pm.dirtyPools = map[string]*CorePool{}
+	pm.pendingRecords = nil
+	pm.blockTimes = nil
+	pm.checkpoints = nil
+	pm.Quarantine.discard()
+	pm.currentBlock = committed
+	logrus.Warnf("discard uncommitted changes, reload state at block %d", committed)
+	return nil
+}
+
+// 检查数据库中是否有pool超前于同步游标, RecoveryRebuild模式下从部署区块重放这些pool.
+// 重放时不持有lock, 只在替换pool时短暂加锁, 期间可以正常读取和fork
+func (pm *Simulator) Recover(mode RecoveryMode, step uint64) error {
+	pm.syncLock.Lock()
+	defer pm.syncLock.Unlock()
+	committed, ahead, err := pm.poolsAheadOfCursor()
+	if err != nil {
+		return err
+	}
+	if len(ahead) == 0 {
+		return nil
+	}
+	if mode == RecoveryVerify {
+		return fmt.Errorf("%w: %d pools ahead of block %d", ErrInconsistentState, len(ahead), committed)
+	}
+	for _, pool := range ahead {
+		logrus.Infof("rebuild pool %s from block %d to %d", pool.PoolAddress, pool.DeployBlockNum, committed)
+		replayed, err := pm.replayPool(common.HexToAddress(pool.PoolAddress), pool.DeployBlockNum, committed, step, pm.Policy)
+		if err != nil {
+			return err
+		}
+		pm.lock.Lock()
+		pm.installPool(replayed)
+		pm.lock.Unlock()
+	}
+	return pm.FlushPools()
+}
+
+// 和Recover(RecoveryVerify)相同的检查, 只读数据库, 不获取同步锁
+func (pm *Simulator) CheckConsistency() error {
+	committed, ahead, err := pm.poolsAheadOfCursor()
+	if err != nil {
+		return err
+	}
+	if len(ahead) > 0 {
+		return fmt.Errorf("%w: %d pools ahead of block %d", ErrInconsistentState, len(ahead), committed)
+	}
+	return nil
+}
+
+// 数据库中超前于同步游标的pool
+func (pm *Simulator) poolsAheadOfCursor() (uint64, []*CorePool, error) {
+	committed, err := pm.CommittedBlockNum()
+	if err != nil {
+		return 0, nil, err
+	}
+	var ahead []*CorePool
+	err = pm.db.Where("current_block_num > ?", committed).Find(&ahead).Error
+	return committed, ahead, err
+}
+
+// 重放单个pool的结果, 不通知observer
+type replayStore struct {
+	pool    *CorePool
+	records []*Record
+}
+
+func (s *replayStore) Pool(addr common.Address) (*CorePool, bool) {
+	return s.pool, s.pool != nil
+}
+
+func (s *replayStore) AddPool(addr common.Address, pool *CorePool) {
+	s.pool = pool
+}
+
+func (s *replayStore) PoolChanged(pool *CorePool, record *Record) {
+	if record != nil {
+		s.records = append(s.records, record)
+	}
+}
+
+// 重建时重放的是历史事件, observer已经收到过
+func (s *replayStore) EventApplied(event *PoolEvent) {
+}
+
+// 从from开始重放addr的所有事件到to(含), 结果在独立的store中, 不修改Simulator.
+// 调用方持有syncLock, 不持有lock
+func (pm *Simulator) replayPool(addr common.Address, from, to, step uint64, policy ApplyPolicy) (*replayStore, error) {
+	store := &replayStore{}
+	applier := NewEventApplier(pm, store, policy)
+	fetcher := pm.newLogFetcher(step)
+	fetcher.Addresses = []common.Address{addr}
+	err := fetcher.Run(pm.ctx, from, to, func(batch LogBatch) error {
+		return applier.Apply(batch.Logs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if store.pool == nil {
+		return nil, fmt.Errorf("pool %s not initialized in blocks %d - %d", addr, from, to)
+	}
+	return store, nil
+}
+
+// 用重放的结果替换内存中的pool. 调用方持有lock
+func (pm *Simulator) installPool(replayed *replayStore) {
+	pool := replayed.pool
+	addr := common.HexToAddress(pool.PoolAddress)
+	if old, ok := pm.Pools[addr]; ok {
+		// 沿用数据库中的记录, Flush时更新而不是新建
+		pool.Model = old.Model
+		pool.HasCreated = old.HasCreated
+		delete(pm.dirtyPools, old.PoolAddress)
+	}
+	pm.Pools[addr] = pool
+	pm.dirtyPools[pool.PoolAddress] = pool
+	for _, record := range replayed.records {
+		pm.addRecord(record)
+	}
+}
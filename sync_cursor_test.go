@@ -0,0 +1,130 @@
+package uniswap_v3_simulator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSimulator(t *testing.T, dbFile string) *Simulator {
+	if dbFile == "" {
+		dbFile = filepath.Join(t.TempDir(), "simulator.db")
+	}
+	return NewPoolManager(dbFile, "http://127.0.0.1:1", 0)
+}
+
+func TestSimulator_FlushPoolsCommitsCursor(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	pm := newTestSimulator(t, dbFile)
+	pool := newTestPool(t)
+	pool.CurrentBlockNum = 90
+	pm.Pools[common.HexToAddress(pool.PoolAddress)] = pool
+	pm.dirtyPools[pool.PoolAddress] = pool
+	pm.currentBlock = 100
+	assert.NoError(t, pm.FlushPools())
+
+	committed, err := pm.CommittedBlockNum()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), committed)
+
+	reopened := newTestSimulator(t, dbFile)
+	assert.Equal(t, uint64(100), reopened.CurrentBlock())
+	assert.Len(t, reopened.Pools, 1)
+	assert.NoError(t, reopened.Recover(RecoveryVerify, 1000))
+	assert.NoError(t, reopened.CheckConsistency())
+}
+
+func TestSimulator_MigrateLegacyCursor(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	pm := newTestSimulator(t, dbFile)
+	pool := newTestPool(t)
+	pool.CurrentBlockNum = 77
+	assert.NoError(t, pool.Flush(pm.db))
+
+	reopened := newTestSimulator(t, dbFile)
+	assert.Equal(t, uint64(77), reopened.CurrentBlock())
+}
+
+func TestSimulator_RecoverVerifyDetectsPoolAheadOfCursor(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pm.currentBlock = 50
+	assert.NoError(t, pm.FlushPools())
+
+	pool := newTestPool(t)
+	pool.CurrentBlockNum = 60
+	assert.NoError(t, pool.Flush(pm.db))
+
+	err := pm.Recover(RecoveryVerify, 1000)
+	assert.True(t, errors.Is(err, ErrInconsistentState))
+	err = pm.CheckConsistency()
+	assert.True(t, errors.Is(err, ErrInconsistentState))
+}
+
+func TestSimulator_InstallReplayedPool(t *testing.T) {
+	pm := newTestSimulator(t, "")
+	pool := newTestPool(t)
+	addr := common.HexToAddress(pool.PoolAddress)
+	assert.NoError(t, pool.Flush(pm.db))
+	pm.Pools[addr] = pool
+	liquidity := pool.Liquidity
+	var events []*PoolEvent
+	pm.AddObserver(ObserverFunc(func(event *PoolEvent) {
+		events = append(events, event)
+	}))
+
+	// 重放在独立的store中进行, 不修改Simulator也不通知observer
+	store := &replayStore{pool: pool.Fork()}
+	owner := "0x1111111111111111111111111111111111111111"
+	assert.NoError(t, NewEventApplier(pm, store, nil).Apply([]types.Log{testMintLog(addr, owner, -120, 120, decimal.NewFromInt(1e17), 101, 0)}))
+	assert.Len(t, events, 0)
+	assert.Len(t, store.records, 1)
+	assert.True(t, pm.Pools[addr].Liquidity.Equal(liquidity))
+
+	pm.lock.Lock()
+	pm.installPool(store)
+	pm.lock.Unlock()
+	assert.Same(t, store.pool, pm.Pools[addr])
+	assert.Equal(t, pool.ID, store.pool.ID)
+	assert.True(t, store.pool.HasCreated)
+	assert.NoError(t, pm.FlushPools())
+	// 更新原来的记录而不是新建
+	var count int64
+	assert.NoError(t, pm.db.Model(&CorePool{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	records, err := pm.QueryRecords(RecordQuery{PoolAddress: addr.String()})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "simulator.db")
+	_, err := OpenReadOnly(dbFile, "http://127.0.0.1:1")
+	assert.Error(t, err)
+	_, err = os.Stat(dbFile)
+	assert.True(t, os.IsNotExist(err))
+
+	pm := newTestSimulator(t, dbFile)
+	pool := newTestPool(t)
+	pm.Pools[common.HexToAddress(pool.PoolAddress)] = pool
+	pm.dirtyPools[pool.PoolAddress] = pool
+	pm.currentBlock = 100
+	assert.NoError(t, pm.FlushPools())
+
+	readOnly, err := OpenReadOnly(dbFile, "http://127.0.0.1:1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), readOnly.CurrentBlock())
+	assert.Len(t, readOnly.Pools, 1)
+	assert.Len(t, readOnly.QuarantinedPools(), len(legacySkipAddress))
+	// 不能写入
+	readOnly.currentBlock = 101
+	assert.ErrorContains(t, readOnly.FlushPools(), "readonly")
+	committed, err := pm.CommittedBlockNum()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), committed)
+}
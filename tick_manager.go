@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"github.com/shopspring/decimal"
 	"math"
-	"sort"
 )
 
 type Tick struct {
@@ -96,43 +95,64 @@ func (t *Tick) Cross(
 	return t.LiquidityNet
 }
 
+// ticks按index有序保存在cowMap中, Fork之后与原TickManager共享未修改的tick
 type TickManager struct {
-	Ticks       map[int]*Tick `json:"ticks"`
-	SortedTicks []*Tick       `json:"-"`
+	ticks   *cowMap[int, *Tick]
+	journal *poolJournal
+}
+
+type tickManagerJSON struct {
+	Ticks map[int]*Tick `json:"ticks"`
 }
 
 func NewTickManager() *TickManager {
 	return &TickManager{
-		Ticks: map[int]*Tick{},
+		ticks: newCowMap[int, *Tick]((*Tick).Clone),
 	}
 }
+
+// 深拷贝所有tick
 func (tm *TickManager) Clone() *TickManager {
-	ticks := make(map[int]*Tick, len(tm.Ticks))
-	for k, tick := range tm.Ticks {
-		ticks[k] = tick.Clone()
-	}
 	newM := NewTickManager()
-	newM.Ticks = ticks
-	newM.SortTicks()
+	tm.ticks.Ascend(func(index int, tick *Tick) bool {
+		newM.ticks.Set(index, tick.Clone())
+		return true
+	})
 	return newM
 }
 
-func (tm *TickManager) GetTickAndInitIfAbsent(index int) (*Tick, error) {
+// O(1)分叉, 两边之后的修改互不影响
+func (tm *TickManager) Fork() *TickManager {
+	return &TickManager{ticks: tm.ticks.Fork()}
+}
+
+func (tm *TickManager) Len() int {
+	return tm.ticks.Len()
+}
 
-	if tick, ok := tm.Ticks[index]; ok {
+// 修改前记录到撤销日志
+func (tm *TickManager) record(index int) {
+	if tm.journal != nil {
+		tm.journal.recordTick(tm.ticks, index)
+	}
+}
+
+// 返回的tick可以原地修改
+func (tm *TickManager) GetTickAndInitIfAbsent(index int) (*Tick, error) {
+	tm.record(index)
+	if tick, ok := tm.ticks.GetMut(index); ok {
 		return tick, nil
 	} else {
 		tick, err := NewTick(index)
 		if err != nil {
 			return nil, err
 		}
-		tm.Ticks[tick.TickIndex] = tick
-		tm.SortTicks()
+		tm.ticks.Set(tick.TickIndex, tick)
 		return tick, nil
 	}
 }
 func (tm *TickManager) GetTickReadonly(index int) (*Tick, error) {
-	if tick, ok := tm.Ticks[index]; ok {
+	if tick, ok := tm.ticks.Get(index); ok {
 		return tick.Clone(), nil
 	} else {
 		tick, err := NewTick(index)
@@ -142,59 +162,73 @@ func (tm *TickManager) GetTickReadonly(index int) (*Tick, error) {
 		return tick, nil
 	}
 }
-func (tm *TickManager) nextInitializedTick(ticks []*Tick, tick int, lte bool) (*Tick, error) {
 
-	if lte {
-		if tm.isBelowSmallest(ticks, tick) {
-			return nil, errors.New("BELOW_SMALLEST")
-		}
-		if tm.isAtOrAboveLargest(ticks, tick) {
-			return ticks[len(ticks)-1], nil
-		}
-		index, err := tm.binarySearch(ticks, tick)
-		if err != nil {
-			return nil, err
-		}
-		return ticks[index], nil
-	} else {
-		if tm.isAtOrAboveLargest(ticks, tick) {
-			return nil, errors.New("AT_OR_ABOVE_LARGEST")
-		}
-		if tm.isBelowSmallest(ticks, tick) {
-			return ticks[0], nil
-		}
-		index, err := tm.binarySearch(ticks, tick)
-		if err != nil {
-			return nil, err
-		}
-		return ticks[index+1], nil
-	}
+// 不复制的只读访问, 调用方不能修改返回的tick
+func (tm *TickManager) getTick(index int) (*Tick, bool) {
+	return tm.ticks.Get(index)
 }
 
-func (tm *TickManager) SortTicks() {
-	tm.SortedTicks = tm.GetSortedTicks()
+// 直接设置tick, 用于从导出数据重建
+func (tm *TickManager) Set(tick *Tick) {
+	tm.record(tick.TickIndex)
+	tm.ticks.Set(tick.TickIndex, tick)
 }
+
 func (tm *TickManager) Clear(tick int) {
-	delete(tm.Ticks, tick)
-	tm.SortTicks()
+	tm.record(tick)
+	tm.ticks.Delete(tick)
 }
 
-func (tm *TickManager) GetSortedTicks() []*Tick {
-	keys := make([]int, 0, len(tm.Ticks))
-	for k, _ := range tm.Ticks {
-		keys = append(keys, k)
+// 价格从tick a移动到tick b时穿过的已初始化tick数量, 即(min(a,b), max(a,b)]中的tick
+func (tm *TickManager) countInitialized(a, b int) int {
+	if a > b {
+		a, b = b, a
 	}
-	sort.Ints(keys)
-	var result []*Tick
-	for _, k := range keys {
-		result = append(result, tm.Ticks[k])
+	n := 0
+	for {
+		index, _, ok := tm.ticks.Higher(a)
+		if !ok || index > b {
+			return n
+		}
+		n++
+		a = index
 	}
+}
+
+func (tm *TickManager) GetSortedTicks() []*Tick {
+	result := make([]*Tick, 0, tm.ticks.Len())
+	tm.ticks.Ascend(func(_ int, tick *Tick) bool {
+		result = append(result, tick)
+		return true
+	})
+	return result
+}
+
+// Deprecated: 原来的Ticks字段, 现在返回tick拷贝组成的map, 修改不影响pool. 使用GetTickReadonly/GetSortedTicks
+func (tm *TickManager) Ticks() map[int]*Tick {
+	result := make(map[int]*Tick, tm.ticks.Len())
+	tm.ticks.Ascend(func(index int, tick *Tick) bool {
+		result[index] = tick.Clone()
+		return true
+	})
+	return result
+}
+
+// Deprecated: 原来的SortedTicks字段, 现在返回按index排序的tick拷贝. 使用GetSortedTicks
+func (tm *TickManager) SortedTicks() []*Tick {
+	result := make([]*Tick, 0, tm.ticks.Len())
+	tm.ticks.Ascend(func(_ int, tick *Tick) bool {
+		result = append(result, tick.Clone())
+		return true
+	})
 	return result
 }
 
+// Deprecated: tick始终有序, 不需要再排序
+func (tm *TickManager) SortTicks() {}
+
 func (tm *TickManager) GetNextInitializedTick(tick, tickSpacing int, lte bool) (int, bool, error) {
-	sortedTicks := tm.SortedTicks
-	if len(sortedTicks) == 0 {
+	if tm.ticks.Len() == 0 {
 		return 0, false, fmt.Errorf("empty ticks")
 	}
 
@@ -203,44 +237,32 @@ func (tm *TickManager) GetNextInitializedTick(tick, tickSpacing int, lte bool) (
 	if lte {
 		wordPos := compressed >> 8
 		minimum := (wordPos << 8) * tickSpacing
-		if tm.isBelowSmallest(sortedTicks, tick) {
+		nextTick, _, ok := tm.ticks.Floor(tick)
+		if !ok {
+			// below smallest
 			return minimum, false, nil
 		}
-		nextTick, err := tm.nextInitializedTick(sortedTicks, tick, lte)
-		if err != nil {
-			return 0, false, err
-		}
-		nextInitializedTick := int(math.Max(float64(minimum), float64(nextTick.TickIndex)))
-		return nextInitializedTick, nextInitializedTick == nextTick.TickIndex, nil
+		nextInitializedTick := int(math.Max(float64(minimum), float64(nextTick)))
+		return nextInitializedTick, nextInitializedTick == nextTick, nil
 	} else {
 		wordPos := (compressed + 1) >> 8
 		maximum := (((wordPos + 1) << 8) - 1) * tickSpacing
-		if tm.isAtOrAboveLargest(sortedTicks, tick) {
+		nextTick, _, ok := tm.ticks.Higher(tick)
+		if !ok {
+			// at or above largest
 			return maximum, false, nil
 		}
-		nextTick, err := tm.nextInitializedTick(sortedTicks, tick, lte)
-		if err != nil {
-			return 0, false, err
-		}
-		nextInitializedTick := int(math.Min(float64(maximum), float64(nextTick.TickIndex)))
-		return nextInitializedTick, nextInitializedTick == nextTick.TickIndex, nil
+		nextInitializedTick := int(math.Min(float64(maximum), float64(nextTick)))
+		return nextInitializedTick, nextInitializedTick == nextTick, nil
 	}
 }
 
 func (tm *TickManager) GetFeeGrowthInside(tickLower, tickUpper, tickCurrent int, feeGrowthGlobal0X128, feeGrowthGlobal1X128 decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
-	_, lok := tm.Ticks[tickLower]
-	_, uok := tm.Ticks[tickUpper]
+	lower, lok := tm.getTick(tickLower)
+	upper, uok := tm.getTick(tickUpper)
 	if !lok || !uok {
 		return ZERO, ZERO, errors.New("INVALID_TICK")
 	}
-	lower, err := tm.GetTickAndInitIfAbsent(tickLower)
-	if err != nil {
-		return ZERO, ZERO, err
-	}
-	upper, err := tm.GetTickAndInitIfAbsent(tickUpper)
-	if err != nil {
-		return ZERO, ZERO, err
-	}
 
 	var feeGrowthBelow0X128 decimal.Decimal
 	var feeGrowthBelow1X128 decimal.Decimal
@@ -274,39 +296,26 @@ func (tm *TickManager) GetFeeGrowthInside(tickLower, tickUpper, tickCurrent int,
 	return result1, result2, nil
 }
 
-func (tm *TickManager) isAtOrAboveLargest(sortedTicks []*Tick, tick int) bool {
-	if len(sortedTicks) == 0 {
-		return false
-	}
-	return tick >= sortedTicks[len(sortedTicks)-1].TickIndex
-}
-
-func (tm *TickManager) isBelowSmallest(sortedTicks []*Tick, tick int) bool {
-	if len(sortedTicks) == 0 {
-		return false
-	}
-	return tick < sortedTicks[0].TickIndex
+func (tm *TickManager) MarshalJSON() ([]byte, error) {
+	ticks := make(map[int]*Tick, tm.ticks.Len())
+	tm.ticks.Ascend(func(index int, tick *Tick) bool {
+		ticks[index] = tick
+		return true
+	})
+	return json.Marshal(tickManagerJSON{Ticks: ticks})
 }
 
-func (tm *TickManager) binarySearch(ticks []*Tick, tick int) (int, error) {
-	if tm.isBelowSmallest(ticks, tick) {
-		return 0, errors.New("tick is below smallest tick")
+func (tm *TickManager) UnmarshalJSON(data []byte) error {
+	var v tickManagerJSON
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
 	}
-
-	l := 0
-	r := len(ticks) - 1
-	i := 0
-	for {
-		i = int(math.Floor(float64(l+r) / 2))
-		if ticks[i].TickIndex <= tick && (i == len(ticks)-1 || ticks[i+1].TickIndex > tick) {
-			return i, nil
-		}
-		if ticks[i].TickIndex < tick {
-			l = i + 1
-		} else {
-			r = i - 1
-		}
+	tm.ticks = newCowMap[int, *Tick]((*Tick).Clone)
+	for index, tick := range v.Ticks {
+		tm.ticks.Set(index, tick)
 	}
+	return nil
 }
 
 func (nc *TickManager) GormDataType() string {
@@ -325,13 +334,11 @@ func (j *TickManager) Scan(value interface{}) error {
 			err = json.Unmarshal([]byte(v), j)
 		}
 	case nil:
+		*j = *NewTickManager()
 		return nil
 	default:
 		err = errors.New(fmt.Sprint("Failed to unmarshal TickManager value:", value))
 	}
-	if err == nil {
-		j.SortTicks()
-	}
 	return err
 }
 
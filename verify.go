@@ -0,0 +1,100 @@
+package uniswap_v3_simulator
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+)
+
+// v3.go中的ABI把liquidity/positions/ticks写成了大写, selector和链上的pool不同, 这里统一成小写
+var poolABI = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(UniswapV3SimulatorABI))
+	if err != nil {
+		panic(err)
+	}
+	methods := map[string]abi.Method{}
+	for _, method := range a.Methods {
+		name := []rune(method.RawName)
+		name[0] = unicode.ToLower(name[0])
+		methods[string(name)] = abi.NewMethod(string(name), string(name), method.Type, method.StateMutability, method.Constant, method.Payable, method.Inputs, method.Outputs)
+	}
+	a.Methods = methods
+	return a
+}()
+
+type FieldMismatch struct {
+	Field string `json:"field"`
+	Local string `json:"local"`
+	Chain string `json:"chain"`
+}
+
+// 本地pool和链上合约在同一区块的对比结果
+type PoolVerification struct {
+	PoolAddress string          `json:"pool_address"`
+	BlockNum    uint64          `json:"block_num"`
+	Mismatches  []FieldMismatch `json:"mismatches"`
+}
+
+func (v *PoolVerification) OK() bool {
+	return len(v.Mismatches) == 0
+}
+
+// 在当前同步高度读取链上的slot0/liquidity/feeGrowthGlobal并和本地状态比较, 历史区块需要archive节点
+func (pm *Simulator) VerifyPool(ctx context.Context, addr common.Address) (*PoolVerification, error) {
+	pm.lock.RLock()
+	blockNum := pm.currentBlock
+	pool, ok := pm.Pools[addr]
+	if ok {
+		pool = pool.Fork()
+	}
+	pm.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, addr)
+	}
+	client, err := NewUniswapV3SimulatorCaller(addr, pm.rpc)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(blockNum)}
+	slot0, err := client.Slot0(opts)
+	if err != nil {
+		return nil, err
+	}
+	// 绑定中的Liquidity()与链上的selector不同
+	var out []interface{}
+	err = bind.NewBoundContract(addr, poolABI, pm.rpc, nil, nil).Call(opts, &out, "liquidity")
+	if err != nil {
+		return nil, err
+	}
+	liquidity := out[0].(*big.Int)
+	feeGrowth0, err := client.FeeGrowthGlobal0X128(opts)
+	if err != nil {
+		return nil, err
+	}
+	feeGrowth1, err := client.FeeGrowthGlobal1X128(opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &PoolVerification{PoolAddress: pool.PoolAddress, BlockNum: blockNum, Mismatches: []FieldMismatch{}}
+	compare := func(field string, local decimal.Decimal, chain *big.Int) {
+		if !local.Equal(decimal.NewFromBigInt(chain, 0)) {
+			result.Mismatches = append(result.Mismatches, FieldMismatch{Field: field, Local: local.String(), Chain: chain.String()})
+		}
+	}
+	compare("sqrt_price_x96", pool.SqrtPriceX96, slot0.SqrtPriceX96)
+	if int64(pool.TickCurrent) != slot0.Tick.Int64() {
+		result.Mismatches = append(result.Mismatches, FieldMismatch{Field: "tick", Local: strconv.Itoa(pool.TickCurrent), Chain: slot0.Tick.String()})
+	}
+	compare("liquidity", pool.Liquidity, liquidity)
+	compare("fee_growth_global0_x128", pool.FeeGrowthGlobal0X128, feeGrowth0)
+	compare("fee_growth_global1_x128", pool.FeeGrowthGlobal1X128, feeGrowth1)
+	return result, nil
+}